@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"offer-eligibility-api/internal/database"
+	"offer-eligibility-api/internal/middleware"
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
+
+	"github.com/google/uuid"
+)
+
+const apiKeyUsage = "usage: api-key create <name> <role>[,<role>...] [tenant] | list | revoke <id>"
+
+func runAPIKey(opts database.Options, args []string) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+
+	db, err := database.NewDBWithOptions(opts)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "create":
+		if len(args) != 3 && len(args) != 4 {
+			return errors.New(apiKeyUsage)
+		}
+		tenantID := tenant.Default
+		if len(args) == 4 {
+			tenantID = args[3]
+		}
+		return createAPIKey(db, args[1], strings.Split(args[2], ","), tenantID)
+	case "list":
+		return listAPIKeys(db)
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New(apiKeyUsage)
+		}
+		if err := db.RevokeAPIKey(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked api key %s\n", args[1])
+		return nil
+	default:
+		return errors.New(apiKeyUsage)
+	}
+}
+
+func createAPIKey(db *database.DB, name string, roles []string, tenantID string) error {
+	for i, role := range roles {
+		roles[i] = strings.TrimSpace(role)
+		if !middleware.IsValidRole(roles[i]) {
+			return fmt.Errorf("unknown role %q", roles[i])
+		}
+	}
+
+	key, keyHash, err := middleware.GenerateAPIKey()
+	if err != nil {
+		return err
+	}
+
+	apiKey := models.APIKey{
+		ID:        uuid.New().String(),
+		TenantID:  tenantID,
+		Name:      name,
+		Roles:     roles,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := db.CreateAPIKey(apiKey, keyHash); err != nil {
+		return err
+	}
+
+	fmt.Printf("Created api key %s (%s) for tenant %s with roles %s\n", apiKey.ID, name, tenantID, strings.Join(roles, ","))
+	fmt.Printf("Key (shown only once): %s\n", key)
+	return nil
+}
+
+func listAPIKeys(db *database.DB) error {
+	keys, err := db.ListAPIKeys()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTENANT\tNAME\tROLES\tCREATED AT\tREVOKED AT")
+	for _, key := range keys {
+		revokedAt := "-"
+		if key.RevokedAt != nil {
+			revokedAt = key.RevokedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			key.ID, key.TenantID, key.Name, strings.Join(key.Roles, ","), key.CreatedAt.Format(time.RFC3339), revokedAt)
+	}
+	return w.Flush()
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"expvar"
 	"flag"
 	"fmt"
 	"log"
@@ -11,6 +12,7 @@ import (
 
 	"context"
 	"crypto/tls"
+	"offer-eligibility-api/internal/cache"
 	"offer-eligibility-api/internal/config"
 	"offer-eligibility-api/internal/database"
 	"offer-eligibility-api/internal/events"
@@ -20,6 +22,8 @@ import (
 	"offer-eligibility-api/internal/service"
 	tlsconfig "offer-eligibility-api/internal/tls"
 	tracing "offer-eligibility-api/internal/tracing"
+	"offer-eligibility-api/internal/validation"
+	"offer-eligibility-api/internal/webhooks"
 	"strings"
 	"time"
 
@@ -48,7 +52,20 @@ func main() {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
 
-	db, err := database.NewDB(cfg.Database.Path)
+	switch flag.Arg(0) {
+	case "migrate":
+		if err := runMigrate(databaseOptions(cfg.Database), flag.Args()[1:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	case "api-key":
+		if err := runAPIKey(databaseOptions(cfg.Database), flag.Args()[1:]); err != nil {
+			log.Fatalf("API key command failed: %v", err)
+		}
+		return
+	}
+
+	db, err := database.NewDBWithOptions(databaseOptions(cfg.Database))
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
@@ -58,19 +75,81 @@ func main() {
 	featureManager.Register(features.FeatureCacheEnabled, cfg.Features.CacheEnabled, "Enable caching layer")
 	featureManager.Register(features.FeatureEventHooksEnabled, cfg.Features.EventHooksEnabled, "Enable event-driven hooks")
 	featureManager.Register(features.FeatureAdvancedEligibility, cfg.Features.AdvancedEligibility, "Enable advanced eligibility calculations")
-	featureManager.Register(features.FeatureBatchProcessing, cfg.Features.BatchProcessing, "Enable batch processing optimizations")
+	featureManager.Register(features.FeatureBatchProcessing, cfg.Features.BatchProcessing, "Enable the batch eligibility endpoint")
 	defer featureManager.Shutdown()
 
 	var eventManager *events.Manager
-	if cfg.Features.EventHooksEnabled {
+	if cfg.Features.EventHooksEnabled || cfg.Webhooks.Enabled {
 		eventManager = events.NewManager(true)
 		defer eventManager.Shutdown()
 		log.Println("Event-driven hooks: enabled")
 	}
 
+	if cfg.Webhooks.Enabled {
+		dispatcher := webhooks.NewDispatcher(db, webhooks.Options{
+			MaxAttempts:    cfg.Webhooks.MaxAttempts,
+			InitialBackoff: time.Duration(cfg.Webhooks.InitialBackoff) * time.Second,
+			MaxBackoff:     time.Duration(cfg.Webhooks.MaxBackoff) * time.Second,
+			Timeout:        time.Duration(cfg.Webhooks.Timeout) * time.Second,
+			PollInterval:   time.Duration(cfg.Webhooks.PollInterval) * time.Second,
+		})
+		dispatcher.Subscribe(eventManager)
+		dispatcher.Start()
+		defer dispatcher.Stop()
+		log.Println("Webhooks: enabled")
+	}
+
+	if eventManager != nil {
+		relay := events.NewRelay(db, eventManager, events.RelayOptions{
+			PollInterval: time.Duration(cfg.Outbox.PollInterval) * time.Second,
+			BatchSize:    cfg.Outbox.BatchSize,
+			MaxBackoff:   time.Duration(cfg.Outbox.MaxBackoff) * time.Second,
+			MaxAttempts:  cfg.Outbox.MaxAttempts,
+		})
+		relay.Start()
+		defer relay.Stop()
+	}
+
 	svc := service.NewService(db)
+	svc.SetBulkChunkSize(cfg.Ingest.BulkChunkSize)
+	svc.SetBatchLimits(cfg.Eligibility.BatchMaxUsers, cfg.Eligibility.BatchConcurrency)
+	svc.SetRetention(cfg.Retention.GraceDays, cfg.Retention.BatchSize)
 	if eventManager != nil {
 		svc.SetEventManager(eventManager)
+		defer svc.WaitForRefreshes()
+	}
+
+	if cfg.Cache.Enabled || cfg.Features.CacheEnabled {
+		appCache, err := newCache(cfg.Cache)
+		if err != nil {
+			log.Fatalf("Failed to initialize cache: %v", err)
+		}
+		if redisCache, ok := appCache.(*cache.RedisCache); ok {
+			defer redisCache.Close()
+		}
+		svc.SetCache(appCache, time.Duration(cfg.Cache.TTL)*time.Second)
+		log.Printf("Cache: %s (ttl %ds)", cfg.Cache.Type, cfg.Cache.TTL)
+	}
+
+	if eventManager != nil {
+		sweeper := service.NewEligibilitySweeper(svc, time.Duration(cfg.Eligibility.SweepInterval)*time.Second)
+		sweeper.Start()
+		defer sweeper.Stop()
+	}
+
+	scheduler := service.NewOfferScheduler(svc, service.SystemClock, time.Duration(cfg.Scheduler.PollInterval)*time.Second)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	exporter := service.NewEligibleUserExporter(svc, time.Duration(cfg.Eligibility.ExportPollInterval)*time.Second)
+	exporter.Start()
+	defer exporter.Stop()
+
+	if cfg.Retention.Enabled {
+		purger := service.NewRetentionPurger(svc, time.Duration(cfg.Retention.Interval)*time.Second)
+		purger.Start()
+		defer purger.Stop()
+		log.Printf("Retention: transactions kept for %d days", validation.MaxLookbackDays+cfg.Retention.GraceDays)
 	}
 
 	if cfg.Tracing.Enabled {
@@ -102,6 +181,21 @@ func main() {
 		defer rateLimiter.Stop()
 	}
 
+	requireRole := func(roles ...string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	if cfg.Auth.Enabled {
+		authenticator := middleware.NewAuthenticator(db, middleware.AuthOptions{
+			JWTSecret:   cfg.Auth.JWTSecret,
+			JWTIssuer:   cfg.Auth.JWTIssuer,
+			JWTAudience: cfg.Auth.JWTAudience,
+		})
+		requireRole = authenticator.Require
+		log.Println("Authentication: enabled")
+	} else {
+		log.Println("WARNING: Authentication is disabled; all endpoints are anonymous")
+	}
+
 	r := chi.NewRouter()
 
 	r.Use(chimw.RequestID)
@@ -124,25 +218,71 @@ func main() {
 
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   allowedOrigins,
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", middleware.APIKeyHeader},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
 
 	r.Route("/offers", func(r chi.Router) {
-		r.Post("/", h.CreateOffer)
+		r.With(requireRole(middleware.RoleOfferAdmin)).Post("/", h.CreateOffer)
+		r.With(requireRole(middleware.RoleOfferAdmin, middleware.RoleEligibilityReader)).Get("/", h.ListOffers)
+		r.With(requireRole(middleware.RoleOfferAdmin, middleware.RoleEligibilityReader)).Get("/{id}", h.GetOffer)
+		r.With(requireRole(middleware.RoleOfferAdmin)).Patch("/{id}", h.PatchOffer)
+		r.With(requireRole(middleware.RoleOfferAdmin)).Delete("/{id}", h.DeleteOffer)
+		r.With(requireRole(middleware.RoleOfferAdmin, middleware.RoleEligibilityReader)).Get("/{id}/revisions", h.ListOfferRevisions)
+		r.With(requireRole(middleware.RoleOfferAdmin)).Get("/{id}/eligible-users", h.ListEligibleUsers)
+		r.With(requireRole(middleware.RoleOfferAdmin)).Post("/{id}/eligible-users/exports", h.CreateEligibleUserExport)
+		r.With(requireRole(middleware.RoleOfferAdmin)).Get("/{id}/eligible-users/exports/{export_id}", h.GetEligibleUserExport)
+		r.With(requireRole(middleware.RoleOfferAdmin)).Get("/{id}/eligible-users/exports/{export_id}/download", h.DownloadEligibleUserExport)
+	})
+
+	r.With(requireRole(middleware.RoleOfferAdmin)).Post("/offers:simulate", h.SimulateOffer)
+
+	r.Route("/segments", func(r chi.Router) {
+		r.Use(requireRole(middleware.RoleOfferAdmin))
+		r.Post("/", h.CreateSegment)
+		r.Get("/", h.ListSegments)
+		r.Get("/{id}", h.GetSegment)
+		r.Delete("/{id}", h.DeleteSegment)
+		r.Post("/{id}/members", h.AddSegmentMembers)
+		r.Delete("/{id}/members", h.RemoveSegmentMembers)
 	})
 
 	r.Route("/transactions", func(r chi.Router) {
-		r.Post("/", h.CreateTransactions)
+		r.With(requireRole(middleware.RoleTransactionIngestor)).Post("/", h.CreateTransactions)
+	})
+	r.With(requireRole(middleware.RoleTransactionIngestor)).Post("/transactions:bulk", h.BulkImportTransactions)
+
+	r.Route("/webhooks", func(r chi.Router) {
+		r.Use(requireRole(middleware.RoleAdmin))
+		r.Post("/", h.CreateWebhook)
+		r.Get("/", h.ListWebhooks)
+		r.Get("/dead-letters", h.ListWebhookDeadLetters)
+		r.Get("/{id}", h.GetWebhook)
+		r.Delete("/{id}", h.DeleteWebhook)
+		r.Get("/{id}/deliveries", h.ListWebhookDeliveries)
 	})
 
 	r.Route("/users", func(r chi.Router) {
-		r.Get("/{user_id}/eligible-offers", h.GetEligibleOffers)
+		r.With(requireRole(middleware.RoleEligibilityReader)).Get("/{user_id}/eligible-offers", h.GetEligibleOffers)
+		r.With(requireRole(middleware.RoleEligibilityReader)).Get("/{user_id}/eligibility-history", h.GetEligibilityHistory)
+		r.With(requireRole(middleware.RoleOfferRedeemer)).Post("/{user_id}/offers/{offer_id}/activate", h.ActivateOffer)
+		r.With(requireRole(middleware.RoleOfferRedeemer)).Post("/{user_id}/offers/{offer_id}/redeem", h.RedeemOffer)
+	})
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(requireRole(middleware.RoleAdmin))
+		r.Post("/retention:run", h.RunRetention)
+		r.Method(http.MethodGet, "/metrics", expvar.Handler())
 	})
 
+	if featureManager.IsEnabled(features.FeatureBatchProcessing) {
+		r.With(requireRole(middleware.RoleEligibilityReader)).Post("/eligibility:batch", h.BatchEligibility)
+		log.Println("Batch eligibility: enabled")
+	}
+
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
@@ -178,7 +318,11 @@ func main() {
 		protocol = "HTTPS"
 	}
 	log.Printf("Starting %s server on %s", protocol, addr)
-	log.Printf("Database: %s", cfg.Database.Path)
+	if cfg.Database.Driver == database.DriverPostgres {
+		log.Println("Database: postgres")
+	} else {
+		log.Printf("Database: %s", cfg.Database.Path)
+	}
 	if cfg.RateLimit.Enabled {
 		log.Printf("Rate limit: %d requests per %d seconds", cfg.RateLimit.Rate, cfg.RateLimit.Window)
 	} else {
@@ -222,3 +366,21 @@ func main() {
 		}
 	}
 }
+
+func newCache(cfg config.CacheConfig) (cache.Cache, error) {
+	switch cfg.Type {
+	case "redis":
+		return cache.NewRedisCache(cfg.Addr, cfg.Password, cfg.DB)
+	case "memory":
+		return cache.NewInMemoryCache(), nil
+	default:
+		return nil, fmt.Errorf("unsupported cache type %q", cfg.Type)
+	}
+}
+
+func databaseOptions(cfg config.DatabaseConfig) database.Options {
+	if cfg.Driver == database.DriverPostgres {
+		return database.Options{Driver: database.DriverPostgres, DSN: cfg.DSN}
+	}
+	return database.Options{Driver: database.DriverSQLite, DSN: cfg.Path}
+}
@@ -9,13 +9,20 @@ import (
 )
 
 type Config struct {
-	Server    ServerConfig    `json:"server"`
-	Database  DatabaseConfig  `json:"database"`
-	Security  SecurityConfig  `json:"security"`
-	RateLimit RateLimitConfig `json:"rate_limit"`
-	Tracing   TracingConfig   `json:"tracing"`
-	Features  FeaturesConfig  `json:"features"`
-	Cache     CacheConfig     `json:"cache"`
+	Server      ServerConfig      `json:"server"`
+	Database    DatabaseConfig    `json:"database"`
+	Security    SecurityConfig    `json:"security"`
+	RateLimit   RateLimitConfig   `json:"rate_limit"`
+	Tracing     TracingConfig     `json:"tracing"`
+	Features    FeaturesConfig    `json:"features"`
+	Cache       CacheConfig       `json:"cache"`
+	Ingest      IngestConfig      `json:"ingest"`
+	Auth        AuthConfig        `json:"auth"`
+	Webhooks    WebhooksConfig    `json:"webhooks"`
+	Outbox      OutboxConfig      `json:"outbox"`
+	Eligibility EligibilityConfig `json:"eligibility"`
+	Scheduler   SchedulerConfig   `json:"scheduler"`
+	Retention   RetentionConfig   `json:"retention"`
 }
 
 type ServerConfig struct {
@@ -27,7 +34,9 @@ type ServerConfig struct {
 }
 
 type DatabaseConfig struct {
-	Path string `json:"path"`
+	Driver string `json:"driver"`
+	Path   string `json:"path"`
+	DSN    string `json:"dsn"`
 }
 
 type SecurityConfig struct {
@@ -64,6 +73,58 @@ type CacheConfig struct {
 	TTL      int    `json:"ttl"`
 }
 
+type IngestConfig struct {
+	BulkChunkSize int `json:"bulk_chunk_size"`
+}
+
+type AuthConfig struct {
+	Enabled     bool   `json:"enabled"`
+	JWTSecret   string `json:"jwt_secret"`
+	JWTIssuer   string `json:"jwt_issuer"`
+	JWTAudience string `json:"jwt_audience"`
+}
+
+// Durations are in seconds.
+type WebhooksConfig struct {
+	Enabled        bool `json:"enabled"`
+	MaxAttempts    int  `json:"max_attempts"`
+	InitialBackoff int  `json:"initial_backoff"`
+	MaxBackoff     int  `json:"max_backoff"`
+	Timeout        int  `json:"timeout"`
+	PollInterval   int  `json:"poll_interval"`
+}
+
+// Durations are in seconds.
+type OutboxConfig struct {
+	PollInterval int `json:"poll_interval"`
+	BatchSize    int `json:"batch_size"`
+	MaxBackoff   int `json:"max_backoff"`
+	MaxAttempts  int `json:"max_attempts"`
+}
+
+// SweepInterval and ExportPollInterval are in seconds.
+type EligibilityConfig struct {
+	SweepInterval      int `json:"sweep_interval"`
+	BatchMaxUsers      int `json:"batch_max_users"`
+	BatchConcurrency   int `json:"batch_concurrency"`
+	ExportPollInterval int `json:"export_poll_interval"`
+}
+
+// PollInterval, in seconds, is the longest the offer scheduler sleeps between
+// runs when no offer starts or ends sooner.
+type SchedulerConfig struct {
+	PollInterval int `json:"poll_interval"`
+}
+
+// Transactions are kept for the longest offer lookback plus GraceDays.
+// Interval is in seconds.
+type RetentionConfig struct {
+	Enabled   bool `json:"enabled"`
+	GraceDays int  `json:"grace_days"`
+	Interval  int  `json:"interval"`
+	BatchSize int  `json:"batch_size"`
+}
+
 func LoadConfig(configFile string) (*Config, error) {
 	cfg := &Config{
 		Server: ServerConfig{
@@ -74,7 +135,9 @@ func LoadConfig(configFile string) (*Config, error) {
 			KeyFile:   getEnv("SERVER_KEY_FILE", ""),
 		},
 		Database: DatabaseConfig{
-			Path: getEnv("DATABASE_PATH", "./offer_eligibility.db"),
+			Driver: getEnv("DATABASE_DRIVER", "sqlite3"),
+			Path:   getEnv("DATABASE_PATH", "./offer_eligibility.db"),
+			DSN:    getEnv("DATABASE_DSN", ""),
 		},
 		Security: SecurityConfig{
 			MaxRequestBodySize: getEnvInt64("MAX_REQUEST_BODY_SIZE", 10<<20),
@@ -105,6 +168,44 @@ func LoadConfig(configFile string) (*Config, error) {
 			DB:       getEnvInt("CACHE_DB", 0),
 			TTL:      getEnvInt("CACHE_TTL", 300),
 		},
+		Ingest: IngestConfig{
+			BulkChunkSize: getEnvInt("INGEST_BULK_CHUNK_SIZE", 500),
+		},
+		Auth: AuthConfig{
+			Enabled:     getEnvBool("AUTH_ENABLED", false),
+			JWTSecret:   getEnv("AUTH_JWT_SECRET", ""),
+			JWTIssuer:   getEnv("AUTH_JWT_ISSUER", ""),
+			JWTAudience: getEnv("AUTH_JWT_AUDIENCE", ""),
+		},
+		Webhooks: WebhooksConfig{
+			Enabled:        getEnvBool("WEBHOOKS_ENABLED", false),
+			MaxAttempts:    getEnvInt("WEBHOOKS_MAX_ATTEMPTS", 8),
+			InitialBackoff: getEnvInt("WEBHOOKS_INITIAL_BACKOFF", 10),
+			MaxBackoff:     getEnvInt("WEBHOOKS_MAX_BACKOFF", 3600),
+			Timeout:        getEnvInt("WEBHOOKS_TIMEOUT", 10),
+			PollInterval:   getEnvInt("WEBHOOKS_POLL_INTERVAL", 5),
+		},
+		Outbox: OutboxConfig{
+			PollInterval: getEnvInt("OUTBOX_POLL_INTERVAL", 1),
+			BatchSize:    getEnvInt("OUTBOX_BATCH_SIZE", 100),
+			MaxBackoff:   getEnvInt("OUTBOX_MAX_BACKOFF", 300),
+			MaxAttempts:  getEnvInt("OUTBOX_MAX_ATTEMPTS", 10),
+		},
+		Eligibility: EligibilityConfig{
+			SweepInterval:      getEnvInt("ELIGIBILITY_SWEEP_INTERVAL", 300),
+			BatchMaxUsers:      getEnvInt("ELIGIBILITY_BATCH_MAX_USERS", 1000),
+			BatchConcurrency:   getEnvInt("ELIGIBILITY_BATCH_CONCURRENCY", 8),
+			ExportPollInterval: getEnvInt("ELIGIBILITY_EXPORT_POLL_INTERVAL", 5),
+		},
+		Scheduler: SchedulerConfig{
+			PollInterval: getEnvInt("SCHEDULER_POLL_INTERVAL", 60),
+		},
+		Retention: RetentionConfig{
+			Enabled:   getEnvBool("RETENTION_ENABLED", false),
+			GraceDays: getEnvInt("RETENTION_GRACE_DAYS", 30),
+			Interval:  getEnvInt("RETENTION_INTERVAL", 3600),
+			BatchSize: getEnvInt("RETENTION_BATCH_SIZE", 1000),
+		},
 	}
 
 	if configFile != "" {
@@ -143,9 +244,15 @@ func overrideFromEnv(cfg *Config) {
 	if keyFile := os.Getenv("SERVER_KEY_FILE"); keyFile != "" {
 		cfg.Server.KeyFile = keyFile
 	}
+	if driver := os.Getenv("DATABASE_DRIVER"); driver != "" {
+		cfg.Database.Driver = driver
+	}
 	if dbPath := os.Getenv("DATABASE_PATH"); dbPath != "" {
 		cfg.Database.Path = dbPath
 	}
+	if dsn := os.Getenv("DATABASE_DSN"); dsn != "" {
+		cfg.Database.DSN = dsn
+	}
 	if maxBodySize := os.Getenv("MAX_REQUEST_BODY_SIZE"); maxBodySize != "" {
 		if size, err := strconv.ParseInt(maxBodySize, 10, 64); err == nil {
 			cfg.Security.MaxRequestBodySize = size
@@ -213,6 +320,114 @@ func overrideFromEnv(cfg *Config) {
 			cfg.Cache.TTL = t
 		}
 	}
+	if chunkSize := os.Getenv("INGEST_BULK_CHUNK_SIZE"); chunkSize != "" {
+		if c, err := strconv.Atoi(chunkSize); err == nil {
+			cfg.Ingest.BulkChunkSize = c
+		}
+	}
+	if enabled := os.Getenv("AUTH_ENABLED"); enabled != "" {
+		cfg.Auth.Enabled = enabled == "true" || enabled == "1"
+	}
+	if secret := os.Getenv("AUTH_JWT_SECRET"); secret != "" {
+		cfg.Auth.JWTSecret = secret
+	}
+	if issuer := os.Getenv("AUTH_JWT_ISSUER"); issuer != "" {
+		cfg.Auth.JWTIssuer = issuer
+	}
+	if audience := os.Getenv("AUTH_JWT_AUDIENCE"); audience != "" {
+		cfg.Auth.JWTAudience = audience
+	}
+	if enabled := os.Getenv("WEBHOOKS_ENABLED"); enabled != "" {
+		cfg.Webhooks.Enabled = enabled == "true" || enabled == "1"
+	}
+	if attempts := os.Getenv("WEBHOOKS_MAX_ATTEMPTS"); attempts != "" {
+		if a, err := strconv.Atoi(attempts); err == nil {
+			cfg.Webhooks.MaxAttempts = a
+		}
+	}
+	if backoff := os.Getenv("WEBHOOKS_INITIAL_BACKOFF"); backoff != "" {
+		if b, err := strconv.Atoi(backoff); err == nil {
+			cfg.Webhooks.InitialBackoff = b
+		}
+	}
+	if backoff := os.Getenv("WEBHOOKS_MAX_BACKOFF"); backoff != "" {
+		if b, err := strconv.Atoi(backoff); err == nil {
+			cfg.Webhooks.MaxBackoff = b
+		}
+	}
+	if timeout := os.Getenv("WEBHOOKS_TIMEOUT"); timeout != "" {
+		if t, err := strconv.Atoi(timeout); err == nil {
+			cfg.Webhooks.Timeout = t
+		}
+	}
+	if interval := os.Getenv("WEBHOOKS_POLL_INTERVAL"); interval != "" {
+		if i, err := strconv.Atoi(interval); err == nil {
+			cfg.Webhooks.PollInterval = i
+		}
+	}
+	if interval := os.Getenv("OUTBOX_POLL_INTERVAL"); interval != "" {
+		if i, err := strconv.Atoi(interval); err == nil {
+			cfg.Outbox.PollInterval = i
+		}
+	}
+	if size := os.Getenv("OUTBOX_BATCH_SIZE"); size != "" {
+		if s, err := strconv.Atoi(size); err == nil {
+			cfg.Outbox.BatchSize = s
+		}
+	}
+	if backoff := os.Getenv("OUTBOX_MAX_BACKOFF"); backoff != "" {
+		if b, err := strconv.Atoi(backoff); err == nil {
+			cfg.Outbox.MaxBackoff = b
+		}
+	}
+	if attempts := os.Getenv("OUTBOX_MAX_ATTEMPTS"); attempts != "" {
+		if a, err := strconv.Atoi(attempts); err == nil {
+			cfg.Outbox.MaxAttempts = a
+		}
+	}
+	if interval := os.Getenv("ELIGIBILITY_SWEEP_INTERVAL"); interval != "" {
+		if i, err := strconv.Atoi(interval); err == nil {
+			cfg.Eligibility.SweepInterval = i
+		}
+	}
+	if maxUsers := os.Getenv("ELIGIBILITY_BATCH_MAX_USERS"); maxUsers != "" {
+		if m, err := strconv.Atoi(maxUsers); err == nil {
+			cfg.Eligibility.BatchMaxUsers = m
+		}
+	}
+	if concurrency := os.Getenv("ELIGIBILITY_BATCH_CONCURRENCY"); concurrency != "" {
+		if c, err := strconv.Atoi(concurrency); err == nil {
+			cfg.Eligibility.BatchConcurrency = c
+		}
+	}
+	if interval := os.Getenv("ELIGIBILITY_EXPORT_POLL_INTERVAL"); interval != "" {
+		if i, err := strconv.Atoi(interval); err == nil {
+			cfg.Eligibility.ExportPollInterval = i
+		}
+	}
+	if interval := os.Getenv("SCHEDULER_POLL_INTERVAL"); interval != "" {
+		if i, err := strconv.Atoi(interval); err == nil {
+			cfg.Scheduler.PollInterval = i
+		}
+	}
+	if enabled := os.Getenv("RETENTION_ENABLED"); enabled != "" {
+		cfg.Retention.Enabled = enabled == "true" || enabled == "1"
+	}
+	if days := os.Getenv("RETENTION_GRACE_DAYS"); days != "" {
+		if d, err := strconv.Atoi(days); err == nil {
+			cfg.Retention.GraceDays = d
+		}
+	}
+	if interval := os.Getenv("RETENTION_INTERVAL"); interval != "" {
+		if i, err := strconv.Atoi(interval); err == nil {
+			cfg.Retention.Interval = i
+		}
+	}
+	if size := os.Getenv("RETENTION_BATCH_SIZE"); size != "" {
+		if s, err := strconv.Atoi(size); err == nil {
+			cfg.Retention.BatchSize = s
+		}
+	}
 }
 
 func getEnv(key, defaultValue string) string {
@@ -251,8 +466,17 @@ func (c *Config) Validate() error {
 	if c.Server.Port == "" {
 		return fmt.Errorf("server port is required")
 	}
-	if c.Database.Path == "" {
-		return fmt.Errorf("database path is required")
+	switch c.Database.Driver {
+	case "sqlite3":
+		if c.Database.Path == "" {
+			return fmt.Errorf("database path is required")
+		}
+	case "postgres":
+		if c.Database.DSN == "" {
+			return fmt.Errorf("database dsn is required for the postgres driver")
+		}
+	default:
+		return fmt.Errorf("database driver must be 'sqlite3' or 'postgres'")
 	}
 	if c.Server.EnableTLS {
 		if c.Server.CertFile == "" || c.Server.KeyFile == "" {
@@ -267,5 +491,57 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("rate limit window must be positive")
 		}
 	}
+	if c.Cache.Enabled || c.Features.CacheEnabled {
+		if c.Cache.Type != "memory" && c.Cache.Type != "redis" {
+			return fmt.Errorf("cache type must be 'memory' or 'redis'")
+		}
+		if c.Cache.TTL <= 0 {
+			return fmt.Errorf("cache ttl must be positive")
+		}
+	}
+	if c.Ingest.BulkChunkSize <= 0 {
+		return fmt.Errorf("ingest bulk chunk size must be positive")
+	}
+	if c.Auth.JWTSecret != "" && len(c.Auth.JWTSecret) < 32 {
+		return fmt.Errorf("auth jwt secret must be at least 32 bytes")
+	}
+	if c.Webhooks.Enabled {
+		if c.Webhooks.MaxAttempts <= 0 {
+			return fmt.Errorf("webhooks max attempts must be positive")
+		}
+		if c.Webhooks.InitialBackoff <= 0 || c.Webhooks.MaxBackoff < c.Webhooks.InitialBackoff {
+			return fmt.Errorf("webhooks backoff must be positive and max backoff at least the initial backoff")
+		}
+		if c.Webhooks.Timeout <= 0 || c.Webhooks.PollInterval <= 0 {
+			return fmt.Errorf("webhooks timeout and poll interval must be positive")
+		}
+	}
+	if c.Outbox.PollInterval <= 0 || c.Outbox.BatchSize <= 0 {
+		return fmt.Errorf("outbox poll interval and batch size must be positive")
+	}
+	if c.Outbox.MaxBackoff < c.Outbox.PollInterval {
+		return fmt.Errorf("outbox max backoff must be at least the poll interval")
+	}
+	if c.Outbox.MaxAttempts <= 0 {
+		return fmt.Errorf("outbox max attempts must be positive")
+	}
+	if c.Eligibility.SweepInterval <= 0 {
+		return fmt.Errorf("eligibility sweep interval must be positive")
+	}
+	if c.Eligibility.BatchMaxUsers <= 0 || c.Eligibility.BatchConcurrency <= 0 {
+		return fmt.Errorf("eligibility batch max users and concurrency must be positive")
+	}
+	if c.Eligibility.ExportPollInterval <= 0 {
+		return fmt.Errorf("eligibility export poll interval must be positive")
+	}
+	if c.Scheduler.PollInterval <= 0 {
+		return fmt.Errorf("scheduler poll interval must be positive")
+	}
+	if c.Retention.GraceDays < 0 {
+		return fmt.Errorf("retention grace days must not be negative")
+	}
+	if c.Retention.Interval <= 0 || c.Retention.BatchSize <= 0 {
+		return fmt.Errorf("retention interval and batch size must be positive")
+	}
 	return nil
 }
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+)
+
+// Only the hash of an API key is stored; the key itself is shown once, when
+// it is created.
+func (db *DB) CreateAPIKey(key models.APIKey, keyHash string) error {
+	roles, err := json.Marshal(key.Roles)
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	_, err = db.conn.Exec(db.rebind(`INSERT INTO api_keys (id, tenant_id, name, key_hash, roles, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`),
+		key.ID, key.TenantID, key.Name, keyHash, string(roles), key.CreatedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPIKeyByHash returns the active key with the given hash; revoked keys
+// are reported as not found.
+func (db *DB) GetAPIKeyByHash(keyHash string) (models.APIKey, error) {
+	row := db.conn.QueryRow(db.rebind(`SELECT id, tenant_id, name, roles, created_at, revoked_at
+		FROM api_keys
+		WHERE key_hash = ?
+		AND revoked_at IS NULL`), keyHash)
+
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIKey{}, fmt.Errorf("api key: %w", ErrNotFound)
+	}
+	return key, err
+}
+
+func (db *DB) ListAPIKeys() ([]models.APIKey, error) {
+	rows, err := db.conn.Query(`SELECT id, tenant_id, name, roles, created_at, revoked_at
+		FROM api_keys
+		ORDER BY created_at, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (db *DB) RevokeAPIKey(id string) error {
+	result, err := db.conn.Exec(db.rebind(`UPDATE api_keys
+		SET revoked_at = ?
+		WHERE id = ?
+		AND revoked_at IS NULL`), time.Now().UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("api key %s: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var key models.APIKey
+	var rolesJSON, createdAtStr string
+	var revokedAtStr sql.NullString
+
+	if err := row.Scan(&key.ID, &key.TenantID, &key.Name, &rolesJSON, &createdAtStr, &revokedAtStr); err != nil {
+		return models.APIKey{}, fmt.Errorf("failed to scan api key: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(rolesJSON), &key.Roles); err != nil {
+		return models.APIKey{}, fmt.Errorf("failed to parse api key roles: %w", err)
+	}
+
+	var err error
+	key.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("failed to parse created_at: %w", err)
+	}
+
+	if revokedAtStr.Valid {
+		revokedAt, err := time.Parse(time.RFC3339, revokedAtStr.String)
+		if err != nil {
+			return models.APIKey{}, fmt.Errorf("failed to parse revoked_at: %w", err)
+		}
+		key.RevokedAt = &revokedAt
+	}
+
+	return key, nil
+}
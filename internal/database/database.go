@@ -3,116 +3,190 @@ package database
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"offer-eligibility-api/internal/models"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+)
+
+const offerColumns = `id, tenant_id, merchant_id, mcc_whitelist, active, min_txn_count,
+		min_spend_cents, min_txn_amount_cents, lookback_days, starts_at, ends_at, rules,
+		max_redemptions, max_redemptions_per_user, budget_cents, reward_cents, budget_spent_cents, segments, version`
+
+// budgetAvailable selects offers without a budget or with enough left for
+// one more reward.
+const budgetAvailable = `(budget_cents = 0 OR budget_spent_cents + reward_cents <= budget_cents)`
+
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
 type DB struct {
-	conn *sql.DB
+	conn   *sql.DB
+	driver string
+}
+
+type Options struct {
+	Driver string
+	DSN    string
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
 func NewDB(dbPath string) (*DB, error) {
-	conn, err := sql.Open("sqlite3", dbPath+"?_foreign_keys=1")
+	return NewDBWithOptions(Options{Driver: DriverSQLite, DSN: dbPath})
+}
+
+func NewDBWithOptions(opts Options) (*DB, error) {
+	db, err := OpenDBWithOptions(opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
 	}
 
-	db := &DB{conn: conn}
-
-	if err := db.initSchema(); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("failed to initialize schema: %w", err)
+	if err := db.MigrateUp(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate schema: %w", err)
 	}
 
 	return db, nil
 }
 
-func (db *DB) Close() error {
-	return db.conn.Close()
+// OpenDB opens the database without applying migrations.
+func OpenDB(dbPath string) (*DB, error) {
+	return OpenDBWithOptions(Options{Driver: DriverSQLite, DSN: dbPath})
 }
 
-func (db *DB) initSchema() error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS offers (
-			id TEXT PRIMARY KEY,
-			merchant_id TEXT NOT NULL,
-			mcc_whitelist TEXT NOT NULL,
-			active INTEGER NOT NULL,
-			min_txn_count INTEGER NOT NULL,
-			lookback_days INTEGER NOT NULL,
-			starts_at TEXT NOT NULL,
-			ends_at TEXT NOT NULL,
-			created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE TABLE IF NOT EXISTS transactions (
-			id TEXT PRIMARY KEY,
-			user_id TEXT NOT NULL,
-			merchant_id TEXT NOT NULL,
-			mcc TEXT NOT NULL,
-			amount_cents INTEGER NOT NULL,
-			approved_at TEXT NOT NULL,
-			created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
-		)`,
-		`CREATE INDEX IF NOT EXISTS idx_user_id ON transactions(user_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_merchant_id ON transactions(merchant_id)`,
-		`CREATE INDEX IF NOT EXISTS idx_mcc ON transactions(mcc)`,
-		`CREATE INDEX IF NOT EXISTS idx_approved_at ON transactions(approved_at)`,
-		`CREATE INDEX IF NOT EXISTS idx_user_approved_at ON transactions(user_id, approved_at)`,
-	}
-
-	for _, query := range queries {
-		if _, err := db.conn.Exec(query); err != nil {
-			return fmt.Errorf("failed to execute schema query: %w", err)
-		}
+func OpenDBWithOptions(opts Options) (*DB, error) {
+	var dsn string
+	switch opts.Driver {
+	case DriverSQLite:
+		dsn = opts.DSN + "?_foreign_keys=1"
+	case DriverPostgres:
+		dsn = opts.DSN
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", opts.Driver)
 	}
 
-	return nil
+	conn, err := sql.Open(opts.Driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return &DB{conn: conn, driver: opts.Driver}, nil
+}
+
+func (db *DB) Close() error {
+	return db.conn.Close()
 }
 
-func (db *DB) UpsertOffer(offer models.Offer) error {
+// UpsertOffer writes the offer, a new revision recording who changed what and
+// when, and any outbox events in one transaction.
+func (db *DB) UpsertOffer(offer models.Offer, changedBy string, changedAt time.Time, outbox ...models.OutboxEvent) error {
 	mccWhitelistJSON := serializeMCCWhitelist(offer.MCCWhitelist)
 
+	rulesJSON, err := serializeRules(offer.Rules)
+	if err != nil {
+		return fmt.Errorf("failed to upsert offer: %w", err)
+	}
+
 	query := `INSERT INTO offers (
-		id, merchant_id, mcc_whitelist, active, min_txn_count, 
-		lookback_days, starts_at, ends_at, updated_at
-	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
-	ON CONFLICT(id) DO UPDATE SET
+		id, tenant_id, merchant_id, mcc_whitelist, active, min_txn_count, 
+		min_spend_cents, min_txn_amount_cents, lookback_days,
+		starts_at, ends_at, rules, max_redemptions, max_redemptions_per_user,
+		budget_cents, reward_cents, segments, updated_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(tenant_id, id) DO UPDATE SET
 		merchant_id = excluded.merchant_id,
 		mcc_whitelist = excluded.mcc_whitelist,
 		active = excluded.active,
 		min_txn_count = excluded.min_txn_count,
+		min_spend_cents = excluded.min_spend_cents,
+		min_txn_amount_cents = excluded.min_txn_amount_cents,
 		lookback_days = excluded.lookback_days,
 		starts_at = excluded.starts_at,
 		ends_at = excluded.ends_at,
-		updated_at = excluded.updated_at`
+		rules = excluded.rules,
+		max_redemptions = excluded.max_redemptions,
+		max_redemptions_per_user = excluded.max_redemptions_per_user,
+		budget_cents = excluded.budget_cents,
+		reward_cents = excluded.reward_cents,
+		segments = excluded.segments,
+		updated_at = excluded.updated_at,
+		deleted_at = NULL,
+		version = offers.version + 1`
 
-	_, err := db.conn.Exec(
-		query,
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	previous, previousDeleted, err := db.getOfferForRevision(tx, offer.TenantID, offer.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		db.rebind(query),
 		offer.ID,
+		offer.TenantID,
 		offer.MerchantID,
 		mccWhitelistJSON,
-		offer.Active,
+		boolToInt(offer.Active),
 		offer.MinTxnCount,
+		offer.MinSpendCents,
+		offer.MinTxnAmountCents,
 		offer.LookbackDays,
 		offer.StartsAt.Format(time.RFC3339),
 		offer.EndsAt.Format(time.RFC3339),
-		time.Now().UTC().Format(time.RFC3339),
+		rulesJSON,
+		offer.MaxRedemptions,
+		offer.MaxRedemptionsPerUser,
+		offer.BudgetCents,
+		offer.RewardCents,
+		serializeSegments(offer.Segments),
+		changedAt.UTC().Format(time.RFC3339),
 	)
 
 	if err != nil {
 		return fmt.Errorf("failed to upsert offer: %w", err)
 	}
 
+	if err := db.recordOfferRevision(tx, offer.TenantID, offer.ID, previous, previousDeleted, changedBy, changedAt); err != nil {
+		return err
+	}
+
+	if err := db.insertOutbox(tx, outbox); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return nil
 }
 
-func (db *DB) InsertTransactions(transactions []models.Transaction) (int, error) {
+func (db *DB) InsertTransactions(transactions []models.Transaction, outbox ...models.OutboxEvent) (int, error) {
 	if len(transactions) == 0 {
 		return 0, nil
 	}
@@ -123,9 +197,9 @@ func (db *DB) InsertTransactions(transactions []models.Transaction) (int, error)
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`INSERT INTO transactions (
-		id, user_id, merchant_id, mcc, amount_cents, approved_at
-	) VALUES (?, ?, ?, ?, ?, ?)`)
+	stmt, err := tx.Prepare(db.rebind(`INSERT INTO transactions (
+		id, tenant_id, user_id, merchant_id, mcc, amount_cents, approved_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?)`))
 	if err != nil {
 		return 0, fmt.Errorf("failed to prepare statement: %w", err)
 	}
@@ -135,11 +209,12 @@ func (db *DB) InsertTransactions(transactions []models.Transaction) (int, error)
 	for _, txn := range transactions {
 		_, err := stmt.Exec(
 			txn.ID,
+			txn.TenantID,
 			txn.UserID,
 			txn.MerchantID,
 			txn.MCC,
 			txn.AmountCents,
-			txn.ApprovedAt.Format(time.RFC3339),
+			txn.ApprovedAt.UTC().Format(time.RFC3339),
 		)
 		if err != nil {
 			return 0, fmt.Errorf("failed to insert transaction %s: %w", txn.ID, err)
@@ -147,6 +222,10 @@ func (db *DB) InsertTransactions(transactions []models.Transaction) (int, error)
 		inserted++
 	}
 
+	if err := db.insertOutbox(tx, outbox); err != nil {
+		return 0, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -154,77 +233,361 @@ func (db *DB) InsertTransactions(transactions []models.Transaction) (int, error)
 	return inserted, nil
 }
 
-func (db *DB) GetActiveOffers(now time.Time) ([]models.Offer, error) {
-	query := `SELECT id, merchant_id, mcc_whitelist, active, min_txn_count, 
-		lookback_days, starts_at, ends_at
+// InsertTransactionsIdempotent inserts every transaction whose ID is new to its
+// tenant and compares the rest against the stored row, returning one status per input.
+// When outbox is not nil, the events it builds for the inserted transactions
+// are written in the same transaction.
+func (db *DB) InsertTransactionsIdempotent(transactions []models.Transaction, outbox OutboxFunc) ([]models.IngestStatus, error) {
+	if len(transactions) == 0 {
+		return nil, nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	insertStmt, err := tx.Prepare(db.rebind(`INSERT INTO transactions (
+		id, tenant_id, user_id, merchant_id, mcc, amount_cents, approved_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(tenant_id, id) DO NOTHING`))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer insertStmt.Close()
+
+	selectStmt, err := tx.Prepare(db.rebind(`SELECT user_id, merchant_id, mcc, amount_cents, approved_at
+		FROM transactions
+		WHERE tenant_id = ?
+		AND id = ?`))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer selectStmt.Close()
+
+	statuses := make([]models.IngestStatus, len(transactions))
+	for i, txn := range transactions {
+		approvedAt := txn.ApprovedAt.UTC().Format(time.RFC3339)
+
+		result, err := insertStmt.Exec(txn.ID, txn.TenantID, txn.UserID, txn.MerchantID, txn.MCC, txn.AmountCents, approvedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert transaction %s: %w", txn.ID, err)
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert transaction %s: %w", txn.ID, err)
+		}
+		if affected > 0 {
+			statuses[i] = models.IngestInserted
+			continue
+		}
+
+		var existing models.Transaction
+		var existingApprovedAt string
+		err = selectStmt.QueryRow(txn.TenantID, txn.ID).Scan(
+			&existing.UserID,
+			&existing.MerchantID,
+			&existing.MCC,
+			&existing.AmountCents,
+			&existingApprovedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load existing transaction %s: %w", txn.ID, err)
+		}
+
+		if existing.UserID == txn.UserID &&
+			existing.MerchantID == txn.MerchantID &&
+			existing.MCC == txn.MCC &&
+			existing.AmountCents == txn.AmountCents &&
+			existingApprovedAt == approvedAt {
+			statuses[i] = models.IngestDuplicate
+		} else {
+			statuses[i] = models.IngestConflict
+		}
+	}
+
+	if outbox != nil {
+		var inserted []models.Transaction
+		for i, status := range statuses {
+			if status == models.IngestInserted {
+				inserted = append(inserted, transactions[i])
+			}
+		}
+
+		if len(inserted) > 0 {
+			events, err := outbox(inserted)
+			if err != nil {
+				return nil, err
+			}
+			if err := db.insertOutbox(tx, events); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return statuses, nil
+}
+
+// GetActiveOffers returns the offers live at now whose budget can still pay
+// a reward. When now is earlier than the tenant's latest offer change, the
+// answer is rebuilt from the revisions that were current at now, so
+// back-dated queries reproduce historical answers.
+func (db *DB) GetActiveOffers(tenantID string, now time.Time) ([]models.Offer, error) {
+	latest, err := db.latestOfferChange(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil && now.Before(*latest) {
+		return db.getActiveOffersAt(tenantID, now)
+	}
+
+	query := `SELECT ` + offerColumns + `
 		FROM offers
-		WHERE active = 1 
+		WHERE tenant_id = ?
+		AND active = 1 
+		AND deleted_at IS NULL
 		AND starts_at <= ? 
-		AND ends_at >= ?`
+		AND ends_at >= ?
+		AND ` + budgetAvailable
 
-	rows, err := db.conn.Query(query, now.Format(time.RFC3339), now.Format(time.RFC3339))
+	rows, err := db.conn.Query(db.rebind(query), tenantID, now.Format(time.RFC3339), now.Format(time.RFC3339))
 	if err != nil {
 		return nil, fmt.Errorf("failed to query active offers: %w", err)
 	}
 	defer rows.Close()
 
-	var offers []models.Offer
+	return scanOffers(rows)
+}
+
+func (db *DB) GetOffer(tenantID, id string) (models.Offer, error) {
+	query := `SELECT ` + offerColumns + `
+		FROM offers
+		WHERE id = ?
+		AND tenant_id = ?
+		AND deleted_at IS NULL`
+
+	offer, err := scanOffer(db.conn.QueryRow(db.rebind(query), id, tenantID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Offer{}, fmt.Errorf("offer %s: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return models.Offer{}, err
+	}
+
+	return offer, nil
+}
+
+func (db *DB) ListOffers(tenantID string, filter models.OfferFilter) ([]models.Offer, error) {
+	query := `SELECT ` + offerColumns + `
+		FROM offers
+		WHERE tenant_id = ?
+		AND deleted_at IS NULL`
+	args := []interface{}{tenantID}
+
+	if filter.MerchantID != "" {
+		query += " AND merchant_id = ?"
+		args = append(args, filter.MerchantID)
+	}
+
+	if filter.Active != nil {
+		query += " AND active = ?"
+		args = append(args, boolToInt(*filter.Active))
+	}
+
+	if filter.LiveAt != nil {
+		liveAt := filter.LiveAt.Format(time.RFC3339)
+		query += " AND starts_at <= ? AND ends_at >= ?"
+		args = append(args, liveAt, liveAt)
+	}
+
+	query += " ORDER BY starts_at, id"
+
+	rows, err := db.conn.Query(db.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query offers: %w", err)
+	}
+	defer rows.Close()
+
+	return scanOffers(rows)
+}
+
+func (db *DB) DeleteOffer(tenantID, id, changedBy string, changedAt time.Time, outbox ...models.OutboxEvent) error {
+	now := changedAt.UTC().Format(time.RFC3339)
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	previous, _, err := db.getOfferForRevision(tx, tenantID, id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(db.rebind(`UPDATE offers
+		SET active = 0, deleted_at = ?, updated_at = ?, version = version + 1
+		WHERE id = ?
+		AND tenant_id = ?
+		AND deleted_at IS NULL`), now, now, id, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to delete offer: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete offer: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("offer %s: %w", id, ErrNotFound)
+	}
+
+	if err := db.recordOfferRevision(tx, tenantID, id, previous, false, changedBy, changedAt); err != nil {
+		return err
+	}
+
+	if err := db.insertOutbox(tx, outbox); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) GetUserTransactions(tenantID, userID string, from, to time.Time) ([]models.Transaction, error) {
+	query := `SELECT id, tenant_id, user_id, merchant_id, mcc, amount_cents, approved_at
+		FROM transactions
+		WHERE tenant_id = ?
+		AND user_id = ?
+		AND approved_at >= ?
+		AND approved_at <= ?
+		ORDER BY approved_at`
+
+	rows, err := db.conn.Query(db.rebind(query), tenantID, userID, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []models.Transaction
 	for rows.Next() {
-		var offer models.Offer
-		var mccWhitelistJSON string
-		var startsAtStr, endsAtStr string
-
-		err := rows.Scan(
-			&offer.ID,
-			&offer.MerchantID,
-			&mccWhitelistJSON,
-			&offer.Active,
-			&offer.MinTxnCount,
-			&offer.LookbackDays,
-			&startsAtStr,
-			&endsAtStr,
-		)
+		var txn models.Transaction
+		var approvedAtStr string
+
+		if err := rows.Scan(
+			&txn.ID,
+			&txn.TenantID,
+			&txn.UserID,
+			&txn.MerchantID,
+			&txn.MCC,
+			&txn.AmountCents,
+			&approvedAtStr,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan transaction: %w", err)
+		}
+
+		txn.ApprovedAt, err = time.Parse(time.RFC3339, approvedAtStr)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan offer: %w", err)
+			return nil, fmt.Errorf("failed to parse approved_at: %w", err)
 		}
 
-		offer.MCCWhitelist = deserializeMCCWhitelist(mccWhitelistJSON)
+		transactions = append(transactions, txn)
+	}
 
-		offer.StartsAt, err = time.Parse(time.RFC3339, startsAtStr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse starts_at: %w", err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// ForEachUserTransactions passes the tenant's transactions approved in
+// [from, to] to fn one user at a time, in user ID order. An error from fn
+// stops the iteration and is returned.
+func (db *DB) ForEachUserTransactions(tenantID string, from, to time.Time, fn func(userID string, transactions []models.Transaction) error) error {
+	rows, err := db.conn.Query(db.rebind(`SELECT id, tenant_id, user_id, merchant_id, mcc, amount_cents, approved_at
+		FROM transactions
+		WHERE tenant_id = ?
+		AND approved_at >= ?
+		AND approved_at <= ?
+		ORDER BY user_id, approved_at`), tenantID, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var transactions []models.Transaction
+	for rows.Next() {
+		var txn models.Transaction
+		var approvedAtStr string
+
+		if err := rows.Scan(
+			&txn.ID,
+			&txn.TenantID,
+			&txn.UserID,
+			&txn.MerchantID,
+			&txn.MCC,
+			&txn.AmountCents,
+			&approvedAtStr,
+		); err != nil {
+			return fmt.Errorf("failed to scan transaction: %w", err)
 		}
 
-		offer.EndsAt, err = time.Parse(time.RFC3339, endsAtStr)
+		txn.ApprovedAt, err = time.Parse(time.RFC3339, approvedAtStr)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse ends_at: %w", err)
+			return fmt.Errorf("failed to parse approved_at: %w", err)
 		}
 
-		offers = append(offers, offer)
+		if len(transactions) > 0 && transactions[0].UserID != txn.UserID {
+			if err := fn(transactions[0].UserID, transactions); err != nil {
+				return err
+			}
+			transactions = nil
+		}
+		transactions = append(transactions, txn)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating offers: %w", err)
+		return fmt.Errorf("error iterating transactions: %w", err)
 	}
 
-	return offers, nil
+	if len(transactions) > 0 {
+		return fn(transactions[0].UserID, transactions)
+	}
+
+	return nil
 }
 
-func (db *DB) CountMatchingTransactions(
+// SummarizeMatchingTransactions aggregates the user's transactions matching
+// the offer's merchant_id or mcc_whitelist in its lookback window. It is not
+// part of Store: GetEligibleOffers evaluates offers in memory, and tests use
+// this to check that evaluation against SQL.
+func (db *DB) SummarizeMatchingTransactions(
 	userID string,
 	offer models.Offer,
 	now time.Time,
-) (int, error) {
+) (models.TransactionSummary, error) {
 	lookbackStart := now.AddDate(0, 0, -offer.LookbackDays)
 
-	query := `SELECT COUNT(*) FROM transactions
-		WHERE user_id = ?
+	query := `SELECT COUNT(*), COALESCE(SUM(amount_cents), 0), COALESCE(MAX(amount_cents), 0)
+		FROM transactions
+		WHERE tenant_id = ?
+		AND user_id = ?
 		AND approved_at >= ?
 		AND approved_at <= ?
 		AND (
 			merchant_id = ?`
 
-	args := []interface{}{userID, lookbackStart.Format(time.RFC3339), now.Format(time.RFC3339), offer.MerchantID}
+	args := []interface{}{offer.TenantID, userID, lookbackStart.Format(time.RFC3339), now.Format(time.RFC3339), offer.MerchantID}
 
 	if len(offer.MCCWhitelist) > 0 {
 		query += " OR mcc IN ("
@@ -240,13 +603,118 @@ func (db *DB) CountMatchingTransactions(
 
 	query += ")"
 
-	var count int
-	err := db.conn.QueryRow(query, args...).Scan(&count)
+	var summary models.TransactionSummary
+	err := db.conn.QueryRow(db.rebind(query), args...).Scan(&summary.Count, &summary.TotalCents, &summary.MaxCents)
 	if err != nil {
-		return 0, fmt.Errorf("failed to count matching transactions: %w", err)
+		return models.TransactionSummary{}, fmt.Errorf("failed to summarize matching transactions: %w", err)
+	}
+
+	return summary, nil
+}
+
+func scanOffers(rows *sql.Rows) ([]models.Offer, error) {
+	var offers []models.Offer
+	for rows.Next() {
+		offer, err := scanOffer(rows)
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, offer)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating offers: %w", err)
 	}
 
-	return count, nil
+	return offers, nil
+}
+
+func scanOffer(row rowScanner) (models.Offer, error) {
+	var offer models.Offer
+	var mccWhitelistJSON string
+	var startsAtStr, endsAtStr string
+	var rulesJSON sql.NullString
+	var segmentsJSON string
+
+	err := row.Scan(
+		&offer.ID,
+		&offer.TenantID,
+		&offer.MerchantID,
+		&mccWhitelistJSON,
+		&offer.Active,
+		&offer.MinTxnCount,
+		&offer.MinSpendCents,
+		&offer.MinTxnAmountCents,
+		&offer.LookbackDays,
+		&startsAtStr,
+		&endsAtStr,
+		&rulesJSON,
+		&offer.MaxRedemptions,
+		&offer.MaxRedemptionsPerUser,
+		&offer.BudgetCents,
+		&offer.RewardCents,
+		&offer.BudgetSpentCents,
+		&segmentsJSON,
+		&offer.Version,
+	)
+	if err != nil {
+		return models.Offer{}, fmt.Errorf("failed to scan offer: %w", err)
+	}
+
+	if rulesJSON.Valid && rulesJSON.String != "" {
+		var rule models.Rule
+		if err := json.Unmarshal([]byte(rulesJSON.String), &rule); err != nil {
+			return models.Offer{}, fmt.Errorf("failed to parse rules: %w", err)
+		}
+		offer.Rules = &rule
+	}
+
+	offer.MCCWhitelist = deserializeMCCWhitelist(mccWhitelistJSON)
+
+	if segmentsJSON != "" && segmentsJSON != "[]" {
+		if err := json.Unmarshal([]byte(segmentsJSON), &offer.Segments); err != nil {
+			return models.Offer{}, fmt.Errorf("failed to parse segments: %w", err)
+		}
+	}
+
+	offer.StartsAt, err = time.Parse(time.RFC3339, startsAtStr)
+	if err != nil {
+		return models.Offer{}, fmt.Errorf("failed to parse starts_at: %w", err)
+	}
+
+	offer.EndsAt, err = time.Parse(time.RFC3339, endsAtStr)
+	if err != nil {
+		return models.Offer{}, fmt.Errorf("failed to parse ends_at: %w", err)
+	}
+
+	return offer, nil
+}
+
+// rebind rewrites the ? placeholders used throughout this package into the
+// driver's native form.
+func (db *DB) rebind(query string) string {
+	if db.driver != DriverPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
 }
 
 func serializeMCCWhitelist(mccList []string) string {
@@ -260,6 +728,28 @@ func serializeMCCWhitelist(mccList []string) string {
 	return string(data)
 }
 
+func serializeSegments(segmentIDs []string) string {
+	if len(segmentIDs) == 0 {
+		return "[]"
+	}
+	data, err := json.Marshal(segmentIDs)
+	if err != nil {
+		return "[]"
+	}
+	return string(data)
+}
+
+func serializeRules(rule *models.Rule) (sql.NullString, error) {
+	if rule == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(rule)
+	if err != nil {
+		return sql.NullString{}, fmt.Errorf("failed to serialize rules: %w", err)
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
 func deserializeMCCWhitelist(serialized string) []string {
 	if serialized == "" || serialized == "[]" {
 		return []string{}
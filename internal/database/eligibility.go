@@ -0,0 +1,209 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+)
+
+func (db *DB) GetEligibilityStates(tenantID, userID string) ([]models.EligibilityState, error) {
+	return db.queryEligibilityStates(`SELECT tenant_id, user_id, offer_id, eligible_since
+		FROM eligibility_state
+		WHERE tenant_id = ?
+		AND user_id = ?
+		ORDER BY offer_id`, tenantID, userID)
+}
+
+// ListEligibilityStates returns up to limit state rows across all tenants,
+// ordered by tenant, user and offer and starting after the row keyed like
+// after. The zero state starts from the first row.
+func (db *DB) ListEligibilityStates(after models.EligibilityState, limit int) ([]models.EligibilityState, error) {
+	return db.queryEligibilityStates(`SELECT tenant_id, user_id, offer_id, eligible_since
+		FROM eligibility_state
+		WHERE (tenant_id, user_id, offer_id) > (?, ?, ?)
+		ORDER BY tenant_id, user_id, offer_id
+		LIMIT ?`, after.TenantID, after.UserID, after.OfferID, limit)
+}
+
+// ApplyEligibilityChanges inserts or deletes state rows and, for each row that
+// actually changed, writes the change's outbox events in the same transaction.
+// Concurrent callers observing the same change therefore announce it once. It
+// returns the number of rows changed.
+func (db *DB) ApplyEligibilityChanges(changes []models.EligibilityChange) (int, error) {
+	if len(changes) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	insertStmt, err := tx.Prepare(db.rebind(`INSERT INTO eligibility_state (tenant_id, user_id, offer_id, eligible_since)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(tenant_id, user_id, offer_id) DO NOTHING`))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer insertStmt.Close()
+
+	deleteStmt, err := tx.Prepare(db.rebind(`DELETE FROM eligibility_state
+		WHERE tenant_id = ?
+		AND user_id = ?
+		AND offer_id = ?`))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer deleteStmt.Close()
+
+	changed := 0
+	for _, change := range changes {
+		state := change.State
+
+		var affected int64
+		if change.Eligible {
+			result, err := insertStmt.Exec(state.TenantID, state.UserID, state.OfferID,
+				state.EligibleSince.UTC().Format(time.RFC3339))
+			if err != nil {
+				return 0, fmt.Errorf("failed to record eligibility: %w", err)
+			}
+			affected, err = result.RowsAffected()
+			if err != nil {
+				return 0, fmt.Errorf("failed to record eligibility: %w", err)
+			}
+		} else {
+			result, err := deleteStmt.Exec(state.TenantID, state.UserID, state.OfferID)
+			if err != nil {
+				return 0, fmt.Errorf("failed to clear eligibility: %w", err)
+			}
+			affected, err = result.RowsAffected()
+			if err != nil {
+				return 0, fmt.Errorf("failed to clear eligibility: %w", err)
+			}
+		}
+
+		if affected == 0 {
+			continue
+		}
+		changed++
+
+		if err := db.insertOutbox(tx, change.Outbox); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return changed, nil
+}
+
+func (db *DB) queryEligibilityStates(query string, args ...interface{}) ([]models.EligibilityState, error) {
+	rows, err := db.conn.Query(db.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query eligibility state: %w", err)
+	}
+	defer rows.Close()
+
+	var states []models.EligibilityState
+	for rows.Next() {
+		var state models.EligibilityState
+		var eligibleSinceStr string
+		if err := rows.Scan(&state.TenantID, &state.UserID, &state.OfferID, &eligibleSinceStr); err != nil {
+			return nil, fmt.Errorf("failed to scan eligibility state: %w", err)
+		}
+		state.EligibleSince, err = time.Parse(time.RFC3339, eligibleSinceStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse eligible_since: %w", err)
+		}
+		states = append(states, state)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating eligibility state: %w", err)
+	}
+
+	return states, nil
+}
+
+func (db *DB) RecordEligibilityCheck(check models.EligibilityCheck) error {
+	offers, err := json.Marshal(check.Offers)
+	if err != nil {
+		return fmt.Errorf("failed to record eligibility check: %w", err)
+	}
+
+	_, err = db.conn.Exec(db.rebind(`INSERT INTO eligibility_checks (id, tenant_id, user_id, evaluated_at, checked_at, offers)
+		VALUES (?, ?, ?, ?, ?, ?)`),
+		check.ID,
+		check.TenantID,
+		check.UserID,
+		check.EvaluatedAt.UTC().Format(time.RFC3339),
+		check.CheckedAt.UTC().Format(time.RFC3339),
+		string(offers),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record eligibility check: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) ListEligibilityChecks(tenantID, userID string, filter models.EligibilityHistoryFilter) ([]models.EligibilityCheck, error) {
+	query := `SELECT id, tenant_id, user_id, evaluated_at, checked_at, offers
+		FROM eligibility_checks
+		WHERE tenant_id = ?
+		AND user_id = ?`
+	args := []interface{}{tenantID, userID}
+
+	if filter.From != nil {
+		query += ` AND checked_at >= ?`
+		args = append(args, filter.From.UTC().Format(time.RFC3339))
+	}
+	if filter.To != nil {
+		query += ` AND checked_at < ?`
+		args = append(args, filter.To.UTC().Format(time.RFC3339))
+	}
+	if filter.BeforeCheckedAt != nil {
+		before := filter.BeforeCheckedAt.UTC().Format(time.RFC3339)
+		query += ` AND (checked_at < ? OR (checked_at = ? AND id < ?))`
+		args = append(args, before, before, filter.BeforeID)
+	}
+
+	query += ` ORDER BY checked_at DESC, id DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	rows, err := db.conn.Query(db.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query eligibility checks: %w", err)
+	}
+	defer rows.Close()
+
+	var checks []models.EligibilityCheck
+	for rows.Next() {
+		var check models.EligibilityCheck
+		var evaluatedAtStr, checkedAtStr, offers string
+		if err := rows.Scan(&check.ID, &check.TenantID, &check.UserID, &evaluatedAtStr, &checkedAtStr, &offers); err != nil {
+			return nil, fmt.Errorf("failed to scan eligibility check: %w", err)
+		}
+		if check.EvaluatedAt, err = time.Parse(time.RFC3339, evaluatedAtStr); err != nil {
+			return nil, fmt.Errorf("failed to parse evaluated_at: %w", err)
+		}
+		if check.CheckedAt, err = time.Parse(time.RFC3339, checkedAtStr); err != nil {
+			return nil, fmt.Errorf("failed to parse checked_at: %w", err)
+		}
+		if err := json.Unmarshal([]byte(offers), &check.Offers); err != nil {
+			return nil, fmt.Errorf("failed to parse eligibility check offers: %w", err)
+		}
+		checks = append(checks, check)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating eligibility checks: %w", err)
+	}
+
+	return checks, nil
+}
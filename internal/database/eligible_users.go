@@ -0,0 +1,370 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+)
+
+const eligibleUserExportColumns = `id, tenant_id, offer_id, status, evaluated_at, user_count, error, created_at, completed_at`
+
+// eligibleUsersQuery groups the transactions matching the offer's merchant_id
+// or mcc_whitelist in [from, to] by user and keeps the users meeting the
+// offer's thresholds, like rules.DefaultRule. Users must be listed in one of
+// the offer's segments, when it has any, and must not have reached its
+// per-user redemption cap. No one is selected once the stored offer has
+// reached its redemption cap or cannot pay another reward from its budget. It
+// does not apply to offers with a rule tree or targeting rule segments. Only
+// users after afterUserID are selected when it is set.
+//
+// An offer without any threshold is met by every user, matching transactions
+// or not. The users are then the members of its segments, or every user with
+// a transaction in the tenant when it has none, each joined to their matching
+// transactions.
+func eligibleUsersQuery(offer models.Offer, from, to time.Time, afterUserID string) (string, []interface{}) {
+	var b strings.Builder
+	var args []interface{}
+
+	everyone := offer.MinTxnCount <= 0 && offer.MinSpendCents <= 0 && offer.MinTxnAmountCents <= 0
+	if everyone {
+		b.WriteString(`SELECT u.user_id AS user_id, COUNT(t.id), COALESCE(SUM(t.amount_cents), 0), COALESCE(MAX(t.amount_cents), 0)
+		FROM (`)
+		if len(offer.Segments) > 0 {
+			b.WriteString(`SELECT DISTINCT user_id FROM segment_members
+			WHERE tenant_id = ?
+			AND segment_id IN (?` + strings.Repeat(", ?", len(offer.Segments)-1) + `)`)
+			args = append(args, offer.TenantID)
+			for _, id := range offer.Segments {
+				args = append(args, id)
+			}
+		} else {
+			b.WriteString(`SELECT DISTINCT user_id FROM transactions WHERE tenant_id = ?`)
+			args = append(args, offer.TenantID)
+		}
+		b.WriteString(`) u
+		LEFT JOIN transactions t
+		ON t.tenant_id = ?
+		AND t.user_id = u.user_id
+		AND t.approved_at >= ?
+		AND t.approved_at <= ?
+		AND (t.merchant_id = ?`)
+	} else {
+		b.WriteString(`SELECT t.user_id AS user_id, COUNT(t.id), COALESCE(SUM(t.amount_cents), 0), COALESCE(MAX(t.amount_cents), 0)
+		FROM transactions t
+		WHERE t.tenant_id = ?
+		AND t.approved_at >= ?
+		AND t.approved_at <= ?
+		AND (t.merchant_id = ?`)
+	}
+	args = append(args, offer.TenantID, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339), offer.MerchantID)
+
+	if len(offer.MCCWhitelist) > 0 {
+		b.WriteString(` OR t.mcc IN (?` + strings.Repeat(", ?", len(offer.MCCWhitelist)-1) + `)`)
+		for _, mcc := range offer.MCCWhitelist {
+			args = append(args, mcc)
+		}
+	}
+	b.WriteString(`)`)
+
+	userID := "t.user_id"
+	if everyone {
+		userID = "u.user_id"
+	}
+
+	var filters []string
+	var filterArgs []interface{}
+
+	if len(offer.Segments) > 0 && !everyone {
+		filters = append(filters, userID+` IN (
+			SELECT user_id FROM segment_members
+			WHERE tenant_id = ?
+			AND segment_id IN (?`+strings.Repeat(", ?", len(offer.Segments)-1)+`))`)
+		filterArgs = append(filterArgs, offer.TenantID)
+		for _, id := range offer.Segments {
+			filterArgs = append(filterArgs, id)
+		}
+	}
+
+	if offer.MaxRedemptionsPerUser > 0 {
+		filters = append(filters, userID+` NOT IN (
+			SELECT user_id FROM offer_activations
+			WHERE tenant_id = ?
+			AND offer_id = ?
+			AND redemption_count >= ?)`)
+		filterArgs = append(filterArgs, offer.TenantID, offer.ID, offer.MaxRedemptionsPerUser)
+	}
+
+	if offer.MaxRedemptions > 0 || offer.BudgetCents > 0 {
+		filters = append(filters, `NOT EXISTS (
+			SELECT 1 FROM offers
+			WHERE tenant_id = ?
+			AND id = ?
+			AND ((max_redemptions > 0 AND redemption_count >= max_redemptions)
+				OR NOT `+budgetAvailable+`))`)
+		filterArgs = append(filterArgs, offer.TenantID, offer.ID)
+	}
+
+	if afterUserID != "" {
+		filters = append(filters, userID+` > ?`)
+		filterArgs = append(filterArgs, afterUserID)
+	}
+
+	// The transaction conditions are in the join of the everyone query, so
+	// its filters start the WHERE clause.
+	for i, filter := range filters {
+		if i == 0 && everyone {
+			b.WriteString(`
+		WHERE `)
+		} else {
+			b.WriteString(`
+		AND `)
+		}
+		b.WriteString(filter)
+	}
+	args = append(args, filterArgs...)
+
+	b.WriteString(`
+		GROUP BY ` + userID + `
+		HAVING COUNT(t.id) >= ?
+		AND COALESCE(SUM(t.amount_cents), 0) >= ?
+		AND COALESCE(MAX(t.amount_cents), 0) >= ?`)
+	args = append(args, offer.MinTxnCount, offer.MinSpendCents, offer.MinTxnAmountCents)
+
+	return b.String(), args
+}
+
+// ListEligibleUsers returns up to limit users meeting the offer's transaction
+// criteria in [from, to], ordered by user ID and starting after afterUserID.
+func (db *DB) ListEligibleUsers(offer models.Offer, from, to time.Time, afterUserID string, limit int) ([]models.EligibleUser, error) {
+	query, args := eligibleUsersQuery(offer, from, to, afterUserID)
+	query += `
+		ORDER BY user_id
+		LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.conn.Query(db.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query eligible users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.EligibleUser
+	for rows.Next() {
+		var user models.EligibleUser
+		if err := rows.Scan(&user.UserID, &user.TxnCount, &user.TotalSpendCents, &user.MaxTxnCents); err != nil {
+			return nil, fmt.Errorf("failed to scan eligible user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating eligible users: %w", err)
+	}
+
+	return users, nil
+}
+
+// CountEligibleUsers counts the users ListEligibleUsers would return across
+// all pages.
+func (db *DB) CountEligibleUsers(offer models.Offer, from, to time.Time) (int, error) {
+	query, args := eligibleUsersQuery(offer, from, to, "")
+
+	var count int
+	if err := db.conn.QueryRow(db.rebind(`SELECT COUNT(*) FROM (`+query+`) eligible`), args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count eligible users: %w", err)
+	}
+
+	return count, nil
+}
+
+func (db *DB) CreateEligibleUserExport(export models.EligibleUserExport) error {
+	_, err := db.conn.Exec(db.rebind(`INSERT INTO eligible_user_exports (
+		id, tenant_id, offer_id, status, evaluated_at, created_at
+	) VALUES (?, ?, ?, ?, ?, ?)`),
+		export.ID, export.TenantID, export.OfferID, string(export.Status),
+		export.EvaluatedAt.UTC().Format(time.RFC3339), export.CreatedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to create eligible user export: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) GetEligibleUserExport(tenantID, id string) (models.EligibleUserExport, error) {
+	row := db.conn.QueryRow(db.rebind(`SELECT `+eligibleUserExportColumns+`
+		FROM eligible_user_exports
+		WHERE id = ?
+		AND tenant_id = ?`), id, tenantID)
+
+	export, err := scanEligibleUserExport(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.EligibleUserExport{}, fmt.Errorf("export %s: %w", id, ErrNotFound)
+	}
+	return export, err
+}
+
+// ClaimEligibleUserExport marks the oldest pending export as running and
+// returns it. Exports left running since before staleBefore, by a process
+// that stopped mid-export, are claimed again. The second result is false when
+// there is nothing to run.
+func (db *DB) ClaimEligibleUserExport(now, staleBefore time.Time) (models.EligibleUserExport, bool, error) {
+	for {
+		row := db.conn.QueryRow(db.rebind(`SELECT `+eligibleUserExportColumns+`
+			FROM eligible_user_exports
+			WHERE status = ?
+			OR (status = ? AND claimed_at < ?)
+			ORDER BY created_at, id
+			LIMIT 1`),
+			string(models.ExportStatusPending), string(models.ExportStatusRunning), staleBefore.UTC().Format(time.RFC3339))
+
+		export, err := scanEligibleUserExport(row)
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.EligibleUserExport{}, false, nil
+		}
+		if err != nil {
+			return models.EligibleUserExport{}, false, err
+		}
+
+		// Another process may claim the same export first; then look again.
+		result, err := db.conn.Exec(db.rebind(`UPDATE eligible_user_exports
+			SET status = ?, claimed_at = ?
+			WHERE id = ?
+			AND status = ?
+			AND (claimed_at IS NULL OR claimed_at < ?)`),
+			string(models.ExportStatusRunning), now.UTC().Format(time.RFC3339), export.ID,
+			string(export.Status), staleBefore.UTC().Format(time.RFC3339))
+		if err != nil {
+			return models.EligibleUserExport{}, false, fmt.Errorf("failed to claim eligible user export: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return models.EligibleUserExport{}, false, fmt.Errorf("failed to claim eligible user export: %w", err)
+		}
+		if affected == 1 {
+			export.Status = models.ExportStatusRunning
+			return export, true, nil
+		}
+	}
+}
+
+// CompleteEligibleUserExport stores every user meeting the offer's transaction
+// criteria in [from, to] as the export's rows and marks it completed, in one
+// transaction. Rows of an earlier, interrupted run are replaced.
+func (db *DB) CompleteEligibleUserExport(export models.EligibleUserExport, offer models.Offer, from, to, completedAt time.Time) (models.EligibleUserExport, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return models.EligibleUserExport{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(db.rebind(`DELETE FROM eligible_user_export_rows WHERE export_id = ?`), export.ID); err != nil {
+		return models.EligibleUserExport{}, fmt.Errorf("failed to clear eligible user export: %w", err)
+	}
+
+	query, args := eligibleUsersQuery(offer, from, to, "")
+	result, err := tx.Exec(db.rebind(`INSERT INTO eligible_user_export_rows (
+		export_id, user_id, txn_count, total_spend_cents, max_txn_cents
+	) SELECT CAST(? AS TEXT), eligible.* FROM (`+query+`) eligible`), append([]interface{}{export.ID}, args...)...)
+	if err != nil {
+		return models.EligibleUserExport{}, fmt.Errorf("failed to export eligible users: %w", err)
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return models.EligibleUserExport{}, fmt.Errorf("failed to export eligible users: %w", err)
+	}
+
+	completedAtStr := completedAt.UTC().Format(time.RFC3339)
+	if _, err := tx.Exec(db.rebind(`UPDATE eligible_user_exports
+		SET status = ?, user_count = ?, error = NULL, completed_at = ?
+		WHERE id = ?`), string(models.ExportStatusCompleted), inserted, completedAtStr, export.ID); err != nil {
+		return models.EligibleUserExport{}, fmt.Errorf("failed to complete eligible user export: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.EligibleUserExport{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	completed := completedAt.UTC().Truncate(time.Second)
+	export.Status = models.ExportStatusCompleted
+	export.UserCount = int(inserted)
+	export.Error = ""
+	export.CompletedAt = &completed
+	return export, nil
+}
+
+func (db *DB) FailEligibleUserExport(id, message string, failedAt time.Time) error {
+	_, err := db.conn.Exec(db.rebind(`UPDATE eligible_user_exports
+		SET status = ?, error = ?, completed_at = ?
+		WHERE id = ?`), string(models.ExportStatusFailed), message, failedAt.UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return fmt.Errorf("failed to fail eligible user export: %w", err)
+	}
+
+	return nil
+}
+
+// ListEligibleUserExportRows returns up to limit rows of an export, ordered by
+// user ID and starting after afterUserID.
+func (db *DB) ListEligibleUserExportRows(tenantID, exportID, afterUserID string, limit int) ([]models.EligibleUser, error) {
+	rows, err := db.conn.Query(db.rebind(`SELECT r.user_id, r.txn_count, r.total_spend_cents, r.max_txn_cents
+		FROM eligible_user_export_rows r
+		JOIN eligible_user_exports e ON e.id = r.export_id
+		WHERE e.tenant_id = ?
+		AND r.export_id = ?
+		AND r.user_id > ?
+		ORDER BY r.user_id
+		LIMIT ?`), tenantID, exportID, afterUserID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query eligible user export: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.EligibleUser
+	for rows.Next() {
+		var user models.EligibleUser
+		if err := rows.Scan(&user.UserID, &user.TxnCount, &user.TotalSpendCents, &user.MaxTxnCents); err != nil {
+			return nil, fmt.Errorf("failed to scan eligible user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating eligible user export: %w", err)
+	}
+
+	return users, nil
+}
+
+func scanEligibleUserExport(row rowScanner) (models.EligibleUserExport, error) {
+	var export models.EligibleUserExport
+	var status, evaluatedAtStr, createdAtStr string
+	var errorMessage, completedAtStr sql.NullString
+
+	err := row.Scan(&export.ID, &export.TenantID, &export.OfferID, &status, &evaluatedAtStr,
+		&export.UserCount, &errorMessage, &createdAtStr, &completedAtStr)
+	if err != nil {
+		return models.EligibleUserExport{}, fmt.Errorf("failed to scan eligible user export: %w", err)
+	}
+	export.Status = models.ExportStatus(status)
+	export.Error = errorMessage.String
+
+	if export.EvaluatedAt, err = time.Parse(time.RFC3339, evaluatedAtStr); err != nil {
+		return models.EligibleUserExport{}, fmt.Errorf("failed to parse evaluated_at: %w", err)
+	}
+	if export.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr); err != nil {
+		return models.EligibleUserExport{}, fmt.Errorf("failed to parse created_at: %w", err)
+	}
+	if completedAtStr.Valid {
+		completedAt, err := time.Parse(time.RFC3339, completedAtStr.String)
+		if err != nil {
+			return models.EligibleUserExport{}, fmt.Errorf("failed to parse completed_at: %w", err)
+		}
+		export.CompletedAt = &completedAt
+	}
+
+	return export, nil
+}
@@ -0,0 +1,295 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrations returns the embedded migrations ordered by version. Files are
+// named NNNN_name.up.sql and NNNN_name.down.sql; every version needs both.
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(fileName, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(fileName, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("invalid migration file name %q", fileName)
+		}
+
+		base := strings.TrimSuffix(fileName, "."+direction+".sql")
+		versionStr, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name %q", fileName)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", fileName)
+		}
+
+		content, err := fs.ReadFile(migrationFiles, "migrations/"+fileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", fileName, err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %d has conflicting names %q and %q", version, m.Name, name)
+		}
+
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s) needs both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+func (db *DB) MigrateUp() error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		return nil
+	}
+	return db.MigrateTo(migrations[len(migrations)-1].Version)
+}
+
+func (db *DB) MigrateDown(steps int) error {
+	if steps <= 0 {
+		return fmt.Errorf("steps must be positive")
+	}
+
+	applied, err := db.appliedVersions()
+	if err != nil {
+		return err
+	}
+
+	versions := sortedVersions(applied)
+	target := 0
+	if steps < len(versions) {
+		target = versions[len(versions)-steps-1]
+	}
+
+	return db.MigrateTo(target)
+}
+
+// MigrateTo applies or rolls back migrations until exactly the migrations up
+// to and including version are applied. Version 0 rolls back everything.
+func (db *DB) MigrateTo(version int) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	known := make(map[int]Migration, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = m
+	}
+	if _, ok := known[version]; !ok && version != 0 {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	applied, err := db.appliedVersions()
+	if err != nil {
+		return err
+	}
+
+	appliedVersions := sortedVersions(applied)
+	for i := len(appliedVersions) - 1; i >= 0; i-- {
+		v := appliedVersions[i]
+		if v <= version {
+			break
+		}
+		m, ok := known[v]
+		if !ok {
+			return fmt.Errorf("cannot roll back migration %d: not known to this binary", v)
+		}
+		if err := db.runMigration(m, false); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range migrations {
+		if m.Version > version {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := db.runMigration(m, true); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := db.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		statuses = append(statuses, MigrationStatus{
+			Version:   m.Version,
+			Name:      m.Name,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		})
+		delete(applied, m.Version)
+	}
+
+	for _, v := range sortedVersions(applied) {
+		statuses = append(statuses, MigrationStatus{
+			Version:   v,
+			Name:      "(unknown)",
+			Applied:   true,
+			AppliedAt: applied[v],
+		})
+	}
+
+	return statuses, nil
+}
+
+func (db *DB) ensureMigrationsTable() error {
+	_, err := db.conn.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) appliedVersions() (map[int]time.Time, error) {
+	if err := db.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.conn.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAtStr string
+		if err := rows.Scan(&version, &appliedAtStr); err != nil {
+			return nil, fmt.Errorf("failed to scan schema_migrations: %w", err)
+		}
+		appliedAt, err := time.Parse(time.RFC3339, appliedAtStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse applied_at: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// runMigration executes one migration and records it in the same transaction,
+// so a failing migration leaves neither schema changes nor a version behind.
+func (db *DB) runMigration(m Migration, up bool) error {
+	direction, script := "up", m.Up
+	if !up {
+		direction, script = "down", m.Down
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin migration %d: %w", m.Version, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("failed to run migration %d_%s %s: %w", m.Version, m.Name, direction, err)
+	}
+
+	if up {
+		_, err = tx.Exec(db.rebind(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`),
+			m.Version, m.Name, time.Now().UTC().Format(time.RFC3339))
+	} else {
+		_, err = tx.Exec(db.rebind(`DELETE FROM schema_migrations WHERE version = ?`), m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d: %w", m.Version, err)
+	}
+
+	return nil
+}
+
+func sortedVersions(applied map[int]time.Time) []int {
+	versions := make([]int, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	return versions
+}
@@ -0,0 +1,174 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func appliedCount(t *testing.T, db *DB) int {
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("Failed to get migration status: %v", err)
+	}
+
+	count := 0
+	for _, status := range statuses {
+		if status.Applied {
+			count++
+		}
+	}
+	return count
+}
+
+func TestMigrations_Embedded(t *testing.T) {
+	migrations, err := Migrations()
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	if len(migrations) == 0 {
+		t.Fatal("Expected embedded migrations")
+	}
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("Expected migration %d to have version %d, got %d", i, i+1, m.Version)
+		}
+	}
+}
+
+func TestMigrateUpDownRoundTrip(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		migrations, err := Migrations()
+		if err != nil {
+			t.Fatalf("Failed to load migrations: %v", err)
+		}
+
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate up: %v", err)
+		}
+		if got := appliedCount(t, db); got != len(migrations) {
+			t.Fatalf("Expected %d applied migrations, got %d", len(migrations), got)
+		}
+		if !hasColumn(t, db, "offers", "rules") {
+			t.Error("Expected offers.rules after migrating up")
+		}
+
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Expected migrating up twice to be a no-op, got %v", err)
+		}
+
+		if err := db.MigrateDown(1); err != nil {
+			t.Fatalf("Failed to migrate down: %v", err)
+		}
+		if got := appliedCount(t, db); got != len(migrations)-1 {
+			t.Errorf("Expected %d applied migrations, got %d", len(migrations)-1, got)
+		}
+
+		if err := db.MigrateTo(0); err != nil {
+			t.Fatalf("Failed to migrate to 0: %v", err)
+		}
+		if got := appliedCount(t, db); got != 0 {
+			t.Errorf("Expected 0 applied migrations, got %d", got)
+		}
+		if hasColumn(t, db, "offers", "id") {
+			t.Error("Expected offers table to be dropped")
+		}
+
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate up again: %v", err)
+		}
+		if got := appliedCount(t, db); got != len(migrations) {
+			t.Errorf("Expected %d applied migrations, got %d", len(migrations), got)
+		}
+	})
+}
+
+func TestMigrateTo_UnknownVersion(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateTo(9999); err == nil {
+			t.Error("Expected error for unknown version")
+		}
+	})
+}
+
+// Databases created before migrations existed have the baseline tables but no
+// schema_migrations table; migrating them must keep their data.
+func TestMigrateUp_LegacyDatabase(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		migrations, err := Migrations()
+		if err != nil {
+			t.Fatalf("Failed to load migrations: %v", err)
+		}
+
+		if _, err := db.conn.Exec(migrations[0].Up); err != nil {
+			t.Fatalf("Failed to create legacy schema: %v", err)
+		}
+		_, err = db.conn.Exec(`INSERT INTO offers (id, merchant_id, mcc_whitelist, active, min_txn_count, lookback_days, starts_at, ends_at)
+			VALUES ('legacy', 'merchant', '[]', 1, 1, 30, '2025-10-01T00:00:00Z', '2025-10-31T23:59:59Z')`)
+		if err != nil {
+			t.Fatalf("Failed to insert legacy offer: %v", err)
+		}
+
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate legacy database: %v", err)
+		}
+
+		offer, err := db.GetOffer("default", "legacy")
+		if err != nil {
+			t.Fatalf("Failed to read legacy offer: %v", err)
+		}
+		if offer.MinSpendCents != 0 || offer.Rules != nil || offer.TenantID != "default" {
+			t.Errorf("Expected defaults for new columns, got %+v", offer)
+		}
+	})
+}
+
+// Offers live when the scheduler's table is created must not all be announced
+// as started by its first run.
+func TestMigrateUp_SeedsLiveOfferStarts(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateTo(15); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		newOffer := func(startsAt, endsAt time.Time) models.Offer {
+			t.Helper()
+			offer := models.Offer{
+				ID:         uuid.New().String(),
+				TenantID:   testTenant,
+				MerchantID: uuid.New().String(),
+				Active:     true,
+				StartsAt:   startsAt,
+				EndsAt:     endsAt,
+			}
+			if err := db.UpsertOffer(offer, "tester", now); err != nil {
+				t.Fatalf("Failed to upsert offer: %v", err)
+			}
+			return offer
+		}
+		newOffer(now.Add(-time.Hour), now.Add(24*time.Hour))
+		upcoming := newOffer(now.Add(time.Hour), now.Add(24*time.Hour))
+
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate up: %v", err)
+		}
+
+		started, err := db.ListStartedOffers(now.Add(2 * time.Hour))
+		if err != nil || len(started) != 1 || started[0].ID != upcoming.ID {
+			t.Errorf("Expected only the upcoming offer to start, got %+v (%v)", started, err)
+		}
+
+		if err := db.MigrateTo(15); err != nil {
+			t.Fatalf("Failed to migrate down: %v", err)
+		}
+		if started, _ := db.ListStartedOffers(now.Add(2 * time.Hour)); len(started) != 2 {
+			t.Errorf("Expected both offers to start after rolling back, got %+v", started)
+		}
+	})
+}
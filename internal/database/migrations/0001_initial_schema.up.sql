@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS offers (
+	id TEXT PRIMARY KEY,
+	merchant_id TEXT NOT NULL,
+	mcc_whitelist TEXT NOT NULL,
+	active INTEGER NOT NULL,
+	min_txn_count INTEGER NOT NULL,
+	lookback_days INTEGER NOT NULL,
+	starts_at TEXT NOT NULL,
+	ends_at TEXT NOT NULL,
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	merchant_id TEXT NOT NULL,
+	mcc TEXT NOT NULL,
+	amount_cents INTEGER NOT NULL,
+	approved_at TEXT NOT NULL,
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_id ON transactions(user_id);
+CREATE INDEX IF NOT EXISTS idx_merchant_id ON transactions(merchant_id);
+CREATE INDEX IF NOT EXISTS idx_mcc ON transactions(mcc);
+CREATE INDEX IF NOT EXISTS idx_approved_at ON transactions(approved_at);
+CREATE INDEX IF NOT EXISTS idx_user_approved_at ON transactions(user_id, approved_at);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_offers_merchant_id;
+
+ALTER TABLE offers DROP COLUMN rules;
+ALTER TABLE offers DROP COLUMN deleted_at;
+ALTER TABLE offers DROP COLUMN min_txn_amount_cents;
+ALTER TABLE offers DROP COLUMN min_spend_cents;
@@ -0,0 +1,6 @@
+ALTER TABLE offers ADD COLUMN min_spend_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE offers ADD COLUMN min_txn_amount_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE offers ADD COLUMN deleted_at TEXT;
+ALTER TABLE offers ADD COLUMN rules TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_offers_merchant_id ON offers(merchant_id);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	roles TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	revoked_at TEXT
+);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_tenant_user_approved_at;
+DROP INDEX IF EXISTS idx_offers_tenant_id;
+
+ALTER TABLE api_keys DROP COLUMN tenant_id;
+ALTER TABLE transactions DROP COLUMN tenant_id;
+ALTER TABLE offers DROP COLUMN tenant_id;
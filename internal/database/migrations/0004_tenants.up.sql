@@ -0,0 +1,6 @@
+ALTER TABLE offers ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE transactions ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+CREATE INDEX IF NOT EXISTS idx_offers_tenant_id ON offers(tenant_id, merchant_id);
+CREATE INDEX IF NOT EXISTS idx_tenant_user_approved_at ON transactions(tenant_id, user_id, approved_at);
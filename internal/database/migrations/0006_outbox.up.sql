@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS outbox (
+	id TEXT PRIMARY KEY,
+	sequence BIGINT NOT NULL,
+	tenant_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL,
+	next_attempt_at TEXT NOT NULL,
+	delivered_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_pending ON outbox(delivered_at, next_attempt_at, sequence);
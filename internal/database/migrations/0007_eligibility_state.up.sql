@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS eligibility_state (
+	tenant_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	offer_id TEXT NOT NULL,
+	eligible_since TEXT NOT NULL,
+	PRIMARY KEY (tenant_id, user_id, offer_id)
+);
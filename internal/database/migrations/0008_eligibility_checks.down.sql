@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS eligibility_checks;
+
+ALTER TABLE offers DROP COLUMN version;
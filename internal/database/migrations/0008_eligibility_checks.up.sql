@@ -0,0 +1,12 @@
+ALTER TABLE offers ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS eligibility_checks (
+	id TEXT PRIMARY KEY,
+	tenant_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	evaluated_at TEXT NOT NULL,
+	checked_at TEXT NOT NULL,
+	offers TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_eligibility_checks_user ON eligibility_checks(tenant_id, user_id, checked_at);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS offer_revisions (
+	tenant_id TEXT NOT NULL,
+	offer_id TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	offer TEXT NOT NULL,
+	diff TEXT NOT NULL,
+	deleted INTEGER NOT NULL DEFAULT 0,
+	changed_by TEXT NOT NULL,
+	changed_at TEXT NOT NULL,
+	PRIMARY KEY (tenant_id, offer_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_offer_revisions_changed_at ON offer_revisions(tenant_id, changed_at);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS redemptions;
+DROP TABLE IF EXISTS offer_activations;
+
+ALTER TABLE offers DROP COLUMN redemption_count;
+ALTER TABLE offers DROP COLUMN max_redemptions_per_user;
+ALTER TABLE offers DROP COLUMN max_redemptions;
@@ -0,0 +1,22 @@
+ALTER TABLE offers ADD COLUMN max_redemptions INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE offers ADD COLUMN max_redemptions_per_user INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE offers ADD COLUMN redemption_count INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS offer_activations (
+	tenant_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	offer_id TEXT NOT NULL,
+	activated_at TEXT NOT NULL,
+	redemption_count INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (tenant_id, user_id, offer_id)
+);
+
+CREATE TABLE IF NOT EXISTS redemptions (
+	id TEXT PRIMARY KEY,
+	tenant_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	offer_id TEXT NOT NULL,
+	redeemed_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_redemptions_offer ON redemptions(tenant_id, offer_id, redeemed_at);
@@ -0,0 +1,3 @@
+ALTER TABLE offers DROP COLUMN budget_spent_cents;
+ALTER TABLE offers DROP COLUMN reward_cents;
+ALTER TABLE offers DROP COLUMN budget_cents;
@@ -0,0 +1,3 @@
+ALTER TABLE offers ADD COLUMN budget_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE offers ADD COLUMN reward_cents INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE offers ADD COLUMN budget_spent_cents INTEGER NOT NULL DEFAULT 0;
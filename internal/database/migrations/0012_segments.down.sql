@@ -0,0 +1,4 @@
+ALTER TABLE offers DROP COLUMN segments;
+
+DROP TABLE IF EXISTS segment_members;
+DROP TABLE IF EXISTS segments;
@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS segments (
+	id TEXT PRIMARY KEY,
+	tenant_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	type TEXT NOT NULL,
+	rule TEXT,
+	lookback_days INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL,
+	UNIQUE (tenant_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS segment_members (
+	segment_id TEXT NOT NULL REFERENCES segments(id) ON DELETE CASCADE,
+	tenant_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	added_at TEXT NOT NULL,
+	PRIMARY KEY (segment_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_segment_members_user ON segment_members(tenant_id, user_id);
+
+ALTER TABLE offers ADD COLUMN segments TEXT NOT NULL DEFAULT '[]';
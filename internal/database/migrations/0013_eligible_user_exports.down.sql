@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS eligible_user_export_rows;
+DROP TABLE IF EXISTS eligible_user_exports;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS eligible_user_exports (
+	id TEXT PRIMARY KEY,
+	tenant_id TEXT NOT NULL,
+	offer_id TEXT NOT NULL,
+	status TEXT NOT NULL,
+	evaluated_at TEXT NOT NULL,
+	user_count INTEGER NOT NULL DEFAULT 0,
+	error TEXT,
+	created_at TEXT NOT NULL,
+	claimed_at TEXT,
+	completed_at TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_eligible_user_exports_status ON eligible_user_exports(status, created_at);
+
+CREATE TABLE IF NOT EXISTS eligible_user_export_rows (
+	export_id TEXT NOT NULL REFERENCES eligible_user_exports(id) ON DELETE CASCADE,
+	user_id TEXT NOT NULL,
+	txn_count INTEGER NOT NULL,
+	total_spend_cents INTEGER NOT NULL,
+	max_txn_cents INTEGER NOT NULL,
+	PRIMARY KEY (export_id, user_id)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_offers_schedule;
+DROP TABLE IF EXISTS offer_schedule_events;
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS offer_schedule_events (
+	tenant_id TEXT NOT NULL,
+	offer_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	scheduled_at TEXT NOT NULL,
+	fired_at TEXT NOT NULL,
+	PRIMARY KEY (tenant_id, offer_id, event_type, scheduled_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_offers_schedule ON offers(active, starts_at, ends_at);
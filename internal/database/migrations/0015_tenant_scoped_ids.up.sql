@@ -0,0 +1,72 @@
+CREATE TABLE offers_new (
+	tenant_id TEXT NOT NULL DEFAULT 'default',
+	id TEXT NOT NULL,
+	merchant_id TEXT NOT NULL,
+	mcc_whitelist TEXT NOT NULL,
+	active INTEGER NOT NULL,
+	min_txn_count INTEGER NOT NULL,
+	lookback_days INTEGER NOT NULL,
+	starts_at TEXT NOT NULL,
+	ends_at TEXT NOT NULL,
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	min_spend_cents INTEGER NOT NULL DEFAULT 0,
+	min_txn_amount_cents INTEGER NOT NULL DEFAULT 0,
+	deleted_at TEXT,
+	rules TEXT,
+	version INTEGER NOT NULL DEFAULT 1,
+	max_redemptions INTEGER NOT NULL DEFAULT 0,
+	max_redemptions_per_user INTEGER NOT NULL DEFAULT 0,
+	redemption_count INTEGER NOT NULL DEFAULT 0,
+	budget_cents INTEGER NOT NULL DEFAULT 0,
+	reward_cents INTEGER NOT NULL DEFAULT 0,
+	budget_spent_cents INTEGER NOT NULL DEFAULT 0,
+	segments TEXT NOT NULL DEFAULT '[]',
+	PRIMARY KEY (tenant_id, id)
+);
+
+INSERT INTO offers_new (
+	tenant_id, id, merchant_id, mcc_whitelist, active, min_txn_count, lookback_days,
+	starts_at, ends_at, created_at, updated_at, min_spend_cents, min_txn_amount_cents,
+	deleted_at, rules, version, max_redemptions, max_redemptions_per_user,
+	redemption_count, budget_cents, reward_cents, budget_spent_cents, segments
+)
+SELECT
+	tenant_id, id, merchant_id, mcc_whitelist, active, min_txn_count, lookback_days,
+	starts_at, ends_at, created_at, updated_at, min_spend_cents, min_txn_amount_cents,
+	deleted_at, rules, version, max_redemptions, max_redemptions_per_user,
+	redemption_count, budget_cents, reward_cents, budget_spent_cents, segments
+FROM offers;
+
+DROP TABLE offers;
+ALTER TABLE offers_new RENAME TO offers;
+
+CREATE INDEX IF NOT EXISTS idx_offers_merchant_id ON offers(merchant_id);
+CREATE INDEX IF NOT EXISTS idx_offers_tenant_id ON offers(tenant_id, merchant_id);
+CREATE INDEX IF NOT EXISTS idx_offers_schedule ON offers(active, starts_at, ends_at);
+
+CREATE TABLE transactions_new (
+	tenant_id TEXT NOT NULL DEFAULT 'default',
+	id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	merchant_id TEXT NOT NULL,
+	mcc TEXT NOT NULL,
+	amount_cents INTEGER NOT NULL,
+	approved_at TEXT NOT NULL,
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (tenant_id, id)
+);
+
+INSERT INTO transactions_new (tenant_id, id, user_id, merchant_id, mcc, amount_cents, approved_at, created_at)
+SELECT tenant_id, id, user_id, merchant_id, mcc, amount_cents, approved_at, created_at
+FROM transactions;
+
+DROP TABLE transactions;
+ALTER TABLE transactions_new RENAME TO transactions;
+
+CREATE INDEX IF NOT EXISTS idx_user_id ON transactions(user_id);
+CREATE INDEX IF NOT EXISTS idx_merchant_id ON transactions(merchant_id);
+CREATE INDEX IF NOT EXISTS idx_mcc ON transactions(mcc);
+CREATE INDEX IF NOT EXISTS idx_approved_at ON transactions(approved_at);
+CREATE INDEX IF NOT EXISTS idx_user_approved_at ON transactions(user_id, approved_at);
+CREATE INDEX IF NOT EXISTS idx_tenant_user_approved_at ON transactions(tenant_id, user_id, approved_at);
@@ -0,0 +1,4 @@
+-- Also removes starts the scheduler handled in the second 0014 was applied.
+DELETE FROM offer_schedule_events
+WHERE event_type = 'offer.started'
+AND fired_at = (SELECT applied_at FROM schema_migrations WHERE version = 14);
@@ -0,0 +1,12 @@
+-- Offers already live when offer_schedule_events was created started before
+-- the scheduler could announce them. Record their starts as handled, so its
+-- first run does not emit offer.started for each of them.
+INSERT INTO offer_schedule_events (tenant_id, offer_id, event_type, scheduled_at, fired_at)
+SELECT o.tenant_id, o.id, 'offer.started', o.starts_at, m.applied_at
+FROM offers o
+JOIN schema_migrations m ON m.version = 14
+WHERE o.active = 1
+AND o.deleted_at IS NULL
+AND o.starts_at <= m.applied_at
+AND o.ends_at >= m.applied_at
+ON CONFLICT (tenant_id, offer_id, event_type, scheduled_at) DO NOTHING;
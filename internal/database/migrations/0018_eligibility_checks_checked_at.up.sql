@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS idx_eligibility_checks_checked_at ON eligibility_checks(checked_at);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_outbox_delivered_at;
+
+ALTER TABLE outbox DROP COLUMN dead_at;
+ALTER TABLE outbox DROP COLUMN claimed_at;
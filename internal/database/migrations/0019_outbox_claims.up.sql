@@ -0,0 +1,4 @@
+ALTER TABLE outbox ADD COLUMN claimed_at TEXT;
+ALTER TABLE outbox ADD COLUMN dead_at TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_outbox_delivered_at ON outbox(delivered_at);
@@ -0,0 +1,264 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+)
+
+// Fields that are not part of an offer's configuration and never appear in a
+// revision diff.
+var revisionIgnoredFields = map[string]bool{"tenant_id": true, "version": true, "budget_spent_cents": true}
+
+// extraScanner appends extra destinations to every Scan, so scanOffer can be
+// reused for queries that select more than offerColumns.
+type extraScanner struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (s extraScanner) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+// getOfferForRevision loads the offer as stored, including soft-deleted rows.
+// It returns a nil offer when the ID is not stored for the tenant.
+func (db *DB) getOfferForRevision(tx *sql.Tx, tenantID, id string) (*models.Offer, bool, error) {
+	var deletedAt sql.NullString
+	row := tx.QueryRow(db.rebind(`SELECT `+offerColumns+`, deleted_at
+		FROM offers
+		WHERE id = ?
+		AND tenant_id = ?`), id, tenantID)
+
+	offer, err := scanOffer(extraScanner{row: row, extra: []interface{}{&deletedAt}})
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &offer, deletedAt.Valid, nil
+}
+
+// recordOfferRevision snapshots the offer as just written and records its
+// diff against previous, as changed by changedBy at changedAt.
+func (db *DB) recordOfferRevision(tx *sql.Tx, tenantID, id string, previous *models.Offer, previousDeleted bool, changedBy string, changedAt time.Time) error {
+	current, deleted, err := db.getOfferForRevision(tx, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return fmt.Errorf("offer %s: %w", id, ErrNotFound)
+	}
+
+	diff, err := diffOffers(previous, previousDeleted, *current, deleted)
+	if err != nil {
+		return fmt.Errorf("failed to diff offer revision: %w", err)
+	}
+
+	snapshot, err := json.Marshal(current)
+	if err != nil {
+		return fmt.Errorf("failed to encode offer revision: %w", err)
+	}
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		return fmt.Errorf("failed to encode offer revision: %w", err)
+	}
+
+	_, err = tx.Exec(db.rebind(`INSERT INTO offer_revisions (
+		tenant_id, offer_id, version, offer, diff, deleted, changed_by, changed_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`),
+		tenantID, id, current.Version, string(snapshot), string(diffJSON), boolToInt(deleted), changedBy,
+		changedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to record offer revision: %w", err)
+	}
+
+	return nil
+}
+
+// diffOffers compares the JSON form of two offers field by field. A nil
+// previous offer diffs every field against null.
+func diffOffers(previous *models.Offer, previousDeleted bool, current models.Offer, currentDeleted bool) (map[string]models.FieldChange, error) {
+	before := map[string]json.RawMessage{}
+	if previous != nil {
+		if err := remarshal(previous, &before); err != nil {
+			return nil, err
+		}
+	}
+	after := map[string]json.RawMessage{}
+	if err := remarshal(current, &after); err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]models.FieldChange)
+	for field := range after {
+		if !revisionIgnoredFields[field] && string(before[field]) != string(after[field]) {
+			diff[field] = models.FieldChange{From: before[field], To: after[field]}
+		}
+	}
+	for field := range before {
+		if _, ok := after[field]; !ok && !revisionIgnoredFields[field] {
+			diff[field] = models.FieldChange{From: before[field]}
+		}
+	}
+
+	if previous != nil && previousDeleted != currentDeleted {
+		diff["deleted"] = models.FieldChange{
+			From: json.RawMessage(fmt.Sprint(previousDeleted)),
+			To:   json.RawMessage(fmt.Sprint(currentDeleted)),
+		}
+	}
+
+	return diff, nil
+}
+
+func remarshal(v interface{}, out interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// ListOfferRevisions returns every revision of an offer, oldest first. Offers
+// written before revisions were recorded have none.
+func (db *DB) ListOfferRevisions(tenantID, offerID string) ([]models.OfferRevision, error) {
+	rows, err := db.conn.Query(db.rebind(`SELECT offer_id, version, offer, diff, deleted, changed_by, changed_at
+		FROM offer_revisions
+		WHERE tenant_id = ?
+		AND offer_id = ?
+		ORDER BY version`), tenantID, offerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query offer revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []models.OfferRevision
+	for rows.Next() {
+		var revision models.OfferRevision
+		var snapshot, diff, changedAtStr string
+		if err := rows.Scan(&revision.OfferID, &revision.Version, &snapshot, &diff, &revision.Deleted,
+			&revision.ChangedBy, &changedAtStr); err != nil {
+			return nil, fmt.Errorf("failed to scan offer revision: %w", err)
+		}
+		if err := json.Unmarshal([]byte(snapshot), &revision.Offer); err != nil {
+			return nil, fmt.Errorf("failed to parse offer revision: %w", err)
+		}
+		if err := json.Unmarshal([]byte(diff), &revision.Diff); err != nil {
+			return nil, fmt.Errorf("failed to parse offer revision diff: %w", err)
+		}
+		if revision.ChangedAt, err = time.Parse(time.RFC3339, changedAtStr); err != nil {
+			return nil, fmt.Errorf("failed to parse changed_at: %w", err)
+		}
+		revisions = append(revisions, revision)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating offer revisions: %w", err)
+	}
+
+	return revisions, nil
+}
+
+func (db *DB) latestOfferChange(tenantID string) (*time.Time, error) {
+	var latest sql.NullString
+	err := db.conn.QueryRow(db.rebind(`SELECT MAX(changed_at)
+		FROM offer_revisions
+		WHERE tenant_id = ?`), tenantID).Scan(&latest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query latest offer change: %w", err)
+	}
+	if !latest.Valid {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, latest.String)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse changed_at: %w", err)
+	}
+	return &t, nil
+}
+
+// getActiveOffersAt answers GetActiveOffers from the latest revision of each
+// offer changed at or before now, judging its budget by the spend recorded in
+// that revision. Offers whose first revision is later than now did not exist
+// yet and are left out. Offers with no revision at all predate revision
+// tracking, have no earlier configuration to reproduce and are taken as
+// stored.
+func (db *DB) getActiveOffersAt(tenantID string, now time.Time) ([]models.Offer, error) {
+	nowStr := now.UTC().Format(time.RFC3339)
+
+	rows, err := db.conn.Query(db.rebind(`SELECT r.offer, r.deleted
+		FROM offer_revisions r
+		WHERE r.tenant_id = ?
+		AND r.version = (
+			SELECT MAX(r2.version)
+			FROM offer_revisions r2
+			WHERE r2.tenant_id = r.tenant_id
+			AND r2.offer_id = r.offer_id
+			AND r2.changed_at <= ?
+		)`), tenantID, nowStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query offer revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var offers []models.Offer
+	for rows.Next() {
+		var snapshot string
+		var deleted bool
+		if err := rows.Scan(&snapshot, &deleted); err != nil {
+			return nil, fmt.Errorf("failed to scan offer revision: %w", err)
+		}
+
+		var offer models.Offer
+		if err := json.Unmarshal([]byte(snapshot), &offer); err != nil {
+			return nil, fmt.Errorf("failed to parse offer revision: %w", err)
+		}
+		if deleted || !offer.Active || offer.StartsAt.After(now) || offer.EndsAt.Before(now) ||
+			(offer.BudgetCents > 0 && offer.BudgetSpentCents+offer.RewardCents > offer.BudgetCents) {
+			continue
+		}
+		offers = append(offers, offer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating offer revisions: %w", err)
+	}
+
+	currentRows, err := db.conn.Query(db.rebind(`SELECT `+offerColumns+`
+		FROM offers
+		WHERE tenant_id = ?
+		AND active = 1
+		AND deleted_at IS NULL
+		AND starts_at <= ?
+		AND ends_at >= ?
+		AND `+budgetAvailable+`
+		AND NOT EXISTS (
+			SELECT 1 FROM offer_revisions r
+			WHERE r.tenant_id = offers.tenant_id
+			AND r.offer_id = offers.id
+		)`), tenantID, nowStr, nowStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query active offers: %w", err)
+	}
+	defer currentRows.Close()
+
+	current, err := scanOffers(currentRows)
+	if err != nil {
+		return nil, err
+	}
+	offers = append(offers, current...)
+
+	sort.Slice(offers, func(i, j int) bool {
+		return offers[i].ID < offers[j].ID
+	})
+
+	return offers, nil
+}
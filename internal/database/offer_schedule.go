@@ -0,0 +1,215 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+)
+
+const (
+	scheduleEventStarted = "offer.started"
+	scheduleEventEnded   = "offer.ended"
+)
+
+// ListStartedOffers returns the live offers of every tenant whose start has
+// not been recorded with MarkOfferStarted yet.
+func (db *DB) ListStartedOffers(now time.Time) ([]models.Offer, error) {
+	nowStr := now.UTC().Format(time.RFC3339)
+	rows, err := db.conn.Query(db.rebind(`SELECT `+offerColumns+`
+		FROM offers o
+		WHERE active = 1
+		AND deleted_at IS NULL
+		AND starts_at <= ?
+		AND ends_at >= ?
+		AND NOT EXISTS (
+			SELECT 1 FROM offer_schedule_events e
+			WHERE e.tenant_id = o.tenant_id
+			AND e.offer_id = o.id
+			AND e.event_type = ?
+			AND e.scheduled_at = o.starts_at
+		)
+		ORDER BY starts_at, id`), nowStr, nowStr, scheduleEventStarted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query started offers: %w", err)
+	}
+	defer rows.Close()
+
+	return scanOffers(rows)
+}
+
+// ListExpiredOffers returns the offers of every tenant that are still active
+// although their ends_at has passed.
+func (db *DB) ListExpiredOffers(now time.Time) ([]models.Offer, error) {
+	rows, err := db.conn.Query(db.rebind(`SELECT `+offerColumns+`
+		FROM offers
+		WHERE active = 1
+		AND deleted_at IS NULL
+		AND ends_at < ?
+		ORDER BY ends_at, id`), now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired offers: %w", err)
+	}
+	defer rows.Close()
+
+	return scanOffers(rows)
+}
+
+// NextOfferScheduleChange returns the earliest instant after now at which an
+// active offer starts or expires. The second result is false when no active
+// offer has either ahead of it.
+func (db *DB) NextOfferScheduleChange(now time.Time) (time.Time, bool, error) {
+	nowStr := now.UTC().Format(time.RFC3339)
+	var nextStart, nextEnd sql.NullString
+	err := db.conn.QueryRow(db.rebind(`SELECT
+			(SELECT MIN(starts_at) FROM offers WHERE active = 1 AND deleted_at IS NULL AND starts_at > ?),
+			(SELECT MIN(ends_at) FROM offers WHERE active = 1 AND deleted_at IS NULL AND ends_at >= ?)`),
+		nowStr, nowStr).Scan(&nextStart, &nextEnd)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to query offer schedule: %w", err)
+	}
+
+	var next time.Time
+	found := false
+	if nextStart.Valid {
+		if next, err = time.Parse(time.RFC3339, nextStart.String); err != nil {
+			return time.Time{}, false, fmt.Errorf("failed to parse starts_at: %w", err)
+		}
+		found = true
+	}
+	if nextEnd.Valid {
+		endsAt, err := time.Parse(time.RFC3339, nextEnd.String)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("failed to parse ends_at: %w", err)
+		}
+		// Offers are live through ends_at, so they expire a second later.
+		expiresAt := endsAt.Add(time.Second)
+		if !found || expiresAt.Before(next) {
+			next = expiresAt
+		}
+		found = true
+	}
+
+	return next, found, nil
+}
+
+// MarkOfferStarted records that the offer's start at offer.StartsAt was
+// handled and writes the outbox events with it. It returns false, writing
+// nothing, when the start was already recorded or the offer is no longer
+// active with that start.
+func (db *DB) MarkOfferStarted(offer models.Offer, firedAt time.Time, outbox ...models.OutboxEvent) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current int
+	err = tx.QueryRow(db.rebind(`SELECT COUNT(*)
+		FROM offers
+		WHERE id = ?
+		AND tenant_id = ?
+		AND active = 1
+		AND deleted_at IS NULL
+		AND starts_at = ?`), offer.ID, offer.TenantID, offer.StartsAt.Format(time.RFC3339)).Scan(&current)
+	if err != nil {
+		return false, fmt.Errorf("failed to load offer: %w", err)
+	}
+	if current == 0 {
+		return false, nil
+	}
+
+	recorded, err := db.recordScheduleEvent(tx, offer, scheduleEventStarted, offer.StartsAt, firedAt)
+	if err != nil || !recorded {
+		return false, err
+	}
+
+	if err := db.insertOutbox(tx, outbox); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// ExpireOffer deactivates an offer whose ends_at has passed, recording a
+// revision by changedBy at firedAt. The outbox events are written only the first time
+// the offer expires at offer.EndsAt. It returns false, writing nothing, when
+// the offer is no longer active or its ends_at was moved since it was read.
+func (db *DB) ExpireOffer(offer models.Offer, changedBy string, firedAt time.Time, outbox ...models.OutboxEvent) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	previous, _, err := db.getOfferForRevision(tx, offer.TenantID, offer.ID)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := tx.Exec(db.rebind(`UPDATE offers
+		SET active = 0, updated_at = ?, version = version + 1
+		WHERE id = ?
+		AND tenant_id = ?
+		AND active = 1
+		AND deleted_at IS NULL
+		AND ends_at = ?`),
+		firedAt.UTC().Format(time.RFC3339), offer.ID, offer.TenantID, offer.EndsAt.Format(time.RFC3339))
+	if err != nil {
+		return false, fmt.Errorf("failed to expire offer: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to expire offer: %w", err)
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	if err := db.recordOfferRevision(tx, offer.TenantID, offer.ID, previous, false, changedBy, firedAt); err != nil {
+		return false, err
+	}
+
+	recorded, err := db.recordScheduleEvent(tx, offer, scheduleEventEnded, offer.EndsAt, firedAt)
+	if err != nil {
+		return false, err
+	}
+	if recorded {
+		if err := db.insertOutbox(tx, outbox); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// recordScheduleEvent reports whether the event was recorded for the first
+// time. scheduledAt is formatted like the offer column it was read from, so
+// ListStartedOffers can match the two.
+func (db *DB) recordScheduleEvent(tx *sql.Tx, offer models.Offer, eventType string, scheduledAt, firedAt time.Time) (bool, error) {
+	result, err := tx.Exec(db.rebind(`INSERT INTO offer_schedule_events (
+		tenant_id, offer_id, event_type, scheduled_at, fired_at
+	) VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(tenant_id, offer_id, event_type, scheduled_at) DO NOTHING`),
+		offer.TenantID, offer.ID, eventType, scheduledAt.Format(time.RFC3339), firedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, fmt.Errorf("failed to record %s: %w", eventType, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record %s: %w", eventType, err)
+	}
+
+	return affected == 1, nil
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+)
+
+// OutboxFunc builds the outbox events for the transactions an idempotent
+// insert actually inserted. It runs inside the insert's database transaction.
+type OutboxFunc func(inserted []models.Transaction) ([]models.OutboxEvent, error)
+
+func (db *DB) insertOutbox(tx *sql.Tx, events []models.OutboxEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(db.rebind(`INSERT INTO outbox (
+		id, sequence, tenant_id, event_type, payload, created_at, next_attempt_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?)`))
+	if err != nil {
+		return fmt.Errorf("failed to prepare outbox statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, event := range events {
+		createdAt := event.CreatedAt.UTC().Format(time.RFC3339)
+		_, err := stmt.Exec(
+			event.ID,
+			event.CreatedAt.UnixNano(),
+			event.TenantID,
+			event.EventType,
+			string(event.Payload),
+			createdAt,
+			createdAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to write outbox event %s: %w", event.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// GetPendingOutboxEvents returns undelivered events that are due, in the order
+// they were written. Dead events are left out, and so are events claimed since
+// staleBefore, which are being relayed elsewhere.
+func (db *DB) GetPendingOutboxEvents(now, staleBefore time.Time, limit int) ([]models.OutboxEvent, error) {
+	rows, err := db.conn.Query(db.rebind(`SELECT id, tenant_id, event_type, payload, attempts, last_error, created_at, next_attempt_at
+		FROM outbox
+		WHERE delivered_at IS NULL
+		AND dead_at IS NULL
+		AND next_attempt_at <= ?
+		AND (claimed_at IS NULL OR claimed_at < ?)
+		ORDER BY sequence, id
+		LIMIT ?`), now.UTC().Format(time.RFC3339), staleBefore.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.OutboxEvent
+	for rows.Next() {
+		var event models.OutboxEvent
+		var payload, createdAtStr, nextAttemptAtStr string
+		if err := rows.Scan(&event.ID, &event.TenantID, &event.EventType, &payload,
+			&event.Attempts, &event.LastError, &createdAtStr, &nextAttemptAtStr); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %w", err)
+		}
+
+		event.Payload = json.RawMessage(payload)
+		if event.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr); err != nil {
+			return nil, fmt.Errorf("failed to parse created_at: %w", err)
+		}
+		if event.NextAttemptAt, err = time.Parse(time.RFC3339, nextAttemptAtStr); err != nil {
+			return nil, fmt.Errorf("failed to parse next_attempt_at: %w", err)
+		}
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating outbox: %w", err)
+	}
+
+	return events, nil
+}
+
+// ClaimOutboxEvent marks a pending event as being relayed at now, so other
+// relays skip it until it is marked delivered, failed or dead. Claims older
+// than staleBefore, left by a relay that stopped mid-dispatch, are taken over.
+// It returns false when the event is no longer pending or another relay
+// claimed it first.
+func (db *DB) ClaimOutboxEvent(id string, now, staleBefore time.Time) (bool, error) {
+	result, err := db.conn.Exec(db.rebind(`UPDATE outbox
+		SET claimed_at = ?
+		WHERE id = ?
+		AND delivered_at IS NULL
+		AND dead_at IS NULL
+		AND (claimed_at IS NULL OR claimed_at < ?)`),
+		now.UTC().Format(time.RFC3339), id, staleBefore.UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, fmt.Errorf("failed to claim outbox event: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim outbox event: %w", err)
+	}
+
+	return affected == 1, nil
+}
+
+func (db *DB) MarkOutboxEventDelivered(id string, deliveredAt time.Time) error {
+	_, err := db.conn.Exec(db.rebind(`UPDATE outbox
+		SET delivered_at = ?, attempts = attempts + 1, last_error = '', claimed_at = NULL
+		WHERE id = ?`), deliveredAt.UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event delivered: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) MarkOutboxEventFailed(id string, lastError string, nextAttemptAt time.Time) error {
+	_, err := db.conn.Exec(db.rebind(`UPDATE outbox
+		SET attempts = attempts + 1, last_error = ?, next_attempt_at = ?, claimed_at = NULL
+		WHERE id = ?`), lastError, nextAttemptAt.UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event failed: %w", err)
+	}
+	return nil
+}
+
+// MarkOutboxEventDead records the last failed attempt of an event and stops
+// relaying it. Dead events stay in the outbox, with their last error, for an
+// operator to inspect.
+func (db *DB) MarkOutboxEventDead(id string, lastError string, deadAt time.Time) error {
+	_, err := db.conn.Exec(db.rebind(`UPDATE outbox
+		SET attempts = attempts + 1, last_error = ?, dead_at = ?, claimed_at = NULL
+		WHERE id = ?`), lastError, deadAt.UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox event dead: %w", err)
+	}
+	return nil
+}
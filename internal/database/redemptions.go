@@ -0,0 +1,231 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+)
+
+// ActivateOffer records the activation unless the user already activated the
+// offer, in which case the stored activation is returned. The outbox events
+// are written only for a new activation, which the second result reports.
+func (db *DB) ActivateOffer(activation models.OfferActivation, outbox ...models.OutboxEvent) (models.OfferActivation, bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return models.OfferActivation{}, false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(db.rebind(`INSERT INTO offer_activations (
+		tenant_id, user_id, offer_id, activated_at
+	) VALUES (?, ?, ?, ?)
+	ON CONFLICT(tenant_id, user_id, offer_id) DO NOTHING`),
+		activation.TenantID, activation.UserID, activation.OfferID, activation.ActivatedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return models.OfferActivation{}, false, fmt.Errorf("failed to activate offer: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return models.OfferActivation{}, false, fmt.Errorf("failed to activate offer: %w", err)
+	}
+
+	if affected == 0 {
+		var activatedAtStr string
+		err := tx.QueryRow(db.rebind(`SELECT activated_at
+			FROM offer_activations
+			WHERE tenant_id = ?
+			AND user_id = ?
+			AND offer_id = ?`), activation.TenantID, activation.UserID, activation.OfferID).Scan(&activatedAtStr)
+		if err != nil {
+			return models.OfferActivation{}, false, fmt.Errorf("failed to load offer activation: %w", err)
+		}
+		if activation.ActivatedAt, err = time.Parse(time.RFC3339, activatedAtStr); err != nil {
+			return models.OfferActivation{}, false, fmt.Errorf("failed to parse activated_at: %w", err)
+		}
+		return activation, false, nil
+	}
+
+	if err := db.insertOutbox(tx, outbox); err != nil {
+		return models.OfferActivation{}, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.OfferActivation{}, false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	activation.ActivatedAt = activation.ActivatedAt.UTC().Truncate(time.Second)
+	return activation, true, nil
+}
+
+// RedeemOffer records a redemption of an offer the user has activated and
+// pays its reward from the offer's budget. Caps and budget are enforced with
+// conditional counter updates, so concurrent redemptions can never exceed
+// them. An offer that is inactive or outside its schedule at RedeemedAt, a
+// missing activation, a reached cap or an exhausted budget is reported as
+// ErrConflict. budgetExhausted is written to the outbox only when this
+// redemption leaves too little budget for another.
+func (db *DB) RedeemOffer(redemption models.Redemption, budgetExhausted []models.OutboxEvent, outbox ...models.OutboxEvent) (models.Redemption, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return models.Redemption{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var perUserCap int
+	var live bool
+	redeemedAtStr := redemption.RedeemedAt.UTC().Format(time.RFC3339)
+	err = tx.QueryRow(db.rebind(`SELECT max_redemptions_per_user,
+			CASE WHEN active = 1 AND starts_at <= ? AND ends_at >= ? THEN 1 ELSE 0 END
+		FROM offers
+		WHERE id = ?
+		AND tenant_id = ?
+		AND deleted_at IS NULL`), redeemedAtStr, redeemedAtStr, redemption.OfferID, redemption.TenantID).Scan(&perUserCap, &live)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Redemption{}, fmt.Errorf("offer %s: %w", redemption.OfferID, ErrNotFound)
+	}
+	if err != nil {
+		return models.Redemption{}, fmt.Errorf("failed to load offer: %w", err)
+	}
+	if !live {
+		return models.Redemption{}, fmt.Errorf("offer %s is not live: %w", redemption.OfferID, ErrConflict)
+	}
+
+	result, err := tx.Exec(db.rebind(`UPDATE offer_activations
+		SET redemption_count = redemption_count + 1
+		WHERE tenant_id = ?
+		AND user_id = ?
+		AND offer_id = ?
+		AND (? = 0 OR redemption_count < ?)`),
+		redemption.TenantID, redemption.UserID, redemption.OfferID, perUserCap, perUserCap)
+	if err != nil {
+		return models.Redemption{}, fmt.Errorf("failed to redeem offer: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return models.Redemption{}, fmt.Errorf("failed to redeem offer: %w", err)
+	} else if affected == 0 {
+		var exists int
+		err := tx.QueryRow(db.rebind(`SELECT COUNT(*)
+			FROM offer_activations
+			WHERE tenant_id = ?
+			AND user_id = ?
+			AND offer_id = ?`), redemption.TenantID, redemption.UserID, redemption.OfferID).Scan(&exists)
+		if err != nil {
+			return models.Redemption{}, fmt.Errorf("failed to load offer activation: %w", err)
+		}
+		if exists == 0 {
+			return models.Redemption{}, fmt.Errorf("offer %s is not activated for user %s: %w", redemption.OfferID, redemption.UserID, ErrConflict)
+		}
+		return models.Redemption{}, fmt.Errorf("offer %s: per-user redemption cap reached: %w", redemption.OfferID, ErrConflict)
+	}
+
+	result, err = tx.Exec(db.rebind(`UPDATE offers
+		SET redemption_count = redemption_count + 1,
+			budget_spent_cents = budget_spent_cents + reward_cents
+		WHERE id = ?
+		AND tenant_id = ?
+		AND (max_redemptions = 0 OR redemption_count < max_redemptions)
+		AND `+budgetAvailable), redemption.OfferID, redemption.TenantID)
+	if err != nil {
+		return models.Redemption{}, fmt.Errorf("failed to redeem offer: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err != nil {
+		return models.Redemption{}, fmt.Errorf("failed to redeem offer: %w", err)
+	} else if affected == 0 {
+		var budgetLeft int
+		err := tx.QueryRow(db.rebind(`SELECT COUNT(*)
+			FROM offers
+			WHERE id = ?
+			AND tenant_id = ?
+			AND `+budgetAvailable), redemption.OfferID, redemption.TenantID).Scan(&budgetLeft)
+		if err != nil {
+			return models.Redemption{}, fmt.Errorf("failed to load offer budget: %w", err)
+		}
+		if budgetLeft == 0 {
+			return models.Redemption{}, fmt.Errorf("offer %s: budget exhausted: %w", redemption.OfferID, ErrConflict)
+		}
+		return models.Redemption{}, fmt.Errorf("offer %s: redemption cap reached: %w", redemption.OfferID, ErrConflict)
+	}
+
+	_, err = tx.Exec(db.rebind(`INSERT INTO redemptions (
+		id, tenant_id, user_id, offer_id, redeemed_at
+	) VALUES (?, ?, ?, ?, ?)`),
+		redemption.ID, redemption.TenantID, redemption.UserID, redemption.OfferID, redeemedAtStr)
+	if err != nil {
+		return models.Redemption{}, fmt.Errorf("failed to record redemption: %w", err)
+	}
+
+	var budgetCents, budgetSpentCents int64
+	err = tx.QueryRow(db.rebind(`SELECT a.redemption_count, o.redemption_count, o.reward_cents, o.budget_cents, o.budget_spent_cents
+		FROM offer_activations a
+		JOIN offers o ON o.id = a.offer_id AND o.tenant_id = a.tenant_id
+		WHERE a.tenant_id = ?
+		AND a.user_id = ?
+		AND a.offer_id = ?`), redemption.TenantID, redemption.UserID, redemption.OfferID).Scan(
+		&redemption.UserRedemptionCount, &redemption.OfferRedemptionCount, &redemption.RewardCents,
+		&budgetCents, &budgetSpentCents)
+	if err != nil {
+		return models.Redemption{}, fmt.Errorf("failed to load redemption counts: %w", err)
+	}
+	redemption.BudgetExhausted = budgetCents > 0 && budgetSpentCents+redemption.RewardCents > budgetCents
+
+	if redemption.BudgetExhausted {
+		outbox = append(outbox, budgetExhausted...)
+	}
+	if err := db.insertOutbox(tx, outbox); err != nil {
+		return models.Redemption{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Redemption{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	redemption.RedeemedAt = redemption.RedeemedAt.UTC().Truncate(time.Second)
+	return redemption, nil
+}
+
+// GetExhaustedOffers returns the tenant's offers the user can no longer
+// redeem, mapped to the cap that was reached. The global cap wins when both
+// are reached.
+func (db *DB) GetExhaustedOffers(tenantID, userID string) (map[string]models.RuleType, error) {
+	rows, err := db.conn.Query(db.rebind(`SELECT o.id,
+			CASE WHEN o.max_redemptions > 0 AND o.redemption_count >= o.max_redemptions THEN 1 ELSE 0 END
+		FROM offers o
+		LEFT JOIN offer_activations a
+			ON a.tenant_id = o.tenant_id
+			AND a.offer_id = o.id
+			AND a.user_id = ?
+		WHERE o.tenant_id = ?
+		AND o.deleted_at IS NULL
+		AND (
+			(o.max_redemptions > 0 AND o.redemption_count >= o.max_redemptions)
+			OR (o.max_redemptions_per_user > 0 AND a.redemption_count >= o.max_redemptions_per_user)
+		)`), userID, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query exhausted offers: %w", err)
+	}
+	defer rows.Close()
+
+	exhausted := make(map[string]models.RuleType)
+	for rows.Next() {
+		var offerID string
+		var global bool
+		if err := rows.Scan(&offerID, &global); err != nil {
+			return nil, fmt.Errorf("failed to scan exhausted offer: %w", err)
+		}
+		if global {
+			exhausted[offerID] = models.CriterionMaxRedemptions
+		} else {
+			exhausted[offerID] = models.CriterionMaxRedemptionsPerUser
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating exhausted offers: %w", err)
+	}
+
+	return exhausted, nil
+}
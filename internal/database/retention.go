@@ -0,0 +1,76 @@
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// PurgeTransactions deletes up to limit transactions of every tenant approved
+// before cutoff, oldest first, and returns how many it deleted. Each call is a
+// single short statement, so callers purge a large backlog by calling it until
+// it deletes fewer than limit rows.
+func (db *DB) PurgeTransactions(cutoff time.Time, limit int) (int64, error) {
+	result, err := db.conn.Exec(db.rebind(`DELETE FROM transactions
+		WHERE (tenant_id, id) IN (
+			SELECT tenant_id, id FROM transactions
+			WHERE approved_at < ?
+			ORDER BY approved_at
+			LIMIT ?
+		)`), cutoff.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge transactions: %w", err)
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge transactions: %w", err)
+	}
+
+	return purged, nil
+}
+
+// PurgeEligibilityChecks deletes up to limit eligibility checks of every
+// tenant made before cutoff, oldest first, and returns how many it deleted,
+// in batches like PurgeTransactions.
+func (db *DB) PurgeEligibilityChecks(cutoff time.Time, limit int) (int64, error) {
+	result, err := db.conn.Exec(db.rebind(`DELETE FROM eligibility_checks
+		WHERE id IN (
+			SELECT id FROM eligibility_checks
+			WHERE checked_at < ?
+			ORDER BY checked_at
+			LIMIT ?
+		)`), cutoff.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge eligibility checks: %w", err)
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge eligibility checks: %w", err)
+	}
+
+	return purged, nil
+}
+
+// PurgeOutboxEvents deletes up to limit outbox events of every tenant
+// delivered before cutoff, oldest first, and returns how many it deleted, in
+// batches like PurgeTransactions. Pending and dead events are kept.
+func (db *DB) PurgeOutboxEvents(cutoff time.Time, limit int) (int64, error) {
+	result, err := db.conn.Exec(db.rebind(`DELETE FROM outbox
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE delivered_at < ?
+			ORDER BY delivered_at
+			LIMIT ?
+		)`), cutoff.UTC().Format(time.RFC3339), limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge outbox events: %w", err)
+	}
+
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge outbox events: %w", err)
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,372 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+)
+
+const (
+	segmentColumns     = `s.id, s.tenant_id, s.name, s.type, s.rule, s.lookback_days, s.created_at`
+	segmentMemberCount = `(SELECT COUNT(*) FROM segment_members m WHERE m.segment_id = s.id)`
+)
+
+// CreateSegment stores a new segment. A segment with the same name in the
+// tenant is reported as ErrConflict.
+func (db *DB) CreateSegment(segment models.Segment) error {
+	ruleJSON, err := serializeRules(segment.Rule)
+	if err != nil {
+		return fmt.Errorf("failed to create segment: %w", err)
+	}
+
+	result, err := db.conn.Exec(db.rebind(`INSERT INTO segments (
+		id, tenant_id, name, type, rule, lookback_days, created_at
+	) VALUES (?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(tenant_id, name) DO NOTHING`),
+		segment.ID, segment.TenantID, segment.Name, string(segment.Type), ruleJSON, segment.LookbackDays,
+		segment.CreatedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to create segment: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to create segment: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("segment %q already exists: %w", segment.Name, ErrConflict)
+	}
+
+	return nil
+}
+
+func (db *DB) GetSegment(tenantID, id string) (models.Segment, error) {
+	row := db.conn.QueryRow(db.rebind(`SELECT `+segmentColumns+`, `+segmentMemberCount+`
+		FROM segments s
+		WHERE s.id = ?
+		AND s.tenant_id = ?`), id, tenantID)
+
+	var memberCount int
+	segment, err := scanSegment(extraScanner{row: row, extra: []interface{}{&memberCount}})
+	segment.MemberCount = memberCount
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Segment{}, fmt.Errorf("segment %s: %w", id, ErrNotFound)
+	}
+	return segment, err
+}
+
+func (db *DB) ListSegments(tenantID string) ([]models.Segment, error) {
+	rows, err := db.conn.Query(db.rebind(`SELECT `+segmentColumns+`, `+segmentMemberCount+`
+		FROM segments s
+		WHERE s.tenant_id = ?
+		ORDER BY s.name`), tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segments: %w", err)
+	}
+	defer rows.Close()
+
+	var segments []models.Segment
+	for rows.Next() {
+		var memberCount int
+		segment, err := scanSegment(extraScanner{row: rows, extra: []interface{}{&memberCount}})
+		if err != nil {
+			return nil, err
+		}
+		segment.MemberCount = memberCount
+		segments = append(segments, segment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating segments: %w", err)
+	}
+
+	return segments, nil
+}
+
+// GetSegments returns the definitions of the tenant's segments with the given
+// IDs, without member counts. Unknown IDs are skipped.
+func (db *DB) GetSegments(tenantID string, ids []string) ([]models.Segment, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{tenantID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := db.conn.Query(db.rebind(`SELECT `+segmentColumns+`
+		FROM segments s
+		WHERE s.tenant_id = ?
+		AND s.id IN (?`+strings.Repeat(", ?", len(ids)-1)+`)`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segments: %w", err)
+	}
+	defer rows.Close()
+
+	var segments []models.Segment
+	for rows.Next() {
+		segment, err := scanSegment(rows)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating segments: %w", err)
+	}
+
+	return segments, nil
+}
+
+// DeleteSegment removes a segment and its members. A segment still targeted
+// by an offer is reported as ErrConflict.
+func (db *DB) DeleteSegment(tenantID, id string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var referenced int
+	err = tx.QueryRow(db.rebind(`SELECT COUNT(*)
+		FROM offers
+		WHERE tenant_id = ?
+		AND deleted_at IS NULL
+		AND segments LIKE ?`), tenantID, `%"`+id+`"%`).Scan(&referenced)
+	if err != nil {
+		return fmt.Errorf("failed to check segment references: %w", err)
+	}
+	if referenced > 0 {
+		return fmt.Errorf("segment %s is targeted by %d offer(s): %w", id, referenced, ErrConflict)
+	}
+
+	if _, err := tx.Exec(db.rebind(`DELETE FROM segment_members
+		WHERE segment_id = ?
+		AND tenant_id = ?`), id, tenantID); err != nil {
+		return fmt.Errorf("failed to delete segment members: %w", err)
+	}
+
+	result, err := tx.Exec(db.rebind(`DELETE FROM segments
+		WHERE id = ?
+		AND tenant_id = ?`), id, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to delete segment: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete segment: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("segment %s: %w", id, ErrNotFound)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// AddSegmentMembers adds the users to a segment in one transaction and
+// returns how many were not already members.
+func (db *DB) AddSegmentMembers(tenantID, segmentID string, userIDs []string, addedAt time.Time) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := db.requireSegment(tx, tenantID, segmentID); err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(db.rebind(`INSERT INTO segment_members (
+		segment_id, tenant_id, user_id, added_at
+	) VALUES (?, ?, ?, ?)
+	ON CONFLICT(segment_id, user_id) DO NOTHING`))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	added := 0
+	addedAtStr := addedAt.UTC().Format(time.RFC3339)
+	for _, userID := range userIDs {
+		result, err := stmt.Exec(segmentID, tenantID, userID, addedAtStr)
+		if err != nil {
+			return 0, fmt.Errorf("failed to add segment member %s: %w", userID, err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to add segment member %s: %w", userID, err)
+		}
+		added += int(affected)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return added, nil
+}
+
+// RemoveSegmentMembers removes the users from a segment and returns how many
+// were members.
+func (db *DB) RemoveSegmentMembers(tenantID, segmentID string, userIDs []string) (int, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := db.requireSegment(tx, tenantID, segmentID); err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.Prepare(db.rebind(`DELETE FROM segment_members
+		WHERE segment_id = ?
+		AND tenant_id = ?
+		AND user_id = ?`))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	removed := 0
+	for _, userID := range userIDs {
+		result, err := stmt.Exec(segmentID, tenantID, userID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to remove segment member %s: %w", userID, err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("failed to remove segment member %s: %w", userID, err)
+		}
+		removed += int(affected)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return removed, nil
+}
+
+// GetUserSegmentIDs returns the IDs of the tenant's segments that list the
+// user as a member. Rule segments are evaluated by the caller.
+func (db *DB) GetUserSegmentIDs(tenantID, userID string) (map[string]bool, error) {
+	rows, err := db.conn.Query(db.rebind(`SELECT segment_id
+		FROM segment_members
+		WHERE tenant_id = ?
+		AND user_id = ?`), tenantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segment memberships: %w", err)
+	}
+	defer rows.Close()
+
+	segmentIDs := make(map[string]bool)
+	for rows.Next() {
+		var segmentID string
+		if err := rows.Scan(&segmentID); err != nil {
+			return nil, fmt.Errorf("failed to scan segment membership: %w", err)
+		}
+		segmentIDs[segmentID] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating segment memberships: %w", err)
+	}
+
+	return segmentIDs, nil
+}
+
+// GetSegmentMemberIDs returns, for every user listed in any of the segments,
+// the IDs of those segments that list them.
+func (db *DB) GetSegmentMemberIDs(tenantID string, segmentIDs []string) (map[string]map[string]bool, error) {
+	members := make(map[string]map[string]bool)
+	if len(segmentIDs) == 0 {
+		return members, nil
+	}
+
+	args := []interface{}{tenantID}
+	for _, id := range segmentIDs {
+		args = append(args, id)
+	}
+
+	rows, err := db.conn.Query(db.rebind(`SELECT user_id, segment_id
+		FROM segment_members
+		WHERE tenant_id = ?
+		AND segment_id IN (?`+strings.Repeat(", ?", len(segmentIDs)-1)+`)`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query segment members: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, segmentID string
+		if err := rows.Scan(&userID, &segmentID); err != nil {
+			return nil, fmt.Errorf("failed to scan segment member: %w", err)
+		}
+		if members[userID] == nil {
+			members[userID] = make(map[string]bool)
+		}
+		members[userID][segmentID] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating segment members: %w", err)
+	}
+
+	return members, nil
+}
+
+// requireSegment reports ErrNotFound unless the segment exists in the tenant.
+func (db *DB) requireSegment(tx *sql.Tx, tenantID, segmentID string) error {
+	var exists int
+	err := tx.QueryRow(db.rebind(`SELECT COUNT(*)
+		FROM segments
+		WHERE id = ?
+		AND tenant_id = ?`), segmentID, tenantID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to load segment: %w", err)
+	}
+	if exists == 0 {
+		return fmt.Errorf("segment %s: %w", segmentID, ErrNotFound)
+	}
+	return nil
+}
+
+func scanSegment(row rowScanner) (models.Segment, error) {
+	var segment models.Segment
+	var segmentType, createdAtStr string
+	var ruleJSON sql.NullString
+
+	err := row.Scan(&segment.ID, &segment.TenantID, &segment.Name, &segmentType, &ruleJSON,
+		&segment.LookbackDays, &createdAtStr)
+	if err != nil {
+		return models.Segment{}, fmt.Errorf("failed to scan segment: %w", err)
+	}
+	segment.Type = models.SegmentType(segmentType)
+
+	if ruleJSON.Valid && ruleJSON.String != "" {
+		var rule models.Rule
+		if err := json.Unmarshal([]byte(ruleJSON.String), &rule); err != nil {
+			return models.Segment{}, fmt.Errorf("failed to parse segment rule: %w", err)
+		}
+		segment.Rule = &rule
+	}
+
+	if segment.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr); err != nil {
+		return models.Segment{}, fmt.Errorf("failed to parse created_at: %w", err)
+	}
+
+	return segment, nil
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"time"
+
+	"offer-eligibility-api/internal/models"
+)
+
+// Store is the storage the service layer depends on. *DB implements it for
+// both SQLite and PostgreSQL. Every read is scoped to a tenant; writes take
+// the tenant from the offer or transaction and commit any outbox events
+// together with the change.
+type Store interface {
+	UpsertOffer(offer models.Offer, changedBy string, changedAt time.Time, outbox ...models.OutboxEvent) error
+	GetOffer(tenantID, id string) (models.Offer, error)
+	ListOffers(tenantID string, filter models.OfferFilter) ([]models.Offer, error)
+	DeleteOffer(tenantID, id, changedBy string, changedAt time.Time, outbox ...models.OutboxEvent) error
+	ListOfferRevisions(tenantID, offerID string) ([]models.OfferRevision, error)
+	InsertTransactions(transactions []models.Transaction, outbox ...models.OutboxEvent) (int, error)
+	InsertTransactionsIdempotent(transactions []models.Transaction, outbox OutboxFunc) ([]models.IngestStatus, error)
+	GetActiveOffers(tenantID string, now time.Time) ([]models.Offer, error)
+	GetUserTransactions(tenantID, userID string, from, to time.Time) ([]models.Transaction, error)
+	ForEachUserTransactions(tenantID string, from, to time.Time, fn func(userID string, transactions []models.Transaction) error) error
+	PurgeTransactions(cutoff time.Time, limit int) (int64, error)
+	PurgeEligibilityChecks(cutoff time.Time, limit int) (int64, error)
+	PurgeOutboxEvents(cutoff time.Time, limit int) (int64, error)
+	ActivateOffer(activation models.OfferActivation, outbox ...models.OutboxEvent) (models.OfferActivation, bool, error)
+	RedeemOffer(redemption models.Redemption, budgetExhausted []models.OutboxEvent, outbox ...models.OutboxEvent) (models.Redemption, error)
+	GetExhaustedOffers(tenantID, userID string) (map[string]models.RuleType, error)
+	ListStartedOffers(now time.Time) ([]models.Offer, error)
+	ListExpiredOffers(now time.Time) ([]models.Offer, error)
+	NextOfferScheduleChange(now time.Time) (time.Time, bool, error)
+	MarkOfferStarted(offer models.Offer, firedAt time.Time, outbox ...models.OutboxEvent) (bool, error)
+	ExpireOffer(offer models.Offer, changedBy string, firedAt time.Time, outbox ...models.OutboxEvent) (bool, error)
+	CreateSegment(segment models.Segment) error
+	GetSegment(tenantID, id string) (models.Segment, error)
+	ListSegments(tenantID string) ([]models.Segment, error)
+	GetSegments(tenantID string, ids []string) ([]models.Segment, error)
+	DeleteSegment(tenantID, id string) error
+	AddSegmentMembers(tenantID, segmentID string, userIDs []string, addedAt time.Time) (int, error)
+	RemoveSegmentMembers(tenantID, segmentID string, userIDs []string) (int, error)
+	GetUserSegmentIDs(tenantID, userID string) (map[string]bool, error)
+	GetSegmentMemberIDs(tenantID string, segmentIDs []string) (map[string]map[string]bool, error)
+	ListEligibleUsers(offer models.Offer, from, to time.Time, afterUserID string, limit int) ([]models.EligibleUser, error)
+	CountEligibleUsers(offer models.Offer, from, to time.Time) (int, error)
+	CreateEligibleUserExport(export models.EligibleUserExport) error
+	GetEligibleUserExport(tenantID, id string) (models.EligibleUserExport, error)
+	ClaimEligibleUserExport(now, staleBefore time.Time) (models.EligibleUserExport, bool, error)
+	CompleteEligibleUserExport(export models.EligibleUserExport, offer models.Offer, from, to, completedAt time.Time) (models.EligibleUserExport, error)
+	FailEligibleUserExport(id, message string, failedAt time.Time) error
+	ListEligibleUserExportRows(tenantID, exportID, afterUserID string, limit int) ([]models.EligibleUser, error)
+	GetEligibilityStates(tenantID, userID string) ([]models.EligibilityState, error)
+	ListEligibilityStates(after models.EligibilityState, limit int) ([]models.EligibilityState, error)
+	ApplyEligibilityChanges(changes []models.EligibilityChange) (int, error)
+	RecordEligibilityCheck(check models.EligibilityCheck) error
+	ListEligibilityChecks(tenantID, userID string, filter models.EligibilityHistoryFilter) ([]models.EligibilityCheck, error)
+	CreateWebhookEndpoint(endpoint models.WebhookEndpoint) error
+	GetWebhookEndpoint(tenantID, id string) (models.WebhookEndpoint, error)
+	ListWebhookEndpoints(tenantID string) ([]models.WebhookEndpoint, error)
+	DeleteWebhookEndpoint(tenantID, id string) error
+	ListWebhookDeliveries(tenantID, endpointID string, limit int) ([]models.WebhookDelivery, error)
+	ListWebhookDeadLetters(tenantID string, limit int) ([]models.WebhookDeadLetter, error)
+	Close() error
+}
+
+var _ Store = (*DB)(nil)
@@ -0,0 +1,1300 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const testTenant = "tenant-a"
+
+func forEachStore(t *testing.T, fn func(t *testing.T, store Store)) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+		fn(t, db)
+	})
+}
+
+func TestStore_OfferLifecycle(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+		merchantID := uuid.New().String()
+
+		offer := models.Offer{
+			ID:            uuid.New().String(),
+			TenantID:      testTenant,
+			MerchantID:    merchantID,
+			MCCWhitelist:  []string{"5812", "5814"},
+			Active:        true,
+			MinTxnCount:   2,
+			MinSpendCents: 1000,
+			LookbackDays:  30,
+			StartsAt:      time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+			EndsAt:        time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+			Rules:         &models.Rule{Type: models.RuleMinTxnCount, Value: 2},
+		}
+		inactive := offer
+		inactive.ID = uuid.New().String()
+		inactive.Active = false
+		inactive.Rules = nil
+
+		for _, o := range []models.Offer{offer, inactive} {
+			if err := store.UpsertOffer(o, "tester", now); err != nil {
+				t.Fatalf("Failed to upsert offer: %v", err)
+			}
+		}
+
+		got, err := store.GetOffer(testTenant, offer.ID)
+		if err != nil {
+			t.Fatalf("Failed to get offer: %v", err)
+		}
+		if got.MerchantID != merchantID || !got.Active || len(got.MCCWhitelist) != 2 || got.MinSpendCents != 1000 {
+			t.Errorf("Unexpected offer: %+v", got)
+		}
+		if got.Rules == nil || got.Rules.Value != 2 {
+			t.Errorf("Expected rules to round-trip, got %+v", got.Rules)
+		}
+		if got.Version != 1 {
+			t.Errorf("Expected version 1, got %d", got.Version)
+		}
+
+		if err := store.UpsertOffer(offer, "tester", now); err != nil {
+			t.Fatalf("Failed to upsert offer: %v", err)
+		}
+		if got, _ := store.GetOffer(testTenant, offer.ID); got.Version != 2 {
+			t.Errorf("Expected version 2 after update, got %d", got.Version)
+		}
+
+		active, err := store.GetActiveOffers(testTenant, now)
+		if err != nil {
+			t.Fatalf("Failed to get active offers: %v", err)
+		}
+		if len(active) != 1 || active[0].ID != offer.ID {
+			t.Errorf("Expected only %s to be active, got %+v", offer.ID, active)
+		}
+
+		activeFilter := false
+		listed, err := store.ListOffers(testTenant, models.OfferFilter{MerchantID: merchantID, Active: &activeFilter})
+		if err != nil {
+			t.Fatalf("Failed to list offers: %v", err)
+		}
+		if len(listed) != 1 || listed[0].ID != inactive.ID {
+			t.Errorf("Expected only %s to be listed, got %+v", inactive.ID, listed)
+		}
+
+		if err := store.DeleteOffer(testTenant, offer.ID, "tester", now); err != nil {
+			t.Fatalf("Failed to delete offer: %v", err)
+		}
+		if _, err := store.GetOffer(testTenant, offer.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound after delete, got %v", err)
+		}
+		if err := store.DeleteOffer(testTenant, offer.ID, "tester", now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+		}
+	})
+}
+
+func TestStore_Transactions(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+		userID := uuid.New().String()
+		merchantID := uuid.New().String()
+
+		newTxn := func(mcc string, amountCents int64, approvedAt time.Time) models.Transaction {
+			return models.Transaction{
+				ID:          uuid.New().String(),
+				TenantID:    testTenant,
+				UserID:      userID,
+				MerchantID:  uuid.New().String(),
+				MCC:         mcc,
+				AmountCents: amountCents,
+				ApprovedAt:  approvedAt,
+			}
+		}
+
+		txns := []models.Transaction{
+			newTxn("5812", 1200, time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC)),
+			newTxn("5814", 800, time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC)),
+			newTxn("5541", 5000, time.Date(2025, 10, 18, 12, 0, 0, 0, time.UTC)),
+			newTxn("5812", 9900, time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)),
+		}
+
+		inserted, err := store.InsertTransactions(txns)
+		if err != nil {
+			t.Fatalf("Failed to insert transactions: %v", err)
+		}
+		if inserted != len(txns) {
+			t.Errorf("Expected %d inserted, got %d", len(txns), inserted)
+		}
+
+		if _, err := store.InsertTransactions(txns[:1]); err == nil {
+			t.Error("Expected error inserting a duplicate transaction")
+		}
+
+		loaded, err := store.GetUserTransactions(testTenant, userID, now.AddDate(0, 0, -30), now)
+		if err != nil {
+			t.Fatalf("Failed to get user transactions: %v", err)
+		}
+		if len(loaded) != 3 {
+			t.Fatalf("Expected 3 transactions in window, got %d", len(loaded))
+		}
+		for i := 1; i < len(loaded); i++ {
+			if loaded[i].ApprovedAt.Before(loaded[i-1].ApprovedAt) {
+				t.Errorf("Expected transactions ordered by approved_at, got %v", loaded)
+			}
+		}
+
+		offer := models.Offer{
+			TenantID:     testTenant,
+			MerchantID:   merchantID,
+			MCCWhitelist: []string{"5812", "5814"},
+			LookbackDays: 30,
+		}
+		summary, err := store.(*DB).SummarizeMatchingTransactions(userID, offer, now)
+		if err != nil {
+			t.Fatalf("Failed to summarize transactions: %v", err)
+		}
+		if summary.Count != 2 || summary.TotalCents != 2000 || summary.MaxCents != 1200 {
+			t.Errorf("Expected summary {2 2000 1200}, got %+v", summary)
+		}
+	})
+}
+
+func TestStore_InsertTransactionsIdempotent(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		txn := models.Transaction{
+			ID:          uuid.New().String(),
+			TenantID:    testTenant,
+			UserID:      uuid.New().String(),
+			MerchantID:  uuid.New().String(),
+			MCC:         "5812",
+			AmountCents: 1500,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		}
+		conflicting := txn
+		conflicting.MCC = "5814"
+		otherTenant := txn
+		otherTenant.TenantID = "tenant-b"
+		// The same instant with another UTC offset is still a duplicate.
+		offset := txn
+		offset.ApprovedAt = txn.ApprovedAt.In(time.FixedZone("CEST", 2*60*60))
+
+		statuses, err := store.InsertTransactionsIdempotent([]models.Transaction{txn, txn, conflicting, otherTenant, offset}, nil)
+		if err != nil {
+			t.Fatalf("Failed to insert transactions: %v", err)
+		}
+
+		expected := []models.IngestStatus{models.IngestInserted, models.IngestDuplicate, models.IngestConflict, models.IngestInserted, models.IngestDuplicate}
+		if len(statuses) != len(expected) {
+			t.Fatalf("Expected %d statuses, got %d", len(expected), len(statuses))
+		}
+		for i := range expected {
+			if statuses[i] != expected[i] {
+				t.Errorf("Expected status %s at %d, got %s", expected[i], i, statuses[i])
+			}
+		}
+	})
+}
+
+func TestStore_TenantIsolation(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+		userID := uuid.New().String()
+
+		offer := models.Offer{
+			ID:           uuid.New().String(),
+			TenantID:     testTenant,
+			MerchantID:   uuid.New().String(),
+			MCCWhitelist: []string{},
+			Active:       true,
+			MinTxnCount:  1,
+			LookbackDays: 30,
+			StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+			EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+		}
+		if err := store.UpsertOffer(offer, "tester", now); err != nil {
+			t.Fatalf("Failed to upsert offer: %v", err)
+		}
+
+		hijack := offer
+		hijack.TenantID = "tenant-b"
+		hijack.MerchantID = uuid.New().String()
+		if err := store.UpsertOffer(hijack, "tester", now); err != nil {
+			t.Fatalf("Expected another tenant to reuse the offer ID, got %v", err)
+		}
+		if loaded, err := store.GetOffer(testTenant, offer.ID); err != nil || loaded.MerchantID != offer.MerchantID || loaded.Version != 1 {
+			t.Errorf("Expected the original offer to be untouched, got %+v (%v)", loaded, err)
+		}
+		if loaded, err := store.GetOffer("tenant-b", offer.ID); err != nil || loaded.MerchantID != hijack.MerchantID {
+			t.Errorf("Expected tenant-b's own offer, got %+v (%v)", loaded, err)
+		}
+
+		if err := store.DeleteOffer("tenant-b", offer.ID, "tester", now); err != nil {
+			t.Fatalf("Failed to delete tenant-b's offer: %v", err)
+		}
+		if _, err := store.GetOffer(testTenant, offer.ID); err != nil {
+			t.Errorf("Expected deleting tenant-b's offer to keep the original, got %v", err)
+		}
+		active, err := store.GetActiveOffers("tenant-b", now)
+		if err != nil {
+			t.Fatalf("Failed to get active offers: %v", err)
+		}
+		if len(active) != 0 {
+			t.Errorf("Expected no active offers for tenant-b, got %+v", active)
+		}
+
+		txn := models.Transaction{
+			ID:          uuid.New().String(),
+			TenantID:    testTenant,
+			UserID:      userID,
+			MerchantID:  offer.MerchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		}
+		if _, err := store.InsertTransactions([]models.Transaction{txn}); err != nil {
+			t.Fatalf("Failed to insert transactions: %v", err)
+		}
+
+		loaded, err := store.GetUserTransactions("tenant-b", userID, now.AddDate(0, 0, -30), now)
+		if err != nil {
+			t.Fatalf("Failed to get user transactions: %v", err)
+		}
+		if len(loaded) != 0 {
+			t.Errorf("Expected no transactions for tenant-b, got %+v", loaded)
+		}
+
+		summary, err := store.(*DB).SummarizeMatchingTransactions(userID, hijack, now)
+		if err != nil {
+			t.Fatalf("Failed to summarize transactions: %v", err)
+		}
+		if summary.Count != 0 {
+			t.Errorf("Expected no matching transactions for tenant-b, got %+v", summary)
+		}
+	})
+}
+
+func TestDB_APIKeys(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		key := models.APIKey{
+			ID:        uuid.New().String(),
+			TenantID:  testTenant,
+			Name:      "card-processor",
+			Roles:     []string{"transaction-ingestor"},
+			CreatedAt: time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC),
+		}
+		if err := db.CreateAPIKey(key, "hash"); err != nil {
+			t.Fatalf("Failed to create api key: %v", err)
+		}
+
+		got, err := db.GetAPIKeyByHash("hash")
+		if err != nil {
+			t.Fatalf("Failed to get api key: %v", err)
+		}
+		if got.ID != key.ID || got.TenantID != testTenant || len(got.Roles) != 1 || got.Roles[0] != "transaction-ingestor" {
+			t.Errorf("Unexpected api key: %+v", got)
+		}
+
+		if err := db.RevokeAPIKey(key.ID); err != nil {
+			t.Fatalf("Failed to revoke api key: %v", err)
+		}
+		if _, err := db.GetAPIKeyByHash("hash"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected revoked key to be not found, got %v", err)
+		}
+	})
+}
+
+func TestDB_Outbox(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+		offer := models.Offer{
+			ID:           uuid.New().String(),
+			TenantID:     testTenant,
+			MerchantID:   uuid.New().String(),
+			MCCWhitelist: []string{"5812"},
+			Active:       true,
+			MinTxnCount:  1,
+			LookbackDays: 30,
+			StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+			EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+		}
+		created := models.OutboxEvent{
+			ID:        uuid.New().String(),
+			TenantID:  testTenant,
+			EventType: "offer.created",
+			Payload:   []byte(`{"offer_id":"` + offer.ID + `"}`),
+			CreatedAt: now,
+		}
+		if err := db.UpsertOffer(offer, "tester", now, created); err != nil {
+			t.Fatalf("Failed to upsert offer: %v", err)
+		}
+
+		deleted := created
+		deleted.ID = uuid.New().String()
+		deleted.EventType = "offer.deleted"
+		deleted.CreatedAt = now.Add(time.Nanosecond)
+		if err := db.DeleteOffer(testTenant, offer.ID, "tester", now, deleted); err != nil {
+			t.Fatalf("Failed to delete offer: %v", err)
+		}
+
+		// A failed write must not leave its event behind.
+		orphan := created
+		orphan.ID = uuid.New().String()
+		if err := db.DeleteOffer(testTenant, offer.ID, "tester", now, orphan); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Expected ErrNotFound, got %v", err)
+		}
+
+		pending, err := db.GetPendingOutboxEvents(now, now, 10)
+		if err != nil {
+			t.Fatalf("Failed to get pending events: %v", err)
+		}
+		if len(pending) != 2 || pending[0].ID != created.ID || pending[1].ID != deleted.ID {
+			t.Fatalf("Expected created then deleted events, got %+v", pending)
+		}
+		if pending[0].TenantID != testTenant || string(pending[0].Payload) != string(created.Payload) {
+			t.Errorf("Unexpected outbox event: %+v", pending[0])
+		}
+
+		if err := db.MarkOutboxEventDelivered(created.ID, now); err != nil {
+			t.Fatalf("Failed to mark event delivered: %v", err)
+		}
+		if err := db.MarkOutboxEventFailed(deleted.ID, "boom", now.Add(time.Minute)); err != nil {
+			t.Fatalf("Failed to mark event failed: %v", err)
+		}
+
+		if pending, _ = db.GetPendingOutboxEvents(now, now, 10); len(pending) != 0 {
+			t.Errorf("Expected no due events, got %+v", pending)
+		}
+
+		later := now.Add(time.Minute)
+		pending, err = db.GetPendingOutboxEvents(later, later, 10)
+		if err != nil {
+			t.Fatalf("Failed to get pending events: %v", err)
+		}
+		if len(pending) != 1 || pending[0].ID != deleted.ID || pending[0].Attempts != 1 || pending[0].LastError != "boom" {
+			t.Errorf("Expected the failed event to be due for retry, got %+v", pending)
+		}
+
+		// A claimed event is skipped by other relays until its claim is stale.
+		if claimed, err := db.ClaimOutboxEvent(deleted.ID, later, later.Add(-time.Minute)); err != nil || !claimed {
+			t.Fatalf("Expected to claim the event, got %v (%v)", claimed, err)
+		}
+		if claimed, _ := db.ClaimOutboxEvent(deleted.ID, later, later.Add(-time.Minute)); claimed {
+			t.Error("Expected a claimed event not to be claimed again")
+		}
+		if pending, _ = db.GetPendingOutboxEvents(later, later.Add(-time.Minute), 10); len(pending) != 0 {
+			t.Errorf("Expected the claimed event to be skipped, got %+v", pending)
+		}
+		if pending, _ = db.GetPendingOutboxEvents(later, later.Add(time.Second), 10); len(pending) != 1 {
+			t.Errorf("Expected a stale claim to be due again, got %+v", pending)
+		}
+
+		// A dead event is never relayed again.
+		if err := db.MarkOutboxEventDead(deleted.ID, "poison", later); err != nil {
+			t.Fatalf("Failed to mark event dead: %v", err)
+		}
+		muchLater := later.Add(time.Hour)
+		if pending, _ = db.GetPendingOutboxEvents(muchLater, muchLater, 10); len(pending) != 0 {
+			t.Errorf("Expected no pending events after the event died, got %+v", pending)
+		}
+		if claimed, _ := db.ClaimOutboxEvent(deleted.ID, muchLater, muchLater); claimed {
+			t.Error("Expected a dead event not to be claimed")
+		}
+	})
+}
+
+func TestDB_ApplyEligibilityChanges(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+		userID := uuid.New().String()
+		gained := func() models.EligibilityChange {
+			return models.EligibilityChange{
+				State:    models.EligibilityState{TenantID: testTenant, UserID: userID, OfferID: "offer-1", EligibleSince: now},
+				Eligible: true,
+				Outbox: []models.OutboxEvent{{
+					ID:        uuid.New().String(),
+					TenantID:  testTenant,
+					EventType: "eligibility.gained",
+					Payload:   []byte(`{}`),
+					CreatedAt: now,
+				}},
+			}
+		}
+
+		for i, want := range []int{1, 0} {
+			changed, err := db.ApplyEligibilityChanges([]models.EligibilityChange{gained()})
+			if err != nil {
+				t.Fatalf("Failed to apply eligibility changes: %v", err)
+			}
+			if changed != want {
+				t.Errorf("Expected %d changes on call %d, got %d", want, i+1, changed)
+			}
+		}
+
+		states, err := db.GetEligibilityStates(testTenant, userID)
+		if err != nil {
+			t.Fatalf("Failed to get eligibility states: %v", err)
+		}
+		if len(states) != 1 || states[0].OfferID != "offer-1" || !states[0].EligibleSince.Equal(now) {
+			t.Errorf("Unexpected eligibility states: %+v", states)
+		}
+
+		pending, err := db.GetPendingOutboxEvents(now, now, 10)
+		if err != nil {
+			t.Fatalf("Failed to get pending events: %v", err)
+		}
+		if len(pending) != 1 {
+			t.Errorf("Expected the unchanged state to write no event, got %d events", len(pending))
+		}
+
+		lost := gained()
+		lost.Eligible = false
+		lost.Outbox = nil
+		if changed, err := db.ApplyEligibilityChanges([]models.EligibilityChange{lost}); err != nil || changed != 1 {
+			t.Fatalf("Expected 1 change, got %d (%v)", changed, err)
+		}
+		if states, _ := db.ListEligibilityStates(models.EligibilityState{}, 10); len(states) != 0 {
+			t.Errorf("Expected no eligibility states, got %+v", states)
+		}
+	})
+}
+
+func TestDB_ListEligibilityStates(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+		var changes []models.EligibilityChange
+		for _, key := range [][3]string{
+			{"tenant-b", "user-1", "offer-1"},
+			{testTenant, "user-2", "offer-1"},
+			{testTenant, "user-1", "offer-2"},
+			{testTenant, "user-1", "offer-1"},
+			{testTenant, "user-2", "offer-2"},
+		} {
+			changes = append(changes, models.EligibilityChange{
+				State:    models.EligibilityState{TenantID: key[0], UserID: key[1], OfferID: key[2], EligibleSince: now},
+				Eligible: true,
+			})
+		}
+		if _, err := db.ApplyEligibilityChanges(changes); err != nil {
+			t.Fatalf("Failed to apply eligibility changes: %v", err)
+		}
+
+		var got []string
+		var after models.EligibilityState
+		for pages := 0; ; pages++ {
+			states, err := db.ListEligibilityStates(after, 2)
+			if err != nil {
+				t.Fatalf("Failed to list eligibility states: %v", err)
+			}
+			for _, state := range states {
+				got = append(got, state.TenantID+"/"+state.UserID+"/"+state.OfferID)
+			}
+			if len(states) < 2 {
+				if pages != 2 {
+					t.Errorf("Expected 3 pages, got %d", pages+1)
+				}
+				break
+			}
+			after = states[len(states)-1]
+		}
+
+		want := []string{
+			"tenant-a/user-1/offer-1",
+			"tenant-a/user-1/offer-2",
+			"tenant-a/user-2/offer-1",
+			"tenant-a/user-2/offer-2",
+			"tenant-b/user-1/offer-1",
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("Expected states %v, got %v", want, got)
+		}
+	})
+}
+
+func TestDB_OfferRevisions(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		offer := models.Offer{
+			ID:           uuid.New().String(),
+			TenantID:     testTenant,
+			MerchantID:   uuid.New().String(),
+			MCCWhitelist: []string{"5812"},
+			Active:       true,
+			MinTxnCount:  1,
+			LookbackDays: 30,
+			StartsAt:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndsAt:       time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC),
+		}
+		// Each revision is live for a known window.
+		changedAt := []time.Time{
+			time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC),
+		}
+		if err := db.UpsertOffer(offer, "alice", changedAt[0]); err != nil {
+			t.Fatalf("Failed to upsert offer: %v", err)
+		}
+		updated := offer
+		updated.MinTxnCount = 3
+		if err := db.UpsertOffer(updated, "bob", changedAt[1]); err != nil {
+			t.Fatalf("Failed to upsert offer: %v", err)
+		}
+		if err := db.DeleteOffer(testTenant, offer.ID, "carol", changedAt[2]); err != nil {
+			t.Fatalf("Failed to delete offer: %v", err)
+		}
+
+		revisions, err := db.ListOfferRevisions(testTenant, offer.ID)
+		if err != nil {
+			t.Fatalf("Failed to list offer revisions: %v", err)
+		}
+		if len(revisions) != 3 {
+			t.Fatalf("Expected 3 revisions, got %+v", revisions)
+		}
+		for i, want := range []string{"alice", "bob", "carol"} {
+			if revisions[i].Version != i+1 || revisions[i].ChangedBy != want {
+				t.Errorf("Expected revision %d by %s, got %+v", i+1, want, revisions[i])
+			}
+		}
+		if _, ok := revisions[0].Diff["merchant_id"]; !ok {
+			t.Errorf("Expected the first revision to diff every field, got %+v", revisions[0].Diff)
+		}
+		change, ok := revisions[1].Diff["min_txn_count"]
+		if len(revisions[1].Diff) != 1 || !ok || string(change.From) != "1" || string(change.To) != "3" {
+			t.Errorf("Expected only min_txn_count 1 -> 3, got %+v", revisions[1].Diff)
+		}
+		if !revisions[2].Deleted || revisions[2].Diff["deleted"].To == nil || revisions[2].Offer.Active {
+			t.Errorf("Expected a deleted, inactive final revision, got %+v", revisions[2])
+		}
+
+		if revisions, _ := db.ListOfferRevisions("tenant-b", offer.ID); len(revisions) != 0 {
+			t.Errorf("Expected no revisions for another tenant, got %+v", revisions)
+		}
+
+		if !revisions[0].ChangedAt.Equal(changedAt[0]) {
+			t.Errorf("Expected the first revision at %v, got %v", changedAt[0], revisions[0].ChangedAt)
+		}
+
+		for _, tc := range []struct {
+			now         time.Time
+			minTxnCount int
+			found       bool
+		}{
+			{time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC), 0, false},
+			{time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), 1, true},
+			{time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), 3, true},
+			{time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC), 0, false},
+		} {
+			active, err := db.GetActiveOffers(testTenant, tc.now)
+			if err != nil {
+				t.Fatalf("Failed to get active offers: %v", err)
+			}
+			if !tc.found {
+				if len(active) != 0 {
+					t.Errorf("Expected no active offers at %v, got %+v", tc.now, active)
+				}
+				continue
+			}
+			if len(active) != 1 || active[0].MinTxnCount != tc.minTxnCount {
+				t.Errorf("Expected min_txn_count %d at %v, got %+v", tc.minTxnCount, tc.now, active)
+			}
+		}
+	})
+}
+
+func TestDB_ActiveOffersBeforeCreation(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		newOffer := func(createdAt time.Time) models.Offer {
+			t.Helper()
+			offer := models.Offer{
+				ID:           uuid.New().String(),
+				TenantID:     testTenant,
+				MerchantID:   uuid.New().String(),
+				Active:       true,
+				MinTxnCount:  1,
+				LookbackDays: 30,
+				StartsAt:     time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				EndsAt:       time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC),
+			}
+			if err := db.UpsertOffer(offer, "tester", createdAt); err != nil {
+				t.Fatalf("Failed to upsert offer: %v", err)
+			}
+			return offer
+		}
+		early := newOffer(time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC))
+		late := newOffer(time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+
+		// An offer stored before revisions were tracked has no history.
+		legacy := newOffer(time.Date(2025, 8, 1, 0, 0, 0, 0, time.UTC))
+		if _, err := db.conn.Exec(db.rebind(`DELETE FROM offer_revisions WHERE offer_id = ?`), legacy.ID); err != nil {
+			t.Fatalf("Failed to drop revisions: %v", err)
+		}
+
+		for _, tc := range []struct {
+			now  time.Time
+			want []string
+		}{
+			{time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC), []string{legacy.ID}},
+			{time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), []string{early.ID, legacy.ID}},
+			{time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC), []string{early.ID, late.ID, legacy.ID}},
+		} {
+			active, err := db.GetActiveOffers(testTenant, tc.now)
+			if err != nil {
+				t.Fatalf("Failed to get active offers: %v", err)
+			}
+			got := make(map[string]bool)
+			for _, offer := range active {
+				got[offer.ID] = true
+			}
+			if len(active) != len(tc.want) {
+				t.Errorf("Expected %d active offers at %v, got %+v", len(tc.want), tc.now, active)
+			}
+			for _, id := range tc.want {
+				if !got[id] {
+					t.Errorf("Expected offer %s to be active at %v", id, tc.now)
+				}
+			}
+		}
+	})
+}
+
+func TestDB_Redemptions(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+		offer := models.Offer{
+			ID:                    uuid.New().String(),
+			TenantID:              testTenant,
+			MerchantID:            uuid.New().String(),
+			Active:                true,
+			LookbackDays:          30,
+			StartsAt:              time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+			EndsAt:                time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+			MaxRedemptions:        2,
+			MaxRedemptionsPerUser: 1,
+		}
+		if err := db.UpsertOffer(offer, "tester", now); err != nil {
+			t.Fatalf("Failed to upsert offer: %v", err)
+		}
+		if got, _ := db.GetOffer(testTenant, offer.ID); got.MaxRedemptions != 2 || got.MaxRedemptionsPerUser != 1 {
+			t.Errorf("Expected caps to round-trip, got %+v", got)
+		}
+
+		redeem := func(userID string) (models.Redemption, error) {
+			return db.RedeemOffer(models.Redemption{
+				ID:         uuid.New().String(),
+				TenantID:   testTenant,
+				UserID:     userID,
+				OfferID:    offer.ID,
+				RedeemedAt: now,
+			}, nil)
+		}
+
+		users := []string{uuid.New().String(), uuid.New().String(), uuid.New().String()}
+		if _, err := redeem(users[0]); !errors.Is(err, ErrConflict) {
+			t.Errorf("Expected ErrConflict without activation, got %v", err)
+		}
+
+		for _, userID := range users {
+			activation := models.OfferActivation{TenantID: testTenant, UserID: userID, OfferID: offer.ID, ActivatedAt: now}
+			if _, created, err := db.ActivateOffer(activation); err != nil || !created {
+				t.Fatalf("Expected a new activation, got %v (%v)", created, err)
+			}
+		}
+		later := models.OfferActivation{TenantID: testTenant, UserID: users[0], OfferID: offer.ID, ActivatedAt: now.Add(time.Hour)}
+		if got, created, err := db.ActivateOffer(later); err != nil || created || !got.ActivatedAt.Equal(now) {
+			t.Errorf("Expected the original activation, got %+v %v (%v)", got, created, err)
+		}
+
+		redemption, err := redeem(users[0])
+		if err != nil {
+			t.Fatalf("Failed to redeem offer: %v", err)
+		}
+		if redemption.UserRedemptionCount != 1 || redemption.OfferRedemptionCount != 1 {
+			t.Errorf("Unexpected redemption counts: %+v", redemption)
+		}
+		if _, err := redeem(users[0]); !errors.Is(err, ErrConflict) {
+			t.Errorf("Expected ErrConflict beyond the per-user cap, got %v", err)
+		}
+
+		exhausted, err := db.GetExhaustedOffers(testTenant, users[0])
+		if err != nil {
+			t.Fatalf("Failed to get exhausted offers: %v", err)
+		}
+		if exhausted[offer.ID] != models.CriterionMaxRedemptionsPerUser {
+			t.Errorf("Expected the per-user cap to be reached, got %+v", exhausted)
+		}
+		if exhausted, _ := db.GetExhaustedOffers(testTenant, users[1]); len(exhausted) != 0 {
+			t.Errorf("Expected nothing exhausted for another user, got %+v", exhausted)
+		}
+
+		if _, err := redeem(users[1]); err != nil {
+			t.Fatalf("Failed to redeem offer: %v", err)
+		}
+		if _, err := redeem(users[2]); !errors.Is(err, ErrConflict) {
+			t.Errorf("Expected ErrConflict beyond the global cap, got %v", err)
+		}
+		if exhausted, _ := db.GetExhaustedOffers(testTenant, users[2]); exhausted[offer.ID] != models.CriterionMaxRedemptions {
+			t.Errorf("Expected the global cap to be reached, got %+v", exhausted)
+		}
+	})
+}
+
+func TestDB_OfferBudget(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+		offer := models.Offer{
+			ID:           uuid.New().String(),
+			TenantID:     testTenant,
+			MerchantID:   uuid.New().String(),
+			Active:       true,
+			LookbackDays: 30,
+			StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+			EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+			BudgetCents:  250,
+			RewardCents:  100,
+		}
+		if err := db.UpsertOffer(offer, "tester", now); err != nil {
+			t.Fatalf("Failed to upsert offer: %v", err)
+		}
+
+		exhaustedEvent := models.OutboxEvent{
+			ID:        uuid.New().String(),
+			TenantID:  testTenant,
+			EventType: "offer.budget_exhausted",
+			Payload:   []byte(`{}`),
+			CreatedAt: now,
+		}
+		redeem := func() (models.Redemption, error) {
+			userID := uuid.New().String()
+			activation := models.OfferActivation{TenantID: testTenant, UserID: userID, OfferID: offer.ID, ActivatedAt: now}
+			if _, _, err := db.ActivateOffer(activation); err != nil {
+				t.Fatalf("Failed to activate offer: %v", err)
+			}
+			event := exhaustedEvent
+			event.ID = uuid.New().String()
+			return db.RedeemOffer(models.Redemption{
+				ID:         uuid.New().String(),
+				TenantID:   testTenant,
+				UserID:     userID,
+				OfferID:    offer.ID,
+				RedeemedAt: now,
+			}, []models.OutboxEvent{event})
+		}
+
+		for i, wantExhausted := range []bool{false, true} {
+			redemption, err := redeem()
+			if err != nil {
+				t.Fatalf("Failed to redeem offer: %v", err)
+			}
+			if redemption.RewardCents != 100 || redemption.BudgetExhausted != wantExhausted {
+				t.Errorf("Redemption %d: expected reward 100 and exhausted=%v, got %+v", i+1, wantExhausted, redemption)
+			}
+		}
+		if _, err := redeem(); !errors.Is(err, ErrConflict) {
+			t.Errorf("Expected ErrConflict with the budget exhausted, got %v", err)
+		}
+
+		if got, _ := db.GetOffer(testTenant, offer.ID); got.BudgetSpentCents != 200 {
+			t.Errorf("Expected 200 cents spent, got %+v", got)
+		}
+		if active, _ := db.GetActiveOffers(testTenant, now); len(active) != 0 {
+			t.Errorf("Expected the exhausted offer not to be active, got %+v", active)
+		}
+
+		pending, err := db.GetPendingOutboxEvents(now, now, 10)
+		if err != nil {
+			t.Fatalf("Failed to get pending events: %v", err)
+		}
+		if len(pending) != 1 || pending[0].EventType != "offer.budget_exhausted" {
+			t.Errorf("Expected one offer.budget_exhausted event, got %+v", pending)
+		}
+
+		offer.BudgetCents = 300
+		if err := db.UpsertOffer(offer, "tester", now); err != nil {
+			t.Fatalf("Failed to upsert offer: %v", err)
+		}
+		active, err := db.GetActiveOffers(testTenant, now)
+		if err != nil {
+			t.Fatalf("Failed to get active offers: %v", err)
+		}
+		if len(active) != 1 || active[0].BudgetSpentCents != 200 {
+			t.Errorf("Expected a raised budget to keep the spend and reactivate the offer, got %+v", active)
+		}
+	})
+}
+
+func TestDB_Segments(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+		list := models.Segment{ID: uuid.New().String(), TenantID: testTenant, Name: "vip", Type: models.SegmentTypeList, CreatedAt: now}
+		if err := db.CreateSegment(list); err != nil {
+			t.Fatalf("Failed to create segment: %v", err)
+		}
+		duplicate := list
+		duplicate.ID = uuid.New().String()
+		if err := db.CreateSegment(duplicate); !errors.Is(err, ErrConflict) {
+			t.Errorf("Expected ErrConflict for a duplicate name, got %v", err)
+		}
+		duplicate.TenantID = "tenant-b"
+		if err := db.CreateSegment(duplicate); err != nil {
+			t.Errorf("Expected the name to be free in another tenant, got %v", err)
+		}
+
+		rule := models.Segment{
+			ID: uuid.New().String(), TenantID: testTenant, Name: "big-spenders", Type: models.SegmentTypeRule,
+			Rule: &models.Rule{Type: models.RuleMinSpendCents, Value: 10000}, LookbackDays: 90, CreatedAt: now,
+		}
+		if err := db.CreateSegment(rule); err != nil {
+			t.Fatalf("Failed to create segment: %v", err)
+		}
+
+		alice, bob := uuid.New().String(), uuid.New().String()
+		added, err := db.AddSegmentMembers(testTenant, list.ID, []string{alice, bob, alice}, now)
+		if err != nil || added != 2 {
+			t.Fatalf("Expected 2 members added, got %d (%v)", added, err)
+		}
+		if _, err := db.AddSegmentMembers("tenant-b", list.ID, []string{alice}, now); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound from another tenant, got %v", err)
+		}
+
+		got, err := db.GetSegment(testTenant, list.ID)
+		if err != nil || got.MemberCount != 2 || got.Name != "vip" {
+			t.Errorf("Unexpected segment %+v (%v)", got, err)
+		}
+		segments, err := db.ListSegments(testTenant)
+		if err != nil || len(segments) != 2 || segments[0].Name != "big-spenders" || segments[0].Rule == nil || segments[0].Rule.Value != 10000 {
+			t.Errorf("Unexpected segments %+v (%v)", segments, err)
+		}
+		if definitions, err := db.GetSegments(testTenant, []string{rule.ID, duplicate.ID}); err != nil || len(definitions) != 1 {
+			t.Errorf("Expected only the tenant's segment, got %+v (%v)", definitions, err)
+		}
+
+		memberships, err := db.GetUserSegmentIDs(testTenant, alice)
+		if err != nil || !memberships[list.ID] || len(memberships) != 1 {
+			t.Errorf("Unexpected memberships %v (%v)", memberships, err)
+		}
+
+		removed, err := db.RemoveSegmentMembers(testTenant, list.ID, []string{alice, uuid.New().String()})
+		if err != nil || removed != 1 {
+			t.Errorf("Expected 1 member removed, got %d (%v)", removed, err)
+		}
+
+		offer := models.Offer{
+			ID:         uuid.New().String(),
+			TenantID:   testTenant,
+			MerchantID: uuid.New().String(),
+			Active:     true,
+			StartsAt:   time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+			EndsAt:     time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+			Segments:   []string{list.ID, rule.ID},
+		}
+		if err := db.UpsertOffer(offer, "tester", now); err != nil {
+			t.Fatalf("Failed to upsert offer: %v", err)
+		}
+		if got, _ := db.GetOffer(testTenant, offer.ID); len(got.Segments) != 2 || got.Segments[0] != list.ID {
+			t.Errorf("Expected segments to round-trip, got %v", got.Segments)
+		}
+
+		if err := db.DeleteSegment(testTenant, list.ID); !errors.Is(err, ErrConflict) {
+			t.Errorf("Expected ErrConflict for a targeted segment, got %v", err)
+		}
+		if err := db.DeleteOffer(testTenant, offer.ID, "tester", now); err != nil {
+			t.Fatalf("Failed to delete offer: %v", err)
+		}
+		if err := db.DeleteSegment(testTenant, list.ID); err != nil {
+			t.Fatalf("Failed to delete segment: %v", err)
+		}
+		if _, err := db.GetSegment(testTenant, list.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound after delete, got %v", err)
+		}
+		if memberships, _ := db.GetUserSegmentIDs(testTenant, bob); len(memberships) != 0 {
+			t.Errorf("Expected members to be deleted with the segment, got %v", memberships)
+		}
+	})
+}
+
+func TestDB_EligibleUsers(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+		offer := models.Offer{
+			ID:                uuid.New().String(),
+			TenantID:          testTenant,
+			MerchantID:        uuid.New().String(),
+			MCCWhitelist:      []string{"5812"},
+			MinTxnCount:       2,
+			MinSpendCents:     2000,
+			MinTxnAmountCents: 1500,
+			LookbackDays:      30,
+		}
+
+		users := []string{"user-a", "user-b", "user-c", "user-d"}
+		newTxn := func(tenantID, userID, merchantID, mcc string, amountCents int64, approvedAt time.Time) models.Transaction {
+			return models.Transaction{
+				ID:          uuid.New().String(),
+				TenantID:    tenantID,
+				UserID:      userID,
+				MerchantID:  merchantID,
+				MCC:         mcc,
+				AmountCents: amountCents,
+				ApprovedAt:  approvedAt,
+			}
+		}
+		recent := now.AddDate(0, 0, -1)
+		txns := []models.Transaction{
+			// Eligible through the merchant and the MCC whitelist.
+			newTxn(testTenant, users[0], offer.MerchantID, "5411", 1500, recent),
+			newTxn(testTenant, users[0], uuid.New().String(), "5812", 1000, recent),
+			// Eligible.
+			newTxn(testTenant, users[1], offer.MerchantID, "5411", 2000, recent),
+			newTxn(testTenant, users[1], offer.MerchantID, "5411", 500, recent),
+			newTxn(testTenant, users[1], offer.MerchantID, "5411", 700, now.AddDate(0, 0, -60)),
+			// No transaction reaches min_txn_amount_cents.
+			newTxn(testTenant, users[2], offer.MerchantID, "5411", 1400, recent),
+			newTxn(testTenant, users[2], offer.MerchantID, "5411", 1400, recent),
+			// Only one transaction in the window, and one at another merchant.
+			newTxn(testTenant, users[3], offer.MerchantID, "5411", 5000, recent),
+			newTxn(testTenant, users[3], uuid.New().String(), "5411", 5000, recent),
+			// Another tenant.
+			newTxn("tenant-b", users[3], offer.MerchantID, "5411", 5000, recent),
+			newTxn("tenant-b", users[3], offer.MerchantID, "5411", 5000, recent),
+		}
+		if _, err := db.InsertTransactions(txns); err != nil {
+			t.Fatalf("Failed to insert transactions: %v", err)
+		}
+
+		from, to := now.AddDate(0, 0, -offer.LookbackDays), now
+		count, err := db.CountEligibleUsers(offer, from, to)
+		if err != nil || count != 2 {
+			t.Fatalf("Expected 2 eligible users, got %d (%v)", count, err)
+		}
+
+		page, err := db.ListEligibleUsers(offer, from, to, "", 1)
+		if err != nil || len(page) != 1 || page[0].UserID != users[0] {
+			t.Fatalf("Unexpected first page %+v (%v)", page, err)
+		}
+		if page[0].TxnCount != 2 || page[0].TotalSpendCents != 2500 || page[0].MaxTxnCents != 1500 {
+			t.Errorf("Unexpected aggregates %+v", page[0])
+		}
+		page, err = db.ListEligibleUsers(offer, from, to, users[0], 10)
+		if err != nil || len(page) != 1 || page[0].UserID != users[1] || page[0].TxnCount != 2 {
+			t.Errorf("Unexpected second page %+v (%v)", page, err)
+		}
+
+		export := models.EligibleUserExport{
+			ID:          uuid.New().String(),
+			TenantID:    testTenant,
+			OfferID:     offer.ID,
+			Status:      models.ExportStatusPending,
+			EvaluatedAt: now,
+			CreatedAt:   now,
+		}
+		if err := db.CreateEligibleUserExport(export); err != nil {
+			t.Fatalf("Failed to create export: %v", err)
+		}
+		if _, err := db.GetEligibleUserExport("tenant-b", export.ID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected ErrNotFound from another tenant, got %v", err)
+		}
+
+		claimed, ok, err := db.ClaimEligibleUserExport(now, now.Add(-time.Hour))
+		if err != nil || !ok || claimed.ID != export.ID || claimed.Status != models.ExportStatusRunning {
+			t.Fatalf("Expected to claim the export, got %+v %v (%v)", claimed, ok, err)
+		}
+		if _, ok, err := db.ClaimEligibleUserExport(now, now.Add(-time.Hour)); err != nil || ok {
+			t.Errorf("Expected a running export not to be claimed again, got %v (%v)", ok, err)
+		}
+		if again, ok, err := db.ClaimEligibleUserExport(now.Add(2*time.Hour), now.Add(time.Hour)); err != nil || !ok || again.ID != export.ID {
+			t.Errorf("Expected a stale export to be claimed again, got %v (%v)", ok, err)
+		}
+
+		completed, err := db.CompleteEligibleUserExport(claimed, offer, from, to, now)
+		if err != nil || completed.UserCount != 2 || completed.Status != models.ExportStatusCompleted {
+			t.Fatalf("Unexpected completed export %+v (%v)", completed, err)
+		}
+		got, err := db.GetEligibleUserExport(testTenant, export.ID)
+		if err != nil || got.Status != models.ExportStatusCompleted || got.UserCount != 2 || got.CompletedAt == nil {
+			t.Errorf("Unexpected stored export %+v (%v)", got, err)
+		}
+
+		rows, err := db.ListEligibleUserExportRows(testTenant, export.ID, "", 1)
+		if err != nil || len(rows) != 1 || rows[0].UserID != users[0] {
+			t.Errorf("Unexpected export rows %+v (%v)", rows, err)
+		}
+		rows, err = db.ListEligibleUserExportRows(testTenant, export.ID, users[0], 10)
+		if err != nil || len(rows) != 1 || rows[0] != page[0] {
+			t.Errorf("Expected the second export row to match the listing, got %+v (%v)", rows, err)
+		}
+		if rows, _ := db.ListEligibleUserExportRows("tenant-b", export.ID, "", 10); len(rows) != 0 {
+			t.Errorf("Expected no rows from another tenant, got %+v", rows)
+		}
+
+		if err := db.FailEligibleUserExport(export.ID, "boom", now); err != nil {
+			t.Fatalf("Failed to fail export: %v", err)
+		}
+		if got, _ := db.GetEligibleUserExport(testTenant, export.ID); got.Status != models.ExportStatusFailed || got.Error != "boom" {
+			t.Errorf("Unexpected failed export %+v", got)
+		}
+	})
+}
+
+func TestDB_OfferSchedule(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+		newOffer := func(startsAt, endsAt time.Time) models.Offer {
+			t.Helper()
+			offer := models.Offer{
+				ID:         uuid.New().String(),
+				TenantID:   testTenant,
+				MerchantID: uuid.New().String(),
+				Active:     true,
+				StartsAt:   startsAt,
+				EndsAt:     endsAt,
+			}
+			if err := db.UpsertOffer(offer, "tester", now); err != nil {
+				t.Fatalf("Failed to upsert offer: %v", err)
+			}
+			return offer
+		}
+		live := newOffer(now.Add(-time.Hour), now.Add(time.Hour))
+		expired := newOffer(now.Add(-2*time.Hour), now.Add(-time.Second))
+		upcoming := newOffer(now.Add(30*time.Minute), now.Add(2*time.Hour))
+
+		next, ok, err := db.NextOfferScheduleChange(now)
+		if err != nil || !ok || !next.Equal(upcoming.StartsAt) {
+			t.Errorf("Expected the upcoming start next, got %v %v (%v)", next, ok, err)
+		}
+
+		started, err := db.ListStartedOffers(now)
+		if err != nil || len(started) != 1 || started[0].ID != live.ID {
+			t.Fatalf("Expected only the live offer to start, got %+v (%v)", started, err)
+		}
+		event := models.OutboxEvent{ID: uuid.New().String(), TenantID: testTenant, EventType: "offer.started", Payload: []byte(`{}`), CreatedAt: now}
+		if ok, err := db.MarkOfferStarted(started[0], now, event); err != nil || !ok {
+			t.Fatalf("Expected the start to be recorded, got %v (%v)", ok, err)
+		}
+		event.ID = uuid.New().String()
+		if ok, err := db.MarkOfferStarted(started[0], now, event); err != nil || ok {
+			t.Errorf("Expected the start to be recorded once, got %v (%v)", ok, err)
+		}
+		if started, _ := db.ListStartedOffers(now); len(started) != 0 {
+			t.Errorf("Expected no offer left to start, got %+v", started)
+		}
+
+		ended, err := db.ListExpiredOffers(now)
+		if err != nil || len(ended) != 1 || ended[0].ID != expired.ID {
+			t.Fatalf("Expected only the expired offer, got %+v (%v)", ended, err)
+		}
+		moved := ended[0]
+		moved.EndsAt = moved.EndsAt.Add(-time.Minute)
+		if ok, err := db.ExpireOffer(moved, "scheduler", now); err != nil || ok {
+			t.Errorf("Expected an offer whose ends_at moved not to expire, got %v (%v)", ok, err)
+		}
+		event = models.OutboxEvent{ID: uuid.New().String(), TenantID: testTenant, EventType: "offer.ended", Payload: []byte(`{}`), CreatedAt: now}
+		if ok, err := db.ExpireOffer(ended[0], "scheduler", now, event); err != nil || !ok {
+			t.Fatalf("Expected the offer to expire, got %v (%v)", ok, err)
+		}
+		if got, _ := db.GetOffer(testTenant, expired.ID); got.Active || got.Version != 2 {
+			t.Errorf("Expected an inactive second version, got %+v", got)
+		}
+		if revisions, _ := db.ListOfferRevisions(testTenant, expired.ID); len(revisions) != 2 || revisions[1].ChangedBy != "scheduler" || !revisions[1].ChangedAt.Equal(now) {
+			t.Errorf("Expected a scheduler revision at %s, got %+v", now, revisions)
+		}
+
+		due := now.Add(time.Hour)
+		pending, err := db.GetPendingOutboxEvents(due, due, 10)
+		if err != nil || len(pending) != 2 {
+			t.Errorf("Expected one started and one ended event, got %+v (%v)", pending, err)
+		}
+	})
+}
+
+func TestDB_PurgeEligibilityChecks(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		cutoff := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		for _, checkedAt := range []time.Time{cutoff.AddDate(0, 0, -2), cutoff.Add(-time.Second), cutoff} {
+			if err := db.RecordEligibilityCheck(models.EligibilityCheck{
+				ID:          uuid.New().String(),
+				TenantID:    testTenant,
+				UserID:      "user-1",
+				EvaluatedAt: checkedAt,
+				CheckedAt:   checkedAt,
+			}); err != nil {
+				t.Fatalf("Failed to record eligibility check: %v", err)
+			}
+		}
+
+		if purged, err := db.PurgeEligibilityChecks(cutoff, 1); err != nil || purged != 1 {
+			t.Fatalf("Expected a full batch of 1, got %d (%v)", purged, err)
+		}
+		if purged, err := db.PurgeEligibilityChecks(cutoff, 10); err != nil || purged != 1 {
+			t.Fatalf("Expected the last old check, got %d (%v)", purged, err)
+		}
+
+		checks, err := db.ListEligibilityChecks(testTenant, "user-1", models.EligibilityHistoryFilter{Limit: 10})
+		if err != nil || len(checks) != 1 || !checks[0].CheckedAt.Equal(cutoff) {
+			t.Errorf("Expected only the check at the cutoff to remain, got %+v (%v)", checks, err)
+		}
+	})
+}
+
+func TestDB_PurgeOutboxEvents(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		cutoff := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		outbox := make([]models.OutboxEvent, 4)
+		for i := range outbox {
+			outbox[i] = models.OutboxEvent{
+				ID:        uuid.New().String(),
+				TenantID:  testTenant,
+				EventType: "offer.created",
+				Payload:   []byte(`{}`),
+				CreatedAt: cutoff.AddDate(0, 0, -10).Add(time.Duration(i) * time.Second),
+			}
+		}
+		offer := models.Offer{
+			ID:           uuid.New().String(),
+			TenantID:     testTenant,
+			MerchantID:   uuid.New().String(),
+			Active:       true,
+			MinTxnCount:  1,
+			LookbackDays: 30,
+			StartsAt:     cutoff,
+			EndsAt:       cutoff.AddDate(0, 1, 0),
+		}
+		if err := db.UpsertOffer(offer, "tester", cutoff, outbox...); err != nil {
+			t.Fatalf("Failed to upsert offer: %v", err)
+		}
+		for i, deliveredAt := range []time.Time{cutoff.AddDate(0, 0, -2), cutoff.Add(-time.Second), cutoff} {
+			if err := db.MarkOutboxEventDelivered(outbox[i].ID, deliveredAt); err != nil {
+				t.Fatalf("Failed to mark event delivered: %v", err)
+			}
+		}
+
+		if purged, err := db.PurgeOutboxEvents(cutoff, 1); err != nil || purged != 1 {
+			t.Fatalf("Expected a full batch of 1, got %d (%v)", purged, err)
+		}
+		if purged, err := db.PurgeOutboxEvents(cutoff, 10); err != nil || purged != 1 {
+			t.Fatalf("Expected the last old delivered event, got %d (%v)", purged, err)
+		}
+		if purged, err := db.PurgeOutboxEvents(cutoff.AddDate(1, 0, 0), 10); err != nil || purged != 1 {
+			t.Fatalf("Expected only the delivered event at the cutoff to remain delivered, got %d (%v)", purged, err)
+		}
+
+		pending, err := db.GetPendingOutboxEvents(cutoff, cutoff, 10)
+		if err != nil || len(pending) != 1 || pending[0].ID != outbox[3].ID {
+			t.Errorf("Expected the undelivered event to be kept, got %+v (%v)", pending, err)
+		}
+	})
+}
+
+func TestDB_PurgeTransactions(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, db *DB) {
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate: %v", err)
+		}
+
+		cutoff := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		var transactions []models.Transaction
+		for i, approvedAt := range []time.Time{
+			cutoff.AddDate(0, 0, -3),
+			cutoff.AddDate(0, 0, -2),
+			cutoff.Add(-time.Second),
+			cutoff,
+			cutoff.AddDate(0, 0, 1),
+		} {
+			tenantID := testTenant
+			if i%2 == 1 {
+				tenantID = "tenant-b"
+			}
+			transactions = append(transactions, models.Transaction{
+				ID:          uuid.New().String(),
+				TenantID:    tenantID,
+				UserID:      "user-1",
+				MerchantID:  "merchant-1",
+				MCC:         "5812",
+				AmountCents: 1000,
+				ApprovedAt:  approvedAt,
+			})
+		}
+		if _, err := db.InsertTransactions(transactions); err != nil {
+			t.Fatalf("Failed to insert transactions: %v", err)
+		}
+
+		if purged, err := db.PurgeTransactions(cutoff, 2); err != nil || purged != 2 {
+			t.Fatalf("Expected a full batch of 2, got %d (%v)", purged, err)
+		}
+		if purged, err := db.PurgeTransactions(cutoff, 2); err != nil || purged != 1 {
+			t.Fatalf("Expected the last old transaction, got %d (%v)", purged, err)
+		}
+		if purged, err := db.PurgeTransactions(cutoff, 2); err != nil || purged != 0 {
+			t.Errorf("Expected nothing left to purge, got %d (%v)", purged, err)
+		}
+
+		for _, tenantID := range []string{testTenant, "tenant-b"} {
+			remaining, err := db.GetUserTransactions(tenantID, "user-1", cutoff.AddDate(-1, 0, 0), cutoff.AddDate(1, 0, 0))
+			if err != nil {
+				t.Fatalf("Failed to get transactions: %v", err)
+			}
+			for _, txn := range remaining {
+				if txn.ApprovedAt.Before(cutoff) {
+					t.Errorf("Expected transactions before the cutoff to be purged, found %+v", txn)
+				}
+			}
+		}
+	})
+}
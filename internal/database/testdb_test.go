@@ -0,0 +1,104 @@
+package database
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// forEachDriver runs fn against an empty, unmigrated database for every
+// available driver: always a temp SQLite file, and a throwaway schema in the
+// PostgreSQL database named by TEST_POSTGRES_DSN when it is set.
+func forEachDriver(t *testing.T, fn func(t *testing.T, db *DB)) {
+	t.Run(DriverSQLite, func(t *testing.T) {
+		fn(t, openSQLiteTestDB(t))
+	})
+
+	t.Run(DriverPostgres, func(t *testing.T) {
+		dsn := os.Getenv("TEST_POSTGRES_DSN")
+		if dsn == "" {
+			t.Skip("TEST_POSTGRES_DSN not set; run make test-postgres")
+		}
+		fn(t, openPostgresTestDB(t, dsn))
+	})
+}
+
+func openSQLiteTestDB(t *testing.T) *DB {
+	tmpDir, err := os.MkdirTemp("", "database_test_*")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	db, err := OpenDB(filepath.Join(tmpDir, "test.db"))
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	return db
+}
+
+func openPostgresTestDB(t *testing.T, dsn string) *DB {
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		t.Fatalf("Failed to generate schema name: %v", err)
+	}
+	schema := "test_" + hex.EncodeToString(suffix)
+
+	admin, err := sql.Open(DriverPostgres, dsn)
+	if err != nil {
+		t.Fatalf("Failed to open postgres: %v", err)
+	}
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.Close()
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+
+	db, err := OpenDBWithOptions(Options{Driver: DriverPostgres, DSN: withSearchPath(dsn, schema)})
+	if err != nil {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.Close()
+	})
+
+	return db
+}
+
+func withSearchPath(dsn, schema string) string {
+	if strings.Contains(dsn, "://") {
+		if strings.Contains(dsn, "?") {
+			return dsn + "&search_path=" + schema
+		}
+		return dsn + "?search_path=" + schema
+	}
+	return dsn + " search_path=" + schema
+}
+
+func hasColumn(t *testing.T, db *DB, table, column string) bool {
+	query := `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`
+	if db.driver == DriverPostgres {
+		query = `SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`
+	}
+
+	var count int
+	if err := db.conn.QueryRow(db.rebind(query), table, column).Scan(&count); err != nil {
+		t.Fatalf("Failed to inspect %s.%s: %v", table, column, err)
+	}
+	return count > 0
+}
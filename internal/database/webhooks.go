@@ -0,0 +1,347 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+)
+
+const webhookDeliveryColumns = `id, endpoint_id, tenant_id, event_type, payload, status, attempts,
+	next_attempt_at, last_status_code, last_error, created_at, updated_at`
+
+func (db *DB) CreateWebhookEndpoint(endpoint models.WebhookEndpoint) error {
+	eventTypes, err := json.Marshal(endpoint.EventTypes)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook endpoint: %w", err)
+	}
+
+	_, err = db.conn.Exec(db.rebind(`INSERT INTO webhook_endpoints (id, tenant_id, url, event_types, secret, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`),
+		endpoint.ID, endpoint.TenantID, endpoint.URL, string(eventTypes), endpoint.Secret,
+		endpoint.CreatedAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook endpoint: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) GetWebhookEndpoint(tenantID, id string) (models.WebhookEndpoint, error) {
+	row := db.conn.QueryRow(db.rebind(`SELECT id, tenant_id, url, event_types, secret, created_at
+		FROM webhook_endpoints
+		WHERE id = ?
+		AND tenant_id = ?`), id, tenantID)
+
+	endpoint, err := scanWebhookEndpoint(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.WebhookEndpoint{}, fmt.Errorf("webhook %s: %w", id, ErrNotFound)
+	}
+	return endpoint, err
+}
+
+func (db *DB) ListWebhookEndpoints(tenantID string) ([]models.WebhookEndpoint, error) {
+	rows, err := db.conn.Query(db.rebind(`SELECT id, tenant_id, url, event_types, secret, created_at
+		FROM webhook_endpoints
+		WHERE tenant_id = ?
+		ORDER BY created_at, id`), tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook endpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var endpoints []models.WebhookEndpoint
+	for rows.Next() {
+		endpoint, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook endpoints: %w", err)
+	}
+
+	return endpoints, nil
+}
+
+// DeleteWebhookEndpoint removes the endpoint together with its delivery log;
+// dead letters are kept.
+func (db *DB) DeleteWebhookEndpoint(tenantID, id string) error {
+	result, err := db.conn.Exec(db.rebind(`DELETE FROM webhook_endpoints
+		WHERE id = ?
+		AND tenant_id = ?`), id, tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook endpoint: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook endpoint: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("webhook %s: %w", id, ErrNotFound)
+	}
+
+	return nil
+}
+
+// EnqueueWebhookDeliveries inserts pending deliveries; deliveries whose ID is
+// already queued are skipped.
+func (db *DB) EnqueueWebhookDeliveries(deliveries []models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(db.rebind(`INSERT INTO webhook_deliveries (` + webhookDeliveryColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO NOTHING`))
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, d := range deliveries {
+		_, err := stmt.Exec(
+			d.ID,
+			d.EndpointID,
+			d.TenantID,
+			d.EventType,
+			string(d.Payload),
+			string(d.Status),
+			d.Attempts,
+			d.NextAttemptAt.UTC().Format(time.RFC3339),
+			d.LastStatusCode,
+			d.LastError,
+			d.CreatedAt.UTC().Format(time.RFC3339),
+			d.UpdatedAt.UTC().Format(time.RFC3339),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to enqueue webhook delivery %s: %w", d.ID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetDueWebhookDeliveries returns pending deliveries whose next attempt is at
+// or before now, oldest first, across all tenants. Deliveries claimed since
+// staleBefore are being attempted elsewhere and are skipped.
+func (db *DB) GetDueWebhookDeliveries(now, staleBefore time.Time, limit int) ([]models.WebhookDelivery, error) {
+	return db.queryWebhookDeliveries(`SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE status = ?
+		AND next_attempt_at <= ?
+		AND (claimed_at IS NULL OR claimed_at < ?)
+		ORDER BY next_attempt_at, id
+		LIMIT ?`, string(models.WebhookDeliveryPending), now.UTC().Format(time.RFC3339),
+		staleBefore.UTC().Format(time.RFC3339), limit)
+}
+
+// ClaimWebhookDelivery marks a due delivery as being attempted at now, so
+// other dispatchers skip it until RecordWebhookAttempt releases it. Claims
+// older than staleBefore, left by a dispatcher that stopped mid-attempt, are
+// taken over. It returns false when the delivery is no longer pending or
+// another dispatcher claimed it first.
+func (db *DB) ClaimWebhookDelivery(id string, now, staleBefore time.Time) (bool, error) {
+	result, err := db.conn.Exec(db.rebind(`UPDATE webhook_deliveries
+		SET claimed_at = ?
+		WHERE id = ?
+		AND status = ?
+		AND (claimed_at IS NULL OR claimed_at < ?)`),
+		now.UTC().Format(time.RFC3339), id, string(models.WebhookDeliveryPending), staleBefore.UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim webhook delivery: %w", err)
+	}
+
+	return affected == 1, nil
+}
+
+func (db *DB) ListWebhookDeliveries(tenantID, endpointID string, limit int) ([]models.WebhookDelivery, error) {
+	return db.queryWebhookDeliveries(`SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE tenant_id = ?
+		AND endpoint_id = ?
+		ORDER BY created_at DESC, id
+		LIMIT ?`, tenantID, endpointID, limit)
+}
+
+// RecordWebhookAttempt stores the outcome of a delivery attempt and releases
+// its claim. A delivery that reaches the dead status is copied to the
+// dead-letter table in the same transaction.
+func (db *DB) RecordWebhookAttempt(d models.WebhookDelivery) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(db.rebind(`UPDATE webhook_deliveries
+		SET status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?, last_error = ?, updated_at = ?,
+			claimed_at = NULL
+		WHERE id = ?`),
+		string(d.Status),
+		d.Attempts,
+		d.NextAttemptAt.UTC().Format(time.RFC3339),
+		d.LastStatusCode,
+		d.LastError,
+		d.UpdatedAt.UTC().Format(time.RFC3339),
+		d.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record webhook attempt: %w", err)
+	}
+
+	if d.Status == models.WebhookDeliveryDead {
+		_, err = tx.Exec(db.rebind(`INSERT INTO webhook_dead_letters (
+			delivery_id, endpoint_id, tenant_id, event_type, payload, attempts, last_error, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(delivery_id) DO NOTHING`),
+			d.ID, d.EndpointID, d.TenantID, d.EventType, string(d.Payload), d.Attempts, d.LastError,
+			d.UpdatedAt.UTC().Format(time.RFC3339))
+		if err != nil {
+			return fmt.Errorf("failed to record dead letter: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (db *DB) ListWebhookDeadLetters(tenantID string, limit int) ([]models.WebhookDeadLetter, error) {
+	rows, err := db.conn.Query(db.rebind(`SELECT delivery_id, endpoint_id, tenant_id, event_type, payload, attempts, last_error, created_at
+		FROM webhook_dead_letters
+		WHERE tenant_id = ?
+		ORDER BY created_at DESC, delivery_id
+		LIMIT ?`), tenantID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []models.WebhookDeadLetter
+	for rows.Next() {
+		var letter models.WebhookDeadLetter
+		var payload, createdAtStr string
+		if err := rows.Scan(&letter.DeliveryID, &letter.EndpointID, &letter.TenantID, &letter.EventType,
+			&payload, &letter.Attempts, &letter.LastError, &createdAtStr); err != nil {
+			return nil, fmt.Errorf("failed to scan dead letter: %w", err)
+		}
+		letter.Payload = json.RawMessage(payload)
+		letter.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse created_at: %w", err)
+		}
+		letters = append(letters, letter)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating dead letters: %w", err)
+	}
+
+	return letters, nil
+}
+
+func (db *DB) queryWebhookDeliveries(query string, args ...interface{}) ([]models.WebhookDelivery, error) {
+	rows, err := db.conn.Query(db.rebind(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+func scanWebhookEndpoint(row rowScanner) (models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+	var eventTypesJSON, createdAtStr string
+
+	if err := row.Scan(&endpoint.ID, &endpoint.TenantID, &endpoint.URL, &eventTypesJSON, &endpoint.Secret, &createdAtStr); err != nil {
+		return models.WebhookEndpoint{}, fmt.Errorf("failed to scan webhook endpoint: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(eventTypesJSON), &endpoint.EventTypes); err != nil {
+		return models.WebhookEndpoint{}, fmt.Errorf("failed to parse webhook event types: %w", err)
+	}
+
+	var err error
+	endpoint.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr)
+	if err != nil {
+		return models.WebhookEndpoint{}, fmt.Errorf("failed to parse created_at: %w", err)
+	}
+
+	return endpoint, nil
+}
+
+func scanWebhookDelivery(row rowScanner) (models.WebhookDelivery, error) {
+	var d models.WebhookDelivery
+	var payload, status, nextAttemptAtStr, createdAtStr, updatedAtStr string
+
+	err := row.Scan(
+		&d.ID,
+		&d.EndpointID,
+		&d.TenantID,
+		&d.EventType,
+		&payload,
+		&status,
+		&d.Attempts,
+		&nextAttemptAtStr,
+		&d.LastStatusCode,
+		&d.LastError,
+		&createdAtStr,
+		&updatedAtStr,
+	)
+	if err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("failed to scan webhook delivery: %w", err)
+	}
+
+	d.Payload = json.RawMessage(payload)
+	d.Status = models.WebhookDeliveryStatus(status)
+
+	if d.NextAttemptAt, err = time.Parse(time.RFC3339, nextAttemptAtStr); err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("failed to parse next_attempt_at: %w", err)
+	}
+	if d.CreatedAt, err = time.Parse(time.RFC3339, createdAtStr); err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("failed to parse created_at: %w", err)
+	}
+	if d.UpdatedAt, err = time.Parse(time.RFC3339, updatedAtStr); err != nil {
+		return models.WebhookDelivery{}, fmt.Errorf("failed to parse updated_at: %w", err)
+	}
+
+	return d, nil
+}
@@ -2,6 +2,10 @@ package events
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"sync"
 	"time"
 
@@ -11,30 +15,124 @@ import (
 type EventType string
 
 const (
-	EventOfferCreated       EventType = "offer.created"
-	EventTransactionCreated EventType = "transaction.created"
-	EventEligibilityChecked EventType = "eligibility.checked"
+	EventOfferCreated         EventType = "offer.created"
+	EventOfferUpdated         EventType = "offer.updated"
+	EventOfferDeleted         EventType = "offer.deleted"
+	EventOfferActivated       EventType = "offer.activated"
+	EventOfferRedeemed        EventType = "offer.redeemed"
+	EventOfferBudgetExhausted EventType = "offer.budget_exhausted"
+	EventOfferStarted         EventType = "offer.started"
+	EventOfferEnded           EventType = "offer.ended"
+	EventTransactionCreated   EventType = "transaction.created"
+	EventEligibilityChecked   EventType = "eligibility.checked"
+	EventEligibilityGained    EventType = "eligibility.gained"
+	EventEligibilityLost      EventType = "eligibility.lost"
 )
 
+var eventTypes = []EventType{
+	EventOfferCreated,
+	EventOfferUpdated,
+	EventOfferDeleted,
+	EventOfferActivated,
+	EventOfferRedeemed,
+	EventOfferBudgetExhausted,
+	EventOfferStarted,
+	EventOfferEnded,
+	EventTransactionCreated,
+	EventEligibilityChecked,
+	EventEligibilityGained,
+	EventEligibilityLost,
+}
+
+func EventTypes() []EventType {
+	return append([]EventType(nil), eventTypes...)
+}
+
+func IsValidEventType(eventType string) bool {
+	for _, t := range eventTypes {
+		if string(t) == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event.ID is set for events relayed from the outbox and is stable across
+// redeliveries, so handlers can use it to deduplicate.
 type Event struct {
+	ID        string
 	Type      EventType
 	Timestamp time.Time
 	Data      interface{}
 }
 
 type OfferCreatedData struct {
-	Offer models.Offer
+	Offer models.Offer `json:"offer"`
+}
+
+type OfferUpdatedData struct {
+	Offer models.Offer `json:"offer"`
+}
+
+type OfferDeletedData struct {
+	OfferID string `json:"offer_id"`
+}
+
+type OfferActivatedData struct {
+	UserID      string    `json:"user_id"`
+	OfferID     string    `json:"offer_id"`
+	ActivatedAt time.Time `json:"activated_at"`
+}
+
+type OfferRedeemedData struct {
+	RedemptionID string    `json:"redemption_id"`
+	UserID       string    `json:"user_id"`
+	OfferID      string    `json:"offer_id"`
+	RedeemedAt   time.Time `json:"redeemed_at"`
+}
+
+// OfferBudgetExhaustedData is emitted once, by the redemption that left too
+// little budget for another reward.
+type OfferBudgetExhaustedData struct {
+	OfferID      string    `json:"offer_id"`
+	BudgetCents  int64     `json:"budget_cents"`
+	RewardCents  int64     `json:"reward_cents"`
+	RedemptionID string    `json:"redemption_id"`
+	ExhaustedAt  time.Time `json:"exhausted_at"`
+}
+
+// OfferStartedData is emitted once an active offer's starts_at has passed.
+// StartedAt is the scheduled start, not when the event was fired.
+type OfferStartedData struct {
+	Offer     models.Offer `json:"offer"`
+	StartedAt time.Time    `json:"started_at"`
+}
+
+// OfferEndedData is emitted once an active offer's ends_at has passed, when
+// the offer is deactivated.
+type OfferEndedData struct {
+	OfferID string    `json:"offer_id"`
+	EndedAt time.Time `json:"ended_at"`
 }
 
 type TransactionCreatedData struct {
-	Transactions []models.Transaction
-	Count        int
+	Transactions []models.Transaction `json:"transactions"`
+	Count        int                  `json:"count"`
 }
 
 type EligibilityCheckedData struct {
-	UserID         string
-	EligibleOffers []models.EligibleOffer
-	CheckedAt      time.Time
+	UserID         string                 `json:"user_id"`
+	EligibleOffers []models.EligibleOffer `json:"eligible_offers"`
+	CheckedAt      time.Time              `json:"checked_at"`
+}
+
+// EligibilityChangedData is the payload of eligibility.gained and
+// eligibility.lost. Reason is only set when eligibility is gained.
+type EligibilityChangedData struct {
+	UserID    string    `json:"user_id"`
+	OfferID   string    `json:"offer_id"`
+	Reason    string    `json:"reason,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
 }
 
 type Handler func(ctx context.Context, event Event) error
@@ -82,19 +180,115 @@ func (m *Manager) Publish(ctx context.Context, eventType EventType, data interfa
 		Data:      data,
 	}
 
+	// Handlers outlive the request that published the event, so they keep its
+	// values (tenant, trace) but not its cancellation.
+	ctx = context.WithoutCancel(ctx)
+
 	for _, handler := range handlers {
 		go func(h Handler) {
 			if err := h(ctx, event); err != nil {
-				_ = err
+				log.Printf("events: %s handler failed: %v", eventType, err)
 			}
 		}(handler)
 	}
 }
 
+// Dispatch runs every handler for the event synchronously and returns their
+// combined errors. The outbox relay uses it to know whether an event may be
+// marked delivered.
+func (m *Manager) Dispatch(ctx context.Context, event Event) error {
+	m.mu.RLock()
+	enabled := m.enabled
+	handlers := m.handlers[event.Type]
+	m.mu.RUnlock()
+
+	if !enabled {
+		return nil
+	}
+
+	var errs []error
+	for _, h := range handlers {
+		if err := h(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// DecodeData decodes an event payload written to the outbox back into the
+// data type published for eventType.
+func DecodeData(eventType EventType, payload []byte) (interface{}, error) {
+	var data interface{}
+	switch eventType {
+	case EventOfferCreated:
+		data = &OfferCreatedData{}
+	case EventOfferUpdated:
+		data = &OfferUpdatedData{}
+	case EventOfferDeleted:
+		data = &OfferDeletedData{}
+	case EventOfferActivated:
+		data = &OfferActivatedData{}
+	case EventOfferRedeemed:
+		data = &OfferRedeemedData{}
+	case EventOfferBudgetExhausted:
+		data = &OfferBudgetExhaustedData{}
+	case EventOfferStarted:
+		data = &OfferStartedData{}
+	case EventOfferEnded:
+		data = &OfferEndedData{}
+	case EventTransactionCreated:
+		data = &TransactionCreatedData{}
+	case EventEligibilityChecked:
+		data = &EligibilityCheckedData{}
+	case EventEligibilityGained, EventEligibilityLost:
+		data = &EligibilityChangedData{}
+	default:
+		return nil, fmt.Errorf("unknown event type %q", eventType)
+	}
+
+	if err := json.Unmarshal(payload, data); err != nil {
+		return nil, fmt.Errorf("failed to decode %s payload: %w", eventType, err)
+	}
+
+	switch d := data.(type) {
+	case *OfferCreatedData:
+		return *d, nil
+	case *OfferUpdatedData:
+		return *d, nil
+	case *OfferDeletedData:
+		return *d, nil
+	case *OfferActivatedData:
+		return *d, nil
+	case *OfferRedeemedData:
+		return *d, nil
+	case *OfferBudgetExhaustedData:
+		return *d, nil
+	case *OfferStartedData:
+		return *d, nil
+	case *OfferEndedData:
+		return *d, nil
+	case *TransactionCreatedData:
+		return *d, nil
+	case *EligibilityChangedData:
+		return *d, nil
+	default:
+		return *data.(*EligibilityCheckedData), nil
+	}
+}
+
 func (m *Manager) PublishOfferCreated(ctx context.Context, offer models.Offer) {
 	m.Publish(ctx, EventOfferCreated, OfferCreatedData{Offer: offer})
 }
 
+func (m *Manager) PublishOfferUpdated(ctx context.Context, offer models.Offer) {
+	m.Publish(ctx, EventOfferUpdated, OfferUpdatedData{Offer: offer})
+}
+
+func (m *Manager) PublishOfferDeleted(ctx context.Context, offerID string) {
+	m.Publish(ctx, EventOfferDeleted, OfferDeletedData{OfferID: offerID})
+}
+
 func (m *Manager) PublishTransactionCreated(ctx context.Context, transactions []models.Transaction, count int) {
 	m.Publish(ctx, EventTransactionCreated, TransactionCreatedData{
 		Transactions: transactions,
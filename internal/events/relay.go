@@ -0,0 +1,176 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
+)
+
+// claimTimeout is how long a claimed event may go without being marked
+// delivered or failed before another relay claims it again.
+const claimTimeout = 15 * time.Minute
+
+type OutboxStore interface {
+	GetPendingOutboxEvents(now, staleBefore time.Time, limit int) ([]models.OutboxEvent, error)
+	ClaimOutboxEvent(id string, now, staleBefore time.Time) (bool, error)
+	MarkOutboxEventDelivered(id string, deliveredAt time.Time) error
+	MarkOutboxEventFailed(id string, lastError string, nextAttemptAt time.Time) error
+	MarkOutboxEventDead(id string, lastError string, deadAt time.Time) error
+}
+
+type RelayOptions struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MaxBackoff   time.Duration
+	MaxAttempts  int
+}
+
+// Relay moves events from the outbox to the manager's subscribers. Delivery is
+// at-least-once: an event is marked delivered only after every handler has
+// returned without error, and a crash in between redelivers it. Failed events
+// are retried with exponential backoff starting at PollInterval, until
+// MaxAttempts attempts have failed and the event is marked dead. Each event is
+// claimed before it is dispatched, so relays on servers sharing the database
+// do not dispatch it twice.
+type Relay struct {
+	store   OutboxStore
+	manager *Manager
+	opts    RelayOptions
+	now     func() time.Time
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewRelay(store OutboxStore, manager *Manager, opts RelayOptions) *Relay {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 10
+	}
+
+	return &Relay{
+		store:   store,
+		manager: manager,
+		opts:    opts,
+		now:     time.Now,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (r *Relay) Start() {
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(r.opts.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			if _, err := r.RelayPending(context.Background()); err != nil {
+				log.Printf("outbox: %v", err)
+			}
+
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (r *Relay) Stop() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+	<-r.done
+}
+
+// RelayPending dispatches every due event once and returns how many were
+// delivered. Events another relay has claimed are skipped.
+func (r *Relay) RelayPending(ctx context.Context) (int, error) {
+	now := r.now()
+	pending, err := r.store.GetPendingOutboxEvents(now, now.Add(-claimTimeout), r.opts.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load pending events: %w", err)
+	}
+
+	delivered := 0
+	for _, outboxEvent := range pending {
+		now := r.now()
+		claimed, err := r.store.ClaimOutboxEvent(outboxEvent.ID, now, now.Add(-claimTimeout))
+		if err != nil {
+			return delivered, err
+		}
+		if !claimed {
+			continue
+		}
+
+		if err := r.dispatch(ctx, outboxEvent); err != nil {
+			if outboxEvent.Attempts+1 >= r.opts.MaxAttempts {
+				log.Printf("outbox: event %s (%s) failed %d times, giving up: %v", outboxEvent.ID, outboxEvent.EventType, outboxEvent.Attempts+1, err)
+				if err := r.store.MarkOutboxEventDead(outboxEvent.ID, err.Error(), r.now()); err != nil {
+					return delivered, err
+				}
+				continue
+			}
+
+			log.Printf("outbox: event %s (%s) failed: %v", outboxEvent.ID, outboxEvent.EventType, err)
+
+			next := r.now().Add(r.backoff(outboxEvent.Attempts + 1))
+			if err := r.store.MarkOutboxEventFailed(outboxEvent.ID, err.Error(), next); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+
+		if err := r.store.MarkOutboxEventDelivered(outboxEvent.ID, r.now()); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+
+	return delivered, nil
+}
+
+func (r *Relay) dispatch(ctx context.Context, outboxEvent models.OutboxEvent) error {
+	eventType := EventType(outboxEvent.EventType)
+
+	data, err := DecodeData(eventType, outboxEvent.Payload)
+	if err != nil {
+		return err
+	}
+
+	ctx = tenant.WithTenant(ctx, outboxEvent.TenantID)
+	return r.manager.Dispatch(ctx, Event{
+		ID:        outboxEvent.ID,
+		Type:      eventType,
+		Timestamp: outboxEvent.CreatedAt,
+		Data:      data,
+	})
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	delay := r.opts.PollInterval
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= r.opts.MaxBackoff {
+			return r.opts.MaxBackoff
+		}
+	}
+	return delay
+}
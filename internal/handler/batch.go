@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/validation"
+)
+
+// BatchEligibility streams the eligible offers of every requested user as
+// NDJSON, one line per user as soon as it is evaluated. Request errors are
+// reported with a status code; once the first line is written the status is
+// committed, and users that fail to evaluate carry an error on their line.
+func (h *Handler) BatchEligibility(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+
+	var req models.BatchEligibilityRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err == io.EOF {
+			h.respondError(w, http.StatusBadRequest, "request body is required")
+			return
+		}
+		h.respondError(w, http.StatusBadRequest, "invalid JSON in request body")
+		return
+	}
+
+	for i := range req.UserIDs {
+		req.UserIDs[i] = validation.SanitizeString(req.UserIDs[i])
+	}
+
+	now := time.Now().UTC()
+	if req.Now != nil {
+		now = req.Now.UTC()
+	}
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	started := false
+
+	err := h.service.BatchEligibility(r.Context(), req.UserIDs, now, func(result models.BatchEligibilityResult) error {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if !started {
+			h.handleServiceError(w, err)
+			return
+		}
+		log.Printf("batch eligibility stopped: %v", err)
+	}
+}
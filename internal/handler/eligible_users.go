@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/validation"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *Handler) ListEligibleUsers(w http.ResponseWriter, r *http.Request) {
+	offerID := validation.SanitizeString(chi.URLParam(r, "id"))
+
+	now, ok := h.parseNow(w, r)
+	if !ok {
+		return
+	}
+
+	limit, ok := h.parseLimit(w, r)
+	if !ok {
+		return
+	}
+
+	response, err := h.service.ListEligibleUsers(r.Context(), offerID, now, limit, validation.SanitizeString(r.URL.Query().Get("cursor")))
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, response)
+}
+
+func (h *Handler) CreateEligibleUserExport(w http.ResponseWriter, r *http.Request) {
+	offerID := validation.SanitizeString(chi.URLParam(r, "id"))
+
+	now, ok := h.parseNow(w, r)
+	if !ok {
+		return
+	}
+
+	export, err := h.service.CreateEligibleUserExport(r.Context(), offerID, now)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusAccepted, export)
+}
+
+func (h *Handler) GetEligibleUserExport(w http.ResponseWriter, r *http.Request) {
+	offerID := validation.SanitizeString(chi.URLParam(r, "id"))
+	exportID := validation.SanitizeString(chi.URLParam(r, "export_id"))
+
+	export, err := h.service.GetEligibleUserExport(r.Context(), offerID, exportID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, export)
+}
+
+// DownloadEligibleUserExport streams the rows of a completed export as NDJSON,
+// one line per user. Once the first line is written the status is committed,
+// so later failures are only logged.
+func (h *Handler) DownloadEligibleUserExport(w http.ResponseWriter, r *http.Request) {
+	offerID := validation.SanitizeString(chi.URLParam(r, "id"))
+	exportID := validation.SanitizeString(chi.URLParam(r, "export_id"))
+
+	encoder := json.NewEncoder(w)
+	started := false
+
+	err := h.service.StreamEligibleUserExport(r.Context(), offerID, exportID, func(user models.EligibleUser) error {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		return encoder.Encode(user)
+	})
+	if err != nil {
+		if !started {
+			h.handleServiceError(w, err)
+			return
+		}
+		log.Printf("eligible user export %s download stopped: %v", exportID, err)
+		return
+	}
+
+	if !started {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+	}
+}
@@ -1,20 +1,29 @@
 package handler
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
+	"offer-eligibility-api/internal/database"
 	"offer-eligibility-api/internal/models"
 	"offer-eligibility-api/internal/service"
+	"offer-eligibility-api/internal/tenant"
 	"offer-eligibility-api/internal/validation"
 
 	"github.com/go-chi/chi/v5"
 )
 
+const maxBulkLineSize = 1 << 20
+
 type Handler struct {
 	service     *service.Service
 	maxBodySize int64
@@ -54,20 +63,139 @@ func (h *Handler) CreateOffer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req.ID = validation.SanitizeString(req.ID)
-	req.MerchantID = validation.SanitizeString(req.MerchantID)
-	for i := range req.MCCWhitelist {
-		req.MCCWhitelist[i] = validation.SanitizeString(req.MCCWhitelist[i])
-	}
+	sanitizeOffer(&req)
 
 	if err := h.service.CreateOffer(r.Context(), req); err != nil {
 		h.handleServiceError(w, err)
 		return
 	}
 
+	req.TenantID = tenant.FromContext(r.Context())
 	h.respondJSON(w, http.StatusCreated, req)
 }
 
+// sanitizeOffer cleans the identifiers of an offer read from a request body and
+// drops the fields clients cannot set.
+func sanitizeOffer(offer *models.Offer) {
+	offer.ID = validation.SanitizeString(offer.ID)
+	offer.MerchantID = validation.SanitizeString(offer.MerchantID)
+	for i := range offer.MCCWhitelist {
+		offer.MCCWhitelist[i] = validation.SanitizeString(offer.MCCWhitelist[i])
+	}
+	for i := range offer.Segments {
+		offer.Segments[i] = validation.SanitizeString(offer.Segments[i])
+	}
+	offer.BudgetSpentCents = 0
+}
+
+func (h *Handler) GetOffer(w http.ResponseWriter, r *http.Request) {
+	offerID := validation.SanitizeString(chi.URLParam(r, "id"))
+
+	offer, err := h.service.GetOffer(r.Context(), offerID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, offer)
+}
+
+func (h *Handler) ListOffers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.OfferFilter{
+		MerchantID: validation.SanitizeString(query.Get("merchant_id")),
+	}
+
+	if activeParam := query.Get("active"); activeParam != "" {
+		active, err := strconv.ParseBool(validation.SanitizeString(activeParam))
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, "invalid 'active' parameter, must be true or false")
+			return
+		}
+		filter.Active = &active
+	}
+
+	if liveAtParam := query.Get("live_at"); liveAtParam != "" {
+		liveAt, err := validation.ValidateTimeString(validation.SanitizeString(liveAtParam))
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, "invalid 'live_at' parameter, must be RFC3339 format")
+			return
+		}
+		liveAt = liveAt.UTC()
+		filter.LiveAt = &liveAt
+	}
+
+	offers, err := h.service.ListOffers(r.Context(), filter)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, models.ListOffersResponse{Offers: offers})
+}
+
+func (h *Handler) PatchOffer(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+
+	offerID := validation.SanitizeString(chi.URLParam(r, "id"))
+
+	var patch models.OfferPatch
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		if err == io.EOF {
+			h.respondError(w, http.StatusBadRequest, "request body is required")
+			return
+		}
+		h.respondError(w, http.StatusBadRequest, "invalid JSON in request body")
+		return
+	}
+
+	if patch.MerchantID != nil {
+		merchantID := validation.SanitizeString(*patch.MerchantID)
+		patch.MerchantID = &merchantID
+	}
+	if patch.MCCWhitelist != nil {
+		for i := range *patch.MCCWhitelist {
+			(*patch.MCCWhitelist)[i] = validation.SanitizeString((*patch.MCCWhitelist)[i])
+		}
+	}
+	if patch.Segments != nil {
+		for i := range *patch.Segments {
+			(*patch.Segments)[i] = validation.SanitizeString((*patch.Segments)[i])
+		}
+	}
+
+	offer, err := h.service.PatchOffer(r.Context(), offerID, patch)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, offer)
+}
+
+func (h *Handler) DeleteOffer(w http.ResponseWriter, r *http.Request) {
+	offerID := validation.SanitizeString(chi.URLParam(r, "id"))
+
+	if err := h.service.DeleteOffer(r.Context(), offerID); err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ListOfferRevisions(w http.ResponseWriter, r *http.Request) {
+	offerID := validation.SanitizeString(chi.URLParam(r, "id"))
+
+	revisions, err := h.service.ListOfferRevisions(r.Context(), offerID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, models.ListOfferRevisionsResponse{Revisions: revisions})
+}
+
 func (h *Handler) CreateTransactions(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
 
@@ -82,11 +210,27 @@ func (h *Handler) CreateTransactions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for i := range req.Transactions {
-		txn := &req.Transactions[i]
-		txn.ID = validation.SanitizeString(txn.ID)
-		txn.UserID = validation.SanitizeString(txn.UserID)
-		txn.MerchantID = validation.SanitizeString(txn.MerchantID)
-		txn.MCC = validation.SanitizeString(txn.MCC)
+		sanitizeTransaction(&req.Transactions[i])
+	}
+
+	switch req.Mode {
+	case "", models.IngestModeStrict:
+	case models.IngestModeIdempotent:
+		response, err := h.service.CreateTransactionsIdempotent(r.Context(), req.Transactions)
+		if err != nil {
+			h.handleServiceError(w, err)
+			return
+		}
+
+		status := http.StatusCreated
+		if response.Rejected > 0 {
+			status = http.StatusOK
+		}
+		h.respondJSON(w, status, response)
+		return
+	default:
+		h.respondError(w, http.StatusBadRequest, "invalid 'mode', must be strict or idempotent")
+		return
 	}
 
 	inserted, err := h.service.CreateTransactions(r.Context(), req.Transactions)
@@ -100,6 +244,56 @@ func (h *Handler) CreateTransactions(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// BulkImportTransactions streams an NDJSON body, one transaction per line.
+// The request body size limit does not apply; only single lines are capped.
+func (h *Handler) BulkImportTransactions(w http.ResponseWriter, r *http.Request) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-ndjson" && mediaType != "application/jsonl" {
+		h.respondError(w, http.StatusUnsupportedMediaType, "content type must be application/x-ndjson")
+		return
+	}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBulkLineSize)
+
+	bulk := h.service.NewBulkImport(r.Context())
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var txn models.Transaction
+		if err := json.Unmarshal(data, &txn); err != nil {
+			bulk.Reject(line, "invalid JSON")
+			continue
+		}
+		sanitizeTransaction(&txn)
+
+		if err := bulk.Add(line, txn); err != nil {
+			h.handleServiceError(w, err)
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		bulk.Reject(line+1, fmt.Sprintf("failed to read line, import stopped: %v", err))
+	}
+
+	summary, err := bulk.Finish()
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	status := http.StatusCreated
+	if summary.Rejected > 0 {
+		status = http.StatusOK
+	}
+	h.respondJSON(w, status, summary)
+}
+
 func (h *Handler) GetEligibleOffers(w http.ResponseWriter, r *http.Request) {
 	userID := chi.URLParam(r, "user_id")
 	userID = validation.SanitizeString(userID)
@@ -109,15 +303,30 @@ func (h *Handler) GetEligibleOffers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	now := time.Now().UTC()
-	if nowParam := r.URL.Query().Get("now"); nowParam != "" {
-		nowParam = validation.SanitizeString(nowParam)
-		parsed, err := validation.ValidateTimeString(nowParam)
+	now, ok := h.parseNow(w, r)
+	if !ok {
+		return
+	}
+
+	explain := false
+	if explainParam := r.URL.Query().Get("explain"); explainParam != "" {
+		parsed, err := strconv.ParseBool(validation.SanitizeString(explainParam))
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, "invalid 'explain' parameter, must be true or false")
+			return
+		}
+		explain = parsed
+	}
+
+	if explain {
+		explanation, err := h.service.ExplainEligibility(r.Context(), userID, now)
 		if err != nil {
-			h.respondError(w, http.StatusBadRequest, "invalid 'now' parameter, must be RFC3339 format")
+			h.handleServiceError(w, err)
 			return
 		}
-		now = parsed.UTC()
+
+		h.respondJSON(w, http.StatusOK, explanation)
+		return
 	}
 
 	response, err := h.service.GetEligibleOffers(r.Context(), userID, now)
@@ -129,6 +338,97 @@ func (h *Handler) GetEligibleOffers(w http.ResponseWriter, r *http.Request) {
 	h.respondJSON(w, http.StatusOK, response)
 }
 
+func (h *Handler) GetEligibilityHistory(w http.ResponseWriter, r *http.Request) {
+	userID := validation.SanitizeString(chi.URLParam(r, "user_id"))
+	query := r.URL.Query()
+
+	var filter models.EligibilityHistoryFilter
+	for _, param := range []struct {
+		name   string
+		target **time.Time
+	}{{"from", &filter.From}, {"to", &filter.To}} {
+		value := validation.SanitizeString(query.Get(param.name))
+		if value == "" {
+			continue
+		}
+		parsed, err := validation.ValidateTimeString(value)
+		if err != nil {
+			h.respondError(w, http.StatusBadRequest, fmt.Sprintf("invalid '%s' parameter, must be RFC3339 format", param.name))
+			return
+		}
+		parsed = parsed.UTC()
+		*param.target = &parsed
+	}
+
+	limit, ok := h.parseLimit(w, r)
+	if !ok {
+		return
+	}
+	filter.Limit = limit
+
+	history, err := h.service.GetEligibilityHistory(r.Context(), userID, filter, validation.SanitizeString(query.Get("cursor")))
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, history)
+}
+
+func (h *Handler) ActivateOffer(w http.ResponseWriter, r *http.Request) {
+	userID := validation.SanitizeString(chi.URLParam(r, "user_id"))
+	offerID := validation.SanitizeString(chi.URLParam(r, "offer_id"))
+
+	activation, created, err := h.service.ActivateOffer(r.Context(), userID, offerID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	h.respondJSON(w, status, activation)
+}
+
+func (h *Handler) RedeemOffer(w http.ResponseWriter, r *http.Request) {
+	userID := validation.SanitizeString(chi.URLParam(r, "user_id"))
+	offerID := validation.SanitizeString(chi.URLParam(r, "offer_id"))
+
+	redemption, err := h.service.RedeemOffer(r.Context(), userID, offerID)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, redemption)
+}
+
+func sanitizeTransaction(txn *models.Transaction) {
+	txn.ID = validation.SanitizeString(txn.ID)
+	txn.UserID = validation.SanitizeString(txn.UserID)
+	txn.MerchantID = validation.SanitizeString(txn.MerchantID)
+	txn.MCC = validation.SanitizeString(txn.MCC)
+}
+
+// parseNow reads the optional 'now' query parameter, defaulting to the
+// current time.
+func (h *Handler) parseNow(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	nowParam := validation.SanitizeString(r.URL.Query().Get("now"))
+	if nowParam == "" {
+		return time.Now().UTC(), true
+	}
+
+	parsed, err := validation.ValidateTimeString(nowParam)
+	if err != nil {
+		h.respondError(w, http.StatusBadRequest, "invalid 'now' parameter, must be RFC3339 format")
+		return time.Time{}, false
+	}
+
+	return parsed.UTC(), true
+}
+
 func (h *Handler) respondJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -146,6 +446,16 @@ func (h *Handler) handleServiceError(w http.ResponseWriter, err error) {
 		return
 	}
 
+	if errors.Is(err, database.ErrNotFound) {
+		h.respondError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if errors.Is(err, database.ErrConflict) {
+		h.respondError(w, http.StatusConflict, err.Error())
+		return
+	}
+
 	errMsg := err.Error()
 	if strings.Contains(errMsg, "UNIQUE constraint") || strings.Contains(errMsg, "duplicate") {
 		h.respondError(w, http.StatusBadRequest, errMsg)
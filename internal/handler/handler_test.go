@@ -6,7 +6,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -19,7 +20,7 @@ import (
 )
 
 func setupTestHandler(t *testing.T) (*Handler, func()) {
-	dbPath := "./test_handler_" + time.Now().Format("20060102150405") + ".db"
+	dbPath := filepath.Join(t.TempDir(), "test.db")
 	db, err := database.NewDB(dbPath)
 	if err != nil {
 		t.Fatalf("Failed to create test database: %v", err)
@@ -30,7 +31,6 @@ func setupTestHandler(t *testing.T) (*Handler, func()) {
 
 	cleanup := func() {
 		db.Close()
-		os.Remove(dbPath)
 	}
 
 	return h, cleanup
@@ -39,8 +39,36 @@ func setupTestHandler(t *testing.T) (*Handler, func()) {
 func setupRouter(h *Handler) *chi.Mux {
 	r := chi.NewRouter()
 	r.Post("/offers", h.CreateOffer)
+	r.Get("/offers", h.ListOffers)
+	r.Get("/offers/{id}", h.GetOffer)
+	r.Patch("/offers/{id}", h.PatchOffer)
+	r.Delete("/offers/{id}", h.DeleteOffer)
+	r.Get("/offers/{id}/revisions", h.ListOfferRevisions)
+	r.Post("/offers:simulate", h.SimulateOffer)
+	r.Get("/offers/{id}/eligible-users", h.ListEligibleUsers)
+	r.Post("/offers/{id}/eligible-users/exports", h.CreateEligibleUserExport)
+	r.Get("/offers/{id}/eligible-users/exports/{export_id}", h.GetEligibleUserExport)
+	r.Get("/offers/{id}/eligible-users/exports/{export_id}/download", h.DownloadEligibleUserExport)
 	r.Post("/transactions", h.CreateTransactions)
+	r.Post("/transactions:bulk", h.BulkImportTransactions)
 	r.Get("/users/{user_id}/eligible-offers", h.GetEligibleOffers)
+	r.Get("/users/{user_id}/eligibility-history", h.GetEligibilityHistory)
+	r.Post("/users/{user_id}/offers/{offer_id}/activate", h.ActivateOffer)
+	r.Post("/users/{user_id}/offers/{offer_id}/redeem", h.RedeemOffer)
+	r.Post("/eligibility:batch", h.BatchEligibility)
+	r.Post("/admin/retention:run", h.RunRetention)
+	r.Post("/segments", h.CreateSegment)
+	r.Get("/segments", h.ListSegments)
+	r.Get("/segments/{id}", h.GetSegment)
+	r.Delete("/segments/{id}", h.DeleteSegment)
+	r.Post("/segments/{id}/members", h.AddSegmentMembers)
+	r.Delete("/segments/{id}/members", h.RemoveSegmentMembers)
+	r.Post("/webhooks", h.CreateWebhook)
+	r.Get("/webhooks", h.ListWebhooks)
+	r.Get("/webhooks/dead-letters", h.ListWebhookDeadLetters)
+	r.Get("/webhooks/{id}", h.GetWebhook)
+	r.Delete("/webhooks/{id}", h.DeleteWebhook)
+	r.Get("/webhooks/{id}/deliveries", h.ListWebhookDeliveries)
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
@@ -480,6 +508,7 @@ func TestGetEligibleOffers_Success(t *testing.T) {
 		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
 	}
 
+	h.service.SetNow(func() time.Time { return offer.StartsAt })
 	if err := h.service.CreateOffer(context.Background(), offer); err != nil {
 		t.Fatalf("Failed to create offer: %v", err)
 	}
@@ -886,3 +915,1071 @@ func TestCreateOffer_Upsert(t *testing.T) {
 		t.Errorf("Expected 2 MCCs after upsert, got %d", len(response.MCCWhitelist))
 	}
 }
+
+func TestGetOffer_Success(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   uuid.New().String(),
+		MCCWhitelist: []string{"5812"},
+		Active:       true,
+		MinTxnCount:  3,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+
+	if err := h.service.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/offers/"+offer.ID, nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	var response models.Offer
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response.ID != offer.ID {
+		t.Errorf("Expected ID %s, got %s", offer.ID, response.ID)
+	}
+
+	if response.MinTxnCount != 3 {
+		t.Errorf("Expected MinTxnCount 3, got %d", response.MinTxnCount)
+	}
+}
+
+func TestGetOffer_NotFound(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	req := httptest.NewRequest("GET", "/offers/"+uuid.New().String(), nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestListOffers_Filters(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	merchantID := uuid.New().String()
+
+	offers := []models.Offer{
+		{
+			ID:           uuid.New().String(),
+			MerchantID:   merchantID,
+			Active:       true,
+			MinTxnCount:  1,
+			LookbackDays: 30,
+			StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+			EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			ID:           uuid.New().String(),
+			MerchantID:   merchantID,
+			Active:       false,
+			MinTxnCount:  1,
+			LookbackDays: 30,
+			StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+			EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+		},
+		{
+			ID:           uuid.New().String(),
+			MerchantID:   uuid.New().String(),
+			Active:       true,
+			MinTxnCount:  1,
+			LookbackDays: 30,
+			StartsAt:     time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC),
+			EndsAt:       time.Date(2025, 11, 30, 23, 59, 59, 0, time.UTC),
+		},
+	}
+
+	for _, offer := range offers {
+		if err := h.service.CreateOffer(context.Background(), offer); err != nil {
+			t.Fatalf("Failed to create offer: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected int
+	}{
+		{name: "no filters", query: "", expected: 3},
+		{name: "by merchant", query: "?merchant_id=" + merchantID, expected: 2},
+		{name: "active only", query: "?active=true", expected: 2},
+		{name: "merchant and active", query: "?merchant_id=" + merchantID + "&active=true", expected: 1},
+		{name: "live at", query: "?live_at=2025-11-15T00:00:00Z", expected: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/offers"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+			}
+
+			var response models.ListOffersResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if len(response.Offers) != tt.expected {
+				t.Errorf("Expected %d offers, got %d", tt.expected, len(response.Offers))
+			}
+		})
+	}
+}
+
+func TestListOffers_InvalidActiveParameter(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	req := httptest.NewRequest("GET", "/offers?active=maybe", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestPatchOffer_Deactivate(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   uuid.New().String(),
+		MCCWhitelist: []string{"5812"},
+		Active:       true,
+		MinTxnCount:  3,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+
+	if err := h.service.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	req := httptest.NewRequest("PATCH", "/offers/"+offer.ID, bytes.NewBufferString(`{"active": false, "min_txn_count": 5}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	var response models.Offer
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response.Active {
+		t.Error("Expected offer to be inactive after patch")
+	}
+
+	if response.MinTxnCount != 5 {
+		t.Errorf("Expected MinTxnCount 5 after patch, got %d", response.MinTxnCount)
+	}
+
+	if response.LookbackDays != 30 {
+		t.Errorf("Expected LookbackDays to be unchanged, got %d", response.LookbackDays)
+	}
+}
+
+func TestPatchOffer_InvalidPatch(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   uuid.New().String(),
+		Active:       true,
+		MinTxnCount:  3,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+
+	if err := h.service.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	req := httptest.NewRequest("PATCH", "/offers/"+offer.ID, bytes.NewBufferString(`{"lookback_days": 400}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestDeleteOffer_Success(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   uuid.New().String(),
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+
+	if err := h.service.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	req := httptest.NewRequest("DELETE", "/offers/"+offer.ID, nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	req2 := httptest.NewRequest("GET", "/offers/"+offer.ID, nil)
+	rr2 := httptest.NewRecorder()
+	r.ServeHTTP(rr2, req2)
+
+	if rr2.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after delete, got %d", rr2.Code)
+	}
+
+	req3 := httptest.NewRequest("DELETE", "/offers/"+offer.ID, nil)
+	rr3 := httptest.NewRecorder()
+	r.ServeHTTP(rr3, req3)
+
+	if rr3.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for repeated delete, got %d", rr3.Code)
+	}
+}
+
+func TestListOfferRevisions(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   uuid.New().String(),
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+
+	if err := h.service.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	req := httptest.NewRequest("PATCH", "/offers/"+offer.ID, strings.NewReader(`{"lookback_days": 60}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/offers/"+offer.ID+"/revisions", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	var response models.ListOfferRevisionsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if len(response.Revisions) != 2 {
+		t.Fatalf("Expected 2 revisions, got %+v", response.Revisions)
+	}
+	latest := response.Revisions[1]
+	if latest.Version != 2 || latest.ChangedBy != "anonymous" || latest.Offer.LookbackDays != 60 {
+		t.Errorf("Unexpected revision: %+v", latest)
+	}
+	if change, ok := latest.Diff["lookback_days"]; !ok || string(change.From) != "30" || string(change.To) != "60" {
+		t.Errorf("Expected lookback_days 30 -> 60 in diff, got %+v", latest.Diff)
+	}
+
+	req = httptest.NewRequest("GET", "/offers/"+uuid.New().String()+"/revisions", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for unknown offer, got %d", rr.Code)
+	}
+}
+
+func TestActivateAndRedeemOffer(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	merchantID := uuid.New().String()
+	userID := uuid.New().String()
+	now := time.Now().UTC()
+
+	offer := models.Offer{
+		ID:                    uuid.New().String(),
+		MerchantID:            merchantID,
+		Active:                true,
+		MinTxnCount:           1,
+		LookbackDays:          30,
+		StartsAt:              now.AddDate(0, 0, -1),
+		EndsAt:                now.AddDate(0, 0, 1),
+		MaxRedemptionsPerUser: 1,
+	}
+	if err := h.service.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	if _, err := h.service.CreateTransactions(context.Background(), []models.Transaction{{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		MerchantID:  merchantID,
+		MCC:         "5812",
+		AmountCents: 1000,
+		ApprovedAt:  now.Add(-time.Hour),
+	}}); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	post := func(action string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/users/"+userID+"/offers/"+offer.ID+"/"+action, nil)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := post("redeem"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 redeeming before activation, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	for _, want := range []int{http.StatusCreated, http.StatusOK} {
+		if rr := post("activate"); rr.Code != want {
+			t.Errorf("Expected status %d activating, got %d. Body: %s", want, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := post("redeem")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	var redemption models.Redemption
+	if err := json.NewDecoder(rr.Body).Decode(&redemption); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if redemption.ID == "" || redemption.UserID != userID || redemption.UserRedemptionCount != 1 {
+		t.Errorf("Unexpected redemption: %+v", redemption)
+	}
+
+	if rr := post("redeem"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 beyond the per-user cap, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestGetEligibleOffers_Explain(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	offerID := uuid.New().String()
+	userID := uuid.New().String()
+
+	offer := models.Offer{
+		ID:           offerID,
+		MerchantID:   uuid.New().String(),
+		MCCWhitelist: []string{"5812"},
+		Active:       true,
+		MinTxnCount:  5,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+
+	h.service.SetNow(func() time.Time { return offer.StartsAt })
+	if err := h.service.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	req := httptest.NewRequest("GET", "/users/"+userID+"/eligible-offers?explain=true&now="+now.Format(time.RFC3339), nil)
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	var response models.EligibilityExplanationResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if len(response.Offers) != 1 {
+		t.Fatalf("Expected 1 verdict, got %d", len(response.Offers))
+	}
+
+	verdict := response.Offers[0]
+	if verdict.OfferID != offerID || verdict.Eligible {
+		t.Errorf("Expected ineligible verdict for %s, got %+v", offerID, verdict)
+	}
+	if verdict.RequiredCount != 5 || verdict.FoundCount != 0 {
+		t.Errorf("Expected required=5 found=0, got required=%d found=%d", verdict.RequiredCount, verdict.FoundCount)
+	}
+	if verdict.FailedCriterion != models.RuleMinTxnCount {
+		t.Errorf("Expected failed criterion min_txn_count, got %q", verdict.FailedCriterion)
+	}
+}
+
+func TestGetEligibleOffers_InvalidExplainParameter(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	req := httptest.NewRequest("GET", "/users/"+uuid.New().String()+"/eligible-offers?explain=maybe", nil)
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+}
+
+func TestCreateTransactions_IdempotentMode(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	txn := models.Transaction{
+		ID:          uuid.New().String(),
+		UserID:      uuid.New().String(),
+		MerchantID:  uuid.New().String(),
+		MCC:         "5812",
+		AmountCents: 1250,
+		ApprovedAt:  time.Date(2025, 10, 20, 12, 34, 56, 0, time.UTC),
+	}
+
+	post := func(reqBody models.CreateTransactionsRequest) (*httptest.ResponseRecorder, models.CreateTransactionsResponse) {
+		body, _ := json.Marshal(reqBody)
+		req := httptest.NewRequest("POST", "/transactions", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		var response models.CreateTransactionsResponse
+		json.Unmarshal(rr.Body.Bytes(), &response)
+		return rr, response
+	}
+
+	rr, response := post(models.CreateTransactionsRequest{Mode: models.IngestModeIdempotent, Transactions: []models.Transaction{txn}})
+	if rr.Code != http.StatusCreated || response.Inserted != 1 {
+		t.Fatalf("Expected 201 with 1 inserted, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	rr, response = post(models.CreateTransactionsRequest{Mode: models.IngestModeIdempotent, Transactions: []models.Transaction{txn}})
+	if rr.Code != http.StatusCreated || response.Duplicates != 1 || response.Inserted != 0 {
+		t.Errorf("Expected 201 with 1 duplicate on retry, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	conflicting := txn
+	conflicting.AmountCents = 1
+	rr, response = post(models.CreateTransactionsRequest{Mode: models.IngestModeIdempotent, Transactions: []models.Transaction{conflicting}})
+	if rr.Code != http.StatusOK || response.Rejected != 1 || len(response.Errors) != 1 {
+		t.Errorf("Expected 200 with 1 rejected, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestCreateTransactions_InvalidMode(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	body := []byte(`{"mode": "lenient", "transactions": []}`)
+	req := httptest.NewRequest("POST", "/transactions", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+}
+
+func TestBulkImportTransactions_NDJSON(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	userID := uuid.New().String()
+	newLine := func(mcc string) string {
+		line, _ := json.Marshal(models.Transaction{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  uuid.New().String(),
+			MCC:         mcc,
+			AmountCents: 1250,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 34, 56, 0, time.UTC),
+		})
+		return string(line)
+	}
+
+	body := strings.Join([]string{
+		newLine("5812"),
+		"",
+		"{not json",
+		newLine("58"),
+		newLine("5814"),
+	}, "\n")
+
+	req := httptest.NewRequest("POST", "/transactions:bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	var response models.BulkImportResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response.Lines != 4 || response.Inserted != 2 || response.Rejected != 2 {
+		t.Errorf("Expected lines=4 inserted=2 rejected=2, got %+v", response)
+	}
+
+	if len(response.Errors) != 2 || response.Errors[0].Line != 3 || response.Errors[1].Line != 4 {
+		t.Errorf("Expected errors on lines 3 and 4, got %+v", response.Errors)
+	}
+}
+
+func TestBulkImportTransactions_UnsupportedContentType(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	req := httptest.NewRequest("POST", "/transactions:bulk", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415, got %d", rr.Code)
+	}
+}
+
+func TestWebhooks_Lifecycle(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	body := `{"url": "https://hooks.example.com/offers", "event_types": ["offer.created", "offer.deleted"]}`
+	req := httptest.NewRequest("POST", "/webhooks", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	var created models.WebhookEndpoint
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if created.ID == "" || !strings.HasPrefix(created.Secret, "whsec_") {
+		t.Errorf("Expected generated id and secret, got %+v", created)
+	}
+
+	req = httptest.NewRequest("GET", "/webhooks", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	var listed models.ListWebhooksResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(listed.Webhooks) != 1 || listed.Webhooks[0].Secret != "" {
+		t.Errorf("Expected one webhook without its secret, got %+v", listed.Webhooks)
+	}
+
+	req = httptest.NewRequest("GET", "/webhooks/"+created.ID+"/deliveries?limit=10", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest("DELETE", "/webhooks/"+created.ID, nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d", rr.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/webhooks/"+created.ID+"/deliveries", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after delete, got %d", rr.Code)
+	}
+}
+
+func TestCreateWebhook_UnknownEventType(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	body := `{"url": "https://hooks.example.com/offers", "event_types": ["offer.exploded"]}`
+	req := httptest.NewRequest("POST", "/webhooks", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", rr.Code)
+	}
+}
+
+func TestGetEligibilityHistory(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+	userID := uuid.New().String()
+
+	req := httptest.NewRequest("GET", "/users/"+userID+"/eligible-offers?now=2025-10-21T10:00:00Z", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/users/"+userID+"/eligibility-history?limit=10", nil)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	var history models.EligibilityHistoryResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if history.UserID != userID || len(history.Checks) != 1 {
+		t.Fatalf("Expected one recorded check, got %+v", history)
+	}
+	if !history.Checks[0].EvaluatedAt.Equal(time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected evaluated_at 2025-10-21T10:00:00Z, got %v", history.Checks[0].EvaluatedAt)
+	}
+
+	for _, query := range []string{"from=yesterday", "from=2025-10-22T00:00:00Z&to=2025-10-21T00:00:00Z", "cursor=bogus", "limit=0"} {
+		req = httptest.NewRequest("GET", "/users/"+userID+"/eligibility-history?"+query, nil)
+		rr = httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %q, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestSegmentEndpoints(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send("POST", "/segments", `{"name":"vip","type":"list","lookback_days":30}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a list segment with a lookback, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	if rr := send("POST", "/segments", `{"name":"regulars","type":"rule"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a rule segment without a rule, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	rr := send("POST", "/segments", `{"name":"vip","type":"list"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	var segment models.Segment
+	if err := json.NewDecoder(rr.Body).Decode(&segment); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rr := send("POST", "/segments", `{"name":"vip","type":"list"}`); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 for a duplicate name, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	alice, bob := uuid.New().String(), uuid.New().String()
+	rr = send("POST", "/segments/"+segment.ID+"/members", `{"user_ids":["`+alice+`","`+bob+`"]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	var members models.SegmentMembersResponse
+	if err := json.NewDecoder(rr.Body).Decode(&members); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if members.Changed != 2 || members.MemberCount != 2 {
+		t.Errorf("Unexpected members response %+v", members)
+	}
+	if rr := send("POST", "/segments/"+segment.ID+"/members", `{"user_ids":["not-a-uuid"]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid user ID, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = send("DELETE", "/segments/"+segment.ID+"/members", `{"user_ids":["`+bob+`"]}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = send("GET", "/segments/"+segment.ID, "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&segment); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if segment.MemberCount != 1 {
+		t.Errorf("Expected 1 member, got %d", segment.MemberCount)
+	}
+
+	rr = send("GET", "/segments", "")
+	var list models.ListSegmentsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if rr.Code != http.StatusOK || len(list.Segments) != 1 {
+		t.Errorf("Expected one segment, got %d %+v", rr.Code, list)
+	}
+
+	if rr := send("DELETE", "/segments/"+segment.ID, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("Expected status 204, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	if rr := send("GET", "/segments/"+segment.ID, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 after delete, got %d", rr.Code)
+	}
+}
+
+func TestBatchEligibility(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	merchantID := uuid.New().String()
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	h.service.SetNow(func() time.Time { return offer.StartsAt })
+	if err := h.service.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	alice, bob := uuid.New().String(), uuid.New().String()
+	if _, err := h.service.CreateTransactions(context.Background(), []models.Transaction{{
+		ID:          uuid.New().String(),
+		UserID:      alice,
+		MerchantID:  merchantID,
+		MCC:         "5812",
+		AmountCents: 1000,
+		ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+	}}); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/eligibility:batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := post(`{"user_ids":["` + alice + `","` + bob + `"],"now":"2025-10-21T10:00:00Z"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Errorf("Expected NDJSON content type, got %q", ct)
+	}
+
+	body := rr.Body.String()
+	results := make(map[string]models.BatchEligibilityResult)
+	decoder := json.NewDecoder(strings.NewReader(body))
+	for decoder.More() {
+		var result models.BatchEligibilityResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatalf("Failed to decode line: %v", err)
+		}
+		results[result.UserID] = result
+	}
+	if len(results) != 2 || len(results[alice].EligibleOffers) != 1 || len(results[bob].EligibleOffers) != 0 {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	if !strings.Contains(body, `"eligible_offers":[]`) {
+		t.Errorf("Expected an empty list for users without offers, got %s", body)
+	}
+
+	if rr := post(`{"user_ids":[]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without users, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	if rr := post(`{"user_ids":["not-a-uuid"]}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid user ID, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	if rr := post(`{"user_ids":["` + alice + `"],"now":"yesterday"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid now, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestEligibleUsersEndpoints(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	merchantID := uuid.New().String()
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	if err := h.service.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	var txns []models.Transaction
+	for i := 0; i < 2; i++ {
+		txns = append(txns, models.Transaction{
+			ID:          uuid.New().String(),
+			UserID:      uuid.New().String(),
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		})
+	}
+	if _, err := h.service.CreateTransactions(context.Background(), txns); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	base := "/offers/" + offer.ID + "/eligible-users"
+	rr := send("GET", base+"?now=2025-10-21T10:00:00Z&limit=1")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	var page models.EligibleUsersResponse
+	if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if page.TotalCount != 2 || len(page.Users) != 1 || page.NextCursor == "" {
+		t.Errorf("Unexpected page %+v", page)
+	}
+	if rr := send("GET", base+"?limit=0"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid limit, got %d", rr.Code)
+	}
+	if rr := send("GET", base+"?now=yesterday"); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid now, got %d", rr.Code)
+	}
+
+	rr = send("POST", base+"/exports?now=2025-10-21T10:00:00Z")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	var export models.EligibleUserExport
+	if err := json.NewDecoder(rr.Body).Decode(&export); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if export.Status != models.ExportStatusPending {
+		t.Errorf("Expected a pending export, got %+v", export)
+	}
+	if rr := send("GET", base+"/exports/"+export.ID+"/download"); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 downloading a pending export, got %d", rr.Code)
+	}
+
+	if _, err := h.service.RunEligibleUserExports(context.Background()); err != nil {
+		t.Fatalf("Failed to run exports: %v", err)
+	}
+
+	rr = send("GET", base+"/exports/"+export.ID)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&export); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if export.Status != models.ExportStatusCompleted || export.UserCount != 2 {
+		t.Errorf("Unexpected export %+v", export)
+	}
+
+	rr = send("GET", base+"/exports/"+export.ID+"/download")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("Expected an NDJSON stream, got %d (%s). Body: %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	if lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n"); len(lines) != 2 {
+		t.Errorf("Expected 2 lines, got %d", len(lines))
+	}
+
+	if rr := send("GET", base+"/exports/"+uuid.New().String()); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown export, got %d", rr.Code)
+	}
+}
+
+func TestSimulateOffer(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	merchantID := uuid.New().String()
+	if _, err := h.service.CreateTransactions(context.Background(), []models.Transaction{{
+		ID:          uuid.New().String(),
+		UserID:      uuid.New().String(),
+		MerchantID:  merchantID,
+		MCC:         "5812",
+		AmountCents: 1000,
+		ApprovedAt:  time.Date(2025, 10, 2, 12, 0, 0, 0, time.UTC),
+	}}); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	body := `{
+		"offer": {"merchant_id": "` + merchantID + `", "min_txn_count": 1, "lookback_days": 7, "starts_at": "2025-10-01T00:00:00Z", "ends_at": "2025-10-31T00:00:00Z"},
+		"from": "2025-10-01T00:00:00Z",
+		"to": "2025-10-03T00:00:00Z"
+	}`
+	req := httptest.NewRequest("POST", "/offers:simulate", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	var response models.SimulateOfferResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(response.Days) != 3 || response.Days[0].EligibleUsers != 0 || response.Days[2].EligibleUsers != 1 {
+		t.Errorf("Unexpected simulation %+v", response.Days)
+	}
+
+	req = httptest.NewRequest("POST", "/offers:simulate", strings.NewReader(`{"offer": {"merchant_id": "`+merchantID+`"}}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an incomplete request, got %d", rr.Code)
+	}
+}
+
+func TestRunRetention(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	r := setupRouter(h)
+
+	userID := uuid.New().String()
+	if _, err := h.service.CreateTransactions(context.Background(), []models.Transaction{{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		MerchantID:  uuid.New().String(),
+		MCC:         "5812",
+		AmountCents: 1000,
+		ApprovedAt:  time.Now().AddDate(-2, 0, 0),
+	}}); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/admin/retention:run", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d. Body: %s", rr.Code, rr.Body.String())
+	}
+	var response models.RetentionRun
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.TransactionsPurged != 1 || response.Cutoff.IsZero() {
+		t.Errorf("Expected one transaction purged, got %+v", response)
+	}
+}
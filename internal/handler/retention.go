@@ -0,0 +1,17 @@
+package handler
+
+import (
+	"net/http"
+)
+
+// RunRetention purges the transactions past the retention period now, rather
+// than waiting for the background purge.
+func (h *Handler) RunRetention(w http.ResponseWriter, r *http.Request) {
+	run, err := h.service.RunRetention(r.Context())
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, run)
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/validation"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *Handler) CreateSegment(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+
+	var req models.CreateSegmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err == io.EOF {
+			h.respondError(w, http.StatusBadRequest, "request body is required")
+			return
+		}
+		h.respondError(w, http.StatusBadRequest, "invalid JSON in request body")
+		return
+	}
+
+	segment, err := h.service.CreateSegment(r.Context(), req)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, segment)
+}
+
+func (h *Handler) ListSegments(w http.ResponseWriter, r *http.Request) {
+	segments, err := h.service.ListSegments(r.Context())
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, models.ListSegmentsResponse{Segments: segments})
+}
+
+func (h *Handler) GetSegment(w http.ResponseWriter, r *http.Request) {
+	id := validation.SanitizeString(chi.URLParam(r, "id"))
+
+	segment, err := h.service.GetSegment(r.Context(), id)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, segment)
+}
+
+func (h *Handler) DeleteSegment(w http.ResponseWriter, r *http.Request) {
+	id := validation.SanitizeString(chi.URLParam(r, "id"))
+
+	if err := h.service.DeleteSegment(r.Context(), id); err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) AddSegmentMembers(w http.ResponseWriter, r *http.Request) {
+	h.changeSegmentMembers(w, r, h.service.AddSegmentMembers)
+}
+
+func (h *Handler) RemoveSegmentMembers(w http.ResponseWriter, r *http.Request) {
+	h.changeSegmentMembers(w, r, h.service.RemoveSegmentMembers)
+}
+
+type segmentMembersFunc func(ctx context.Context, id string, req models.SegmentMembersRequest) (models.SegmentMembersResponse, error)
+
+func (h *Handler) changeSegmentMembers(w http.ResponseWriter, r *http.Request, change segmentMembersFunc) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+
+	id := validation.SanitizeString(chi.URLParam(r, "id"))
+
+	var req models.SegmentMembersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err == io.EOF {
+			h.respondError(w, http.StatusBadRequest, "request body is required")
+			return
+		}
+		h.respondError(w, http.StatusBadRequest, "invalid JSON in request body")
+		return
+	}
+
+	for i := range req.UserIDs {
+		req.UserIDs[i] = validation.SanitizeString(req.UserIDs[i])
+	}
+
+	resp, err := change(r.Context(), id, req)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"offer-eligibility-api/internal/models"
+)
+
+// SimulateOffer reports how many users an unsaved offer would have reached on
+// each day of a range, without storing the offer.
+func (h *Handler) SimulateOffer(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+
+	var req models.SimulateOfferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err == io.EOF {
+			h.respondError(w, http.StatusBadRequest, "request body is required")
+			return
+		}
+		h.respondError(w, http.StatusBadRequest, "invalid JSON in request body")
+		return
+	}
+
+	sanitizeOffer(&req.Offer)
+
+	response, err := h.service.SimulateOffer(r.Context(), req)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, response)
+}
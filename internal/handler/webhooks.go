@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/validation"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxBodySize)
+
+	var req models.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if err == io.EOF {
+			h.respondError(w, http.StatusBadRequest, "request body is required")
+			return
+		}
+		h.respondError(w, http.StatusBadRequest, "invalid JSON in request body")
+		return
+	}
+
+	req.URL = validation.SanitizeString(req.URL)
+	for i := range req.EventTypes {
+		req.EventTypes[i] = validation.SanitizeString(req.EventTypes[i])
+	}
+
+	endpoint, err := h.service.CreateWebhook(r.Context(), req)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusCreated, endpoint)
+}
+
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := h.service.ListWebhooks(r.Context())
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, models.ListWebhooksResponse{Webhooks: endpoints})
+}
+
+func (h *Handler) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	id := validation.SanitizeString(chi.URLParam(r, "id"))
+
+	endpoint, err := h.service.GetWebhook(r.Context(), id)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, endpoint)
+}
+
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := validation.SanitizeString(chi.URLParam(r, "id"))
+
+	if err := h.service.DeleteWebhook(r.Context(), id); err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := validation.SanitizeString(chi.URLParam(r, "id"))
+
+	limit, ok := h.parseLimit(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := h.service.ListWebhookDeliveries(r.Context(), id, limit)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, models.ListWebhookDeliveriesResponse{Deliveries: deliveries})
+}
+
+func (h *Handler) ListWebhookDeadLetters(w http.ResponseWriter, r *http.Request) {
+	limit, ok := h.parseLimit(w, r)
+	if !ok {
+		return
+	}
+
+	letters, err := h.service.ListWebhookDeadLetters(r.Context(), limit)
+	if err != nil {
+		h.handleServiceError(w, err)
+		return
+	}
+
+	h.respondJSON(w, http.StatusOK, models.ListWebhookDeadLettersResponse{DeadLetters: letters})
+}
+
+func (h *Handler) parseLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	limitParam := validation.SanitizeString(r.URL.Query().Get("limit"))
+	if limitParam == "" {
+		return 0, true
+	}
+
+	limit, err := strconv.Atoi(limitParam)
+	if err != nil || limit <= 0 {
+		h.respondError(w, http.StatusBadRequest, "invalid 'limit' parameter, must be a positive integer")
+		return 0, false
+	}
+
+	return limit, true
+}
@@ -0,0 +1,291 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
+)
+
+const (
+	RoleAdmin               = "admin"
+	RoleOfferAdmin          = "offer-admin"
+	RoleTransactionIngestor = "transaction-ingestor"
+	RoleEligibilityReader   = "eligibility-reader"
+	RoleOfferRedeemer       = "offer-redeemer"
+)
+
+const (
+	AuthMethodAPIKey = "api_key"
+	AuthMethodJWT    = "jwt"
+
+	APIKeyHeader = "X-API-Key"
+	apiKeyPrefix = "oek_"
+	jwtLeeway    = 30 * time.Second
+)
+
+var (
+	errMissingCredentials = errors.New("authentication required")
+	errInvalidCredentials = errors.New("invalid credentials")
+	errTokenExpired       = errors.New("token expired")
+)
+
+type Principal struct {
+	Subject  string
+	TenantID string
+	Roles    []string
+	Method   string
+}
+
+// HasRole reports whether the principal holds role; admin holds every role.
+func (p Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role || r == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type APIKeyStore interface {
+	GetAPIKeyByHash(keyHash string) (models.APIKey, error)
+}
+
+type AuthOptions struct {
+	JWTSecret   string
+	JWTIssuer   string
+	JWTAudience string
+}
+
+type Authenticator struct {
+	keys      APIKeyStore
+	jwtSecret []byte
+	issuer    string
+	audience  string
+	now       func() time.Time
+}
+
+func NewAuthenticator(keys APIKeyStore, opts AuthOptions) *Authenticator {
+	return &Authenticator{
+		keys:      keys,
+		jwtSecret: []byte(opts.JWTSecret),
+		issuer:    opts.JWTIssuer,
+		audience:  opts.JWTAudience,
+		now:       time.Now,
+	}
+}
+
+type principalKey struct{}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleOfferAdmin, RoleTransactionIngestor, RoleEligibilityReader, RoleOfferRedeemer:
+		return true
+	default:
+		return false
+	}
+}
+
+// GenerateAPIKey returns a new random API key and the hash to store for it.
+func GenerateAPIKey() (string, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, HashAPIKey(key), nil
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Require authenticates the request and lets it through if the principal holds
+// at least one of roles. Missing or invalid credentials are rejected with 401,
+// insufficient roles with 403. The principal's tenant scopes everything
+// downstream of the handler.
+func (a *Authenticator) Require(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := a.Authenticate(r)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="offer-eligibility-api"`)
+				writeAuthError(w, http.StatusUnauthorized, err.Error())
+				return
+			}
+
+			allowed := false
+			for _, role := range roles {
+				if principal.HasRole(role) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				writeAuthError(w, http.StatusForbidden, "insufficient role")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), principalKey{}, principal)
+			ctx = tenant.WithTenant(ctx, principal.TenantID)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	if key := r.Header.Get(APIKeyHeader); key != "" {
+		return a.authenticateAPIKey(key)
+	}
+
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		scheme, token, ok := strings.Cut(authorization, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return Principal{}, errInvalidCredentials
+		}
+		return a.authenticateJWT(strings.TrimSpace(token))
+	}
+
+	return Principal{}, errMissingCredentials
+}
+
+func (a *Authenticator) authenticateAPIKey(key string) (Principal, error) {
+	if a.keys == nil || !strings.HasPrefix(key, apiKeyPrefix) {
+		return Principal{}, errInvalidCredentials
+	}
+
+	apiKey, err := a.keys.GetAPIKeyByHash(HashAPIKey(key))
+	if err != nil {
+		return Principal{}, errInvalidCredentials
+	}
+
+	return Principal{
+		Subject:  apiKey.ID,
+		TenantID: apiKey.TenantID,
+		Roles:    apiKey.Roles,
+		Method:   AuthMethodAPIKey,
+	}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	TenantID  string          `json:"tenant_id"`
+	Roles     []string        `json:"roles"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	NotBefore int64           `json:"nbf"`
+}
+
+// authenticateJWT verifies an HS256 token signed with the configured secret.
+// exp, sub and tenant_id are required; iss and aud are checked when configured.
+func (a *Authenticator) authenticateJWT(token string) (Principal, error) {
+	if len(a.jwtSecret) == 0 {
+		return Principal{}, errInvalidCredentials
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, errInvalidCredentials
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return Principal{}, errInvalidCredentials
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, errInvalidCredentials
+	}
+
+	mac := hmac.New(sha256.New, a.jwtSecret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return Principal{}, errInvalidCredentials
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, errInvalidCredentials
+	}
+
+	now := a.now()
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(jwtLeeway)) {
+		return Principal{}, errTokenExpired
+	}
+	if claims.NotBefore != 0 && now.Add(jwtLeeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return Principal{}, errInvalidCredentials
+	}
+	if a.issuer != "" && claims.Issuer != a.issuer {
+		return Principal{}, errInvalidCredentials
+	}
+	if a.audience != "" && !hasAudience(claims.Audience, a.audience) {
+		return Principal{}, errInvalidCredentials
+	}
+	if claims.Subject == "" || claims.TenantID == "" {
+		return Principal{}, errInvalidCredentials
+	}
+
+	return Principal{
+		Subject:  claims.Subject,
+		TenantID: claims.TenantID,
+		Roles:    claims.Roles,
+		Method:   AuthMethodJWT,
+	}, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// aud is either a single string or an array of strings.
+func hasAudience(raw json.RawMessage, audience string) bool {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == audience
+	}
+
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		for _, aud := range list {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func writeAuthError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{Error: message})
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+type fakeKeyStore map[string]models.APIKey
+
+func (s fakeKeyStore) GetAPIKeyByHash(keyHash string) (models.APIKey, error) {
+	key, ok := s[keyHash]
+	if !ok {
+		return models.APIKey{}, fmt.Errorf("not found")
+	}
+	return key, nil
+}
+
+func signJWT(t *testing.T, secret string, header, claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("Failed to marshal JWT segment: %v", err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	signingInput := encode(header) + "." + encode(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthenticator_Require(t *testing.T) {
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+
+	ingestKey, ingestHash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("Failed to generate api key: %v", err)
+	}
+	adminKey, adminHash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("Failed to generate api key: %v", err)
+	}
+
+	keys := fakeKeyStore{
+		ingestHash: {ID: "ingest", TenantID: "tenant-a", Roles: []string{RoleTransactionIngestor}},
+		adminHash:  {ID: "admin", TenantID: "tenant-a", Roles: []string{RoleAdmin}},
+	}
+
+	auth := NewAuthenticator(keys, AuthOptions{JWTSecret: testSecret, JWTIssuer: "issuer", JWTAudience: "offers"})
+	auth.now = func() time.Time { return now }
+
+	hs256 := map[string]interface{}{"alg": "HS256", "typ": "JWT"}
+	readerClaims := map[string]interface{}{
+		"sub":       "support-tool",
+		"tenant_id": "tenant-b",
+		"roles":     []string{RoleEligibilityReader},
+		"iss":       "issuer",
+		"aud":       []string{"offers"},
+		"exp":       now.Add(time.Hour).Unix(),
+	}
+	noTenantClaims := map[string]interface{}{
+		"sub":   "support-tool",
+		"roles": []string{RoleEligibilityReader},
+		"iss":   "issuer",
+		"aud":   "offers",
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	expiredClaims := map[string]interface{}{
+		"sub":   "support-tool",
+		"roles": []string{RoleEligibilityReader},
+		"iss":   "issuer",
+		"aud":   "offers",
+		"exp":   now.Add(-time.Hour).Unix(),
+	}
+	wrongAudience := map[string]interface{}{
+		"sub":   "support-tool",
+		"roles": []string{RoleEligibilityReader},
+		"iss":   "issuer",
+		"aud":   "other",
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+
+	tests := []struct {
+		name     string
+		role     string
+		header   string
+		value    string
+		expected int
+		tenant   string
+	}{
+		{name: "no credentials", role: RoleOfferAdmin, expected: http.StatusUnauthorized},
+		{name: "unknown api key", role: RoleTransactionIngestor, header: APIKeyHeader, value: "oek_unknown", expected: http.StatusUnauthorized},
+		{name: "api key with role", role: RoleTransactionIngestor, header: APIKeyHeader, value: ingestKey, expected: http.StatusOK, tenant: "tenant-a"},
+		{name: "api key without role", role: RoleOfferAdmin, header: APIKeyHeader, value: ingestKey, expected: http.StatusForbidden},
+		{name: "admin api key", role: RoleOfferAdmin, header: APIKeyHeader, value: adminKey, expected: http.StatusOK},
+		{name: "jwt with role", role: RoleEligibilityReader, header: "Authorization", value: "Bearer " + signJWT(t, testSecret, hs256, readerClaims), expected: http.StatusOK, tenant: "tenant-b"},
+		{name: "jwt without tenant", role: RoleEligibilityReader, header: "Authorization", value: "Bearer " + signJWT(t, testSecret, hs256, noTenantClaims), expected: http.StatusUnauthorized},
+		{name: "jwt without role", role: RoleOfferAdmin, header: "Authorization", value: "Bearer " + signJWT(t, testSecret, hs256, readerClaims), expected: http.StatusForbidden},
+		{name: "expired jwt", role: RoleEligibilityReader, header: "Authorization", value: "Bearer " + signJWT(t, testSecret, hs256, expiredClaims), expected: http.StatusUnauthorized},
+		{name: "jwt wrong audience", role: RoleEligibilityReader, header: "Authorization", value: "Bearer " + signJWT(t, testSecret, hs256, wrongAudience), expected: http.StatusUnauthorized},
+		{name: "jwt wrong secret", role: RoleEligibilityReader, header: "Authorization", value: "Bearer " + signJWT(t, "another-secret-another-secret-xx", hs256, readerClaims), expected: http.StatusUnauthorized},
+		{name: "jwt alg none", role: RoleEligibilityReader, header: "Authorization", value: "Bearer " + signJWT(t, testSecret, map[string]interface{}{"alg": "none"}, readerClaims), expected: http.StatusUnauthorized},
+		{name: "basic auth", role: RoleEligibilityReader, header: "Authorization", value: "Basic dXNlcjpwYXNz", expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var principal Principal
+			var tenantID string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				principal, _ = PrincipalFromContext(r.Context())
+				tenantID = tenant.FromContext(r.Context())
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			rr := httptest.NewRecorder()
+
+			auth.Require(tt.role)(next).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d. Body: %s", tt.expected, rr.Code, rr.Body.String())
+			}
+			if tt.expected == http.StatusOK && principal.Subject == "" {
+				t.Error("Expected principal in request context")
+			}
+			if tt.tenant != "" && tenantID != tt.tenant {
+				t.Errorf("Expected tenant %s in request context, got %s", tt.tenant, tenantID)
+			}
+		})
+	}
+}
@@ -1,20 +1,110 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
+// Offer.MaxRedemptions and MaxRedemptionsPerUser cap redemptions across all
+// users and per user; zero means unlimited. Each redemption pays RewardCents
+// out of BudgetCents, also unlimited when zero. BudgetSpentCents is maintained
+// by redemptions and ignored on writes. Offers with Segments are only
+// evaluated for users in at least one of those segments.
 type Offer struct {
-	ID           string    `json:"id"`
-	MerchantID   string    `json:"merchant_id"`
-	MCCWhitelist []string  `json:"mcc_whitelist"`
-	Active       bool      `json:"active"`
-	MinTxnCount  int       `json:"min_txn_count"`
-	LookbackDays int       `json:"lookback_days"`
-	StartsAt     time.Time `json:"starts_at"`
-	EndsAt       time.Time `json:"ends_at"`
+	ID                    string    `json:"id"`
+	TenantID              string    `json:"tenant_id,omitempty"`
+	MerchantID            string    `json:"merchant_id"`
+	MCCWhitelist          []string  `json:"mcc_whitelist"`
+	Active                bool      `json:"active"`
+	MinTxnCount           int       `json:"min_txn_count"`
+	MinSpendCents         int64     `json:"min_spend_cents"`
+	MinTxnAmountCents     int64     `json:"min_txn_amount_cents"`
+	LookbackDays          int       `json:"lookback_days"`
+	StartsAt              time.Time `json:"starts_at"`
+	EndsAt                time.Time `json:"ends_at"`
+	Rules                 *Rule     `json:"rules,omitempty"`
+	MaxRedemptions        int       `json:"max_redemptions,omitempty"`
+	MaxRedemptionsPerUser int       `json:"max_redemptions_per_user,omitempty"`
+	BudgetCents           int64     `json:"budget_cents,omitempty"`
+	RewardCents           int64     `json:"reward_cents,omitempty"`
+	BudgetSpentCents      int64     `json:"budget_spent_cents,omitempty"`
+	Segments              []string  `json:"segments,omitempty"`
+	Version               int       `json:"version,omitempty"`
+}
+
+type RuleType string
+
+const (
+	RuleAnd                  RuleType = "and"
+	RuleOr                   RuleType = "or"
+	RuleNot                  RuleType = "not"
+	RuleMinTxnCount          RuleType = "min_txn_count"
+	RuleMinSpendCents        RuleType = "min_spend_cents"
+	RuleMinTxnAmountCents    RuleType = "min_txn_amount_cents"
+	RuleMinDistinctMerchants RuleType = "min_distinct_merchants"
+)
+
+// Criteria reported for offers whose redemption caps are reached or whose
+// segments exclude the user. They are not rule types and cannot appear in a
+// rule tree.
+const (
+	CriterionMaxRedemptions        RuleType = "max_redemptions"
+	CriterionMaxRedemptionsPerUser RuleType = "max_redemptions_per_user"
+	CriterionSegments              RuleType = "segments"
+)
+
+// Rule is a node in an offer's eligibility rule tree. Combinators (and, or,
+// not) hold child rules; every other type is a threshold over the
+// transactions selected by Match within the offer's lookback window.
+type Rule struct {
+	Type  RuleType          `json:"type"`
+	Rules []Rule            `json:"rules,omitempty"`
+	Value int64             `json:"value,omitempty"`
+	Match *TransactionMatch `json:"match,omitempty"`
+}
+
+// TransactionMatch selects the transactions a threshold rule aggregates.
+// Without MerchantIDs, MCCs or AnyMerchant it inherits the offer's
+// merchant_id and mcc_whitelist.
+type TransactionMatch struct {
+	AnyMerchant bool     `json:"any_merchant,omitempty"`
+	MerchantIDs []string `json:"merchant_ids,omitempty"`
+	MCCs        []string `json:"mccs,omitempty"`
+	ExcludeMCCs []string `json:"exclude_mccs,omitempty"`
+	DaysOfWeek  []string `json:"days_of_week,omitempty"`
+}
+
+type OfferFilter struct {
+	MerchantID string
+	Active     *bool
+	LiveAt     *time.Time
+}
+
+type OfferPatch struct {
+	MerchantID            *string    `json:"merchant_id"`
+	MCCWhitelist          *[]string  `json:"mcc_whitelist"`
+	Active                *bool      `json:"active"`
+	MinTxnCount           *int       `json:"min_txn_count"`
+	MinSpendCents         *int64     `json:"min_spend_cents"`
+	MinTxnAmountCents     *int64     `json:"min_txn_amount_cents"`
+	LookbackDays          *int       `json:"lookback_days"`
+	StartsAt              *time.Time `json:"starts_at"`
+	EndsAt                *time.Time `json:"ends_at"`
+	Rules                 *Rule      `json:"rules"`
+	MaxRedemptions        *int       `json:"max_redemptions"`
+	MaxRedemptionsPerUser *int       `json:"max_redemptions_per_user"`
+	BudgetCents           *int64     `json:"budget_cents"`
+	RewardCents           *int64     `json:"reward_cents"`
+	Segments              *[]string  `json:"segments"`
+}
+
+type ListOffersResponse struct {
+	Offers []Offer `json:"offers"`
 }
 
 type Transaction struct {
 	ID          string    `json:"id"`
+	TenantID    string    `json:"tenant_id,omitempty"`
 	UserID      string    `json:"user_id"`
 	MerchantID  string    `json:"merchant_id"`
 	MCC         string    `json:"mcc"`
@@ -22,6 +112,12 @@ type Transaction struct {
 	ApprovedAt  time.Time `json:"approved_at"`
 }
 
+type TransactionSummary struct {
+	Count      int
+	TotalCents int64
+	MaxCents   int64
+}
+
 type EligibleOffer struct {
 	OfferID string `json:"offer_id"`
 	Reason  string `json:"reason"`
@@ -32,12 +128,392 @@ type EligibleOffersResponse struct {
 	EligibleOffers []EligibleOffer `json:"eligible_offers"`
 }
 
+// BatchEligibilityRequest asks for the eligible offers of many users at once.
+// Now defaults to the current time.
+type BatchEligibilityRequest struct {
+	UserIDs []string   `json:"user_ids"`
+	Now     *time.Time `json:"now,omitempty"`
+}
+
+// BatchEligibilityResult is one line of a batch eligibility response. Error
+// is set instead of EligibleOffers when the user could not be evaluated.
+type BatchEligibilityResult struct {
+	UserID         string          `json:"user_id"`
+	EligibleOffers []EligibleOffer `json:"eligible_offers"`
+	Error          string          `json:"error,omitempty"`
+}
+
+type CriterionVerdict struct {
+	Path                  string   `json:"path"`
+	Criterion             RuleType `json:"criterion"`
+	Required              int64    `json:"required"`
+	Found                 int64    `json:"found"`
+	Passed                bool     `json:"passed"`
+	MatchedTransactionIDs []string `json:"matched_transaction_ids"`
+}
+
+type OfferVerdict struct {
+	OfferID               string             `json:"offer_id"`
+	Eligible              bool               `json:"eligible"`
+	RequiredCount         int64              `json:"required_count"`
+	FoundCount            int64              `json:"found_count"`
+	WindowStart           time.Time          `json:"window_start"`
+	WindowEnd             time.Time          `json:"window_end"`
+	MatchedTransactionIDs []string           `json:"matched_transaction_ids"`
+	FailedCriterion       RuleType           `json:"failed_criterion,omitempty"`
+	FailedPath            string             `json:"failed_path,omitempty"`
+	Criteria              []CriterionVerdict `json:"criteria"`
+}
+
+type EligibilityExplanationResponse struct {
+	UserID      string         `json:"user_id"`
+	EvaluatedAt time.Time      `json:"evaluated_at"`
+	Offers      []OfferVerdict `json:"offers"`
+}
+
+const (
+	IngestModeStrict     = "strict"
+	IngestModeIdempotent = "idempotent"
+)
+
+type IngestStatus string
+
+const (
+	IngestInserted  IngestStatus = "inserted"
+	IngestDuplicate IngestStatus = "duplicate"
+	IngestConflict  IngestStatus = "conflict"
+)
+
 type CreateTransactionsRequest struct {
+	Mode         string        `json:"mode,omitempty"`
 	Transactions []Transaction `json:"transactions"`
 }
 
+type TransactionError struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
 type CreateTransactionsResponse struct {
-	Inserted int `json:"inserted"`
+	Inserted   int                `json:"inserted"`
+	Duplicates int                `json:"duplicates"`
+	Rejected   int                `json:"rejected"`
+	Errors     []TransactionError `json:"errors,omitempty"`
+}
+
+type BulkImportError struct {
+	Line  int    `json:"line"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+type BulkImportResponse struct {
+	Lines           int               `json:"lines"`
+	Inserted        int               `json:"inserted"`
+	Duplicates      int               `json:"duplicates"`
+	Rejected        int               `json:"rejected"`
+	Chunks          int               `json:"chunks"`
+	Errors          []BulkImportError `json:"errors,omitempty"`
+	ErrorsTruncated bool              `json:"errors_truncated,omitempty"`
+}
+
+type APIKey struct {
+	ID        string     `json:"id"`
+	TenantID  string     `json:"tenant_id"`
+	Name      string     `json:"name"`
+	Roles     []string   `json:"roles"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type WebhookEndpoint struct {
+	ID         string    `json:"id"`
+	TenantID   string    `json:"tenant_id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type CreateWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Secret     string   `json:"secret,omitempty"`
+}
+
+type ListWebhooksResponse struct {
+	Webhooks []WebhookEndpoint `json:"webhooks"`
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryDead      WebhookDeliveryStatus = "dead"
+)
+
+type WebhookDelivery struct {
+	ID             string                `json:"id"`
+	EndpointID     string                `json:"endpoint_id"`
+	TenantID       string                `json:"tenant_id"`
+	EventType      string                `json:"event_type"`
+	Payload        json.RawMessage       `json:"payload"`
+	Status         WebhookDeliveryStatus `json:"status"`
+	Attempts       int                   `json:"attempts"`
+	NextAttemptAt  time.Time             `json:"next_attempt_at"`
+	LastStatusCode int                   `json:"last_status_code,omitempty"`
+	LastError      string                `json:"last_error,omitempty"`
+	CreatedAt      time.Time             `json:"created_at"`
+	UpdatedAt      time.Time             `json:"updated_at"`
+}
+
+type ListWebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+}
+
+type WebhookDeadLetter struct {
+	DeliveryID string          `json:"delivery_id"`
+	EndpointID string          `json:"endpoint_id"`
+	TenantID   string          `json:"tenant_id"`
+	EventType  string          `json:"event_type"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempts   int             `json:"attempts"`
+	LastError  string          `json:"last_error"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type ListWebhookDeadLettersResponse struct {
+	DeadLetters []WebhookDeadLetter `json:"dead_letters"`
+}
+
+// OutboxEvent is an event recorded in the same database transaction as the
+// change it describes, waiting to be relayed to subscribers.
+type OutboxEvent struct {
+	ID            string
+	TenantID      string
+	EventType     string
+	Payload       json.RawMessage
+	Attempts      int
+	LastError     string
+	CreatedAt     time.Time
+	NextAttemptAt time.Time
+	DeliveredAt   *time.Time
+}
+
+// EligibilityState records that a user was last seen eligible for an offer, so
+// changes can be announced once.
+type EligibilityState struct {
+	TenantID      string
+	UserID        string
+	OfferID       string
+	EligibleSince time.Time
+}
+
+// EligibilityChange adds (Eligible) or removes a state row. Outbox is written
+// only if the row actually changed.
+type EligibilityChange struct {
+	State    EligibilityState
+	Eligible bool
+	Outbox   []OutboxEvent
+}
+
+// OfferCheckVerdict is one offer's verdict as recorded in an eligibility check.
+type OfferCheckVerdict struct {
+	OfferID      string `json:"offer_id"`
+	OfferVersion int    `json:"offer_version"`
+	Eligible     bool   `json:"eligible"`
+	Reason       string `json:"reason,omitempty"`
+}
+
+// EligibilityCheck records one answer given to GetEligibleOffers. EvaluatedAt
+// is the `now` the answer was computed for; CheckedAt is when it was given.
+type EligibilityCheck struct {
+	ID          string              `json:"id"`
+	TenantID    string              `json:"-"`
+	UserID      string              `json:"user_id"`
+	EvaluatedAt time.Time           `json:"evaluated_at"`
+	CheckedAt   time.Time           `json:"checked_at"`
+	Offers      []OfferCheckVerdict `json:"offers"`
+}
+
+// EligibilityHistoryFilter selects checks with From <= checked_at < To, newest
+// first. BeforeCheckedAt and BeforeID continue after the last check of a
+// previous page.
+type EligibilityHistoryFilter struct {
+	From            *time.Time
+	To              *time.Time
+	BeforeCheckedAt *time.Time
+	BeforeID        string
+	Limit           int
+}
+
+type EligibilityHistoryResponse struct {
+	UserID     string             `json:"user_id"`
+	Checks     []EligibilityCheck `json:"checks"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// FieldChange is one changed field of an offer revision, as JSON values.
+type FieldChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// OfferRevision is an immutable snapshot of an offer after one change. Diff
+// maps JSON field names to their old and new values; a deletion shows up as
+// the pseudo-field "deleted".
+type OfferRevision struct {
+	OfferID   string                 `json:"offer_id"`
+	Version   int                    `json:"version"`
+	Offer     Offer                  `json:"offer"`
+	Diff      map[string]FieldChange `json:"diff"`
+	Deleted   bool                   `json:"deleted"`
+	ChangedBy string                 `json:"changed_by"`
+	ChangedAt time.Time              `json:"changed_at"`
+}
+
+type ListOfferRevisionsResponse struct {
+	Revisions []OfferRevision `json:"revisions"`
+}
+
+// OfferActivation records that a user opted in to an offer. Only activated
+// offers can be redeemed.
+type OfferActivation struct {
+	TenantID    string    `json:"-"`
+	UserID      string    `json:"user_id"`
+	OfferID     string    `json:"offer_id"`
+	ActivatedAt time.Time `json:"activated_at"`
+}
+
+// Redemption is one use of an activated offer. The counts are the user's and
+// the offer's redemptions including this one; BudgetExhausted reports that
+// this redemption left too little budget for another.
+type Redemption struct {
+	ID                   string    `json:"id"`
+	TenantID             string    `json:"-"`
+	UserID               string    `json:"user_id"`
+	OfferID              string    `json:"offer_id"`
+	RedeemedAt           time.Time `json:"redeemed_at"`
+	RewardCents          int64     `json:"reward_cents"`
+	UserRedemptionCount  int       `json:"user_redemption_count"`
+	OfferRedemptionCount int       `json:"offer_redemption_count"`
+	BudgetExhausted      bool      `json:"budget_exhausted,omitempty"`
+}
+
+type SegmentType string
+
+const (
+	SegmentTypeList SegmentType = "list"
+	SegmentTypeRule SegmentType = "rule"
+)
+
+// Segment is a named group of users that offers can be targeted at. List
+// segments hold explicitly uploaded user IDs; rule segments hold every user
+// whose transactions in the last LookbackDays days satisfy Rule. Thresholds
+// in a segment rule without a merchant selection count every merchant.
+type Segment struct {
+	ID           string      `json:"id"`
+	TenantID     string      `json:"-"`
+	Name         string      `json:"name"`
+	Type         SegmentType `json:"type"`
+	Rule         *Rule       `json:"rule,omitempty"`
+	LookbackDays int         `json:"lookback_days,omitempty"`
+	MemberCount  int         `json:"member_count,omitempty"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
+
+type CreateSegmentRequest struct {
+	Name         string      `json:"name"`
+	Type         SegmentType `json:"type"`
+	Rule         *Rule       `json:"rule,omitempty"`
+	LookbackDays int         `json:"lookback_days,omitempty"`
+}
+
+type ListSegmentsResponse struct {
+	Segments []Segment `json:"segments"`
+}
+
+type SegmentMembersRequest struct {
+	UserIDs []string `json:"user_ids"`
+}
+
+// SegmentMembersResponse reports how many of the requested users were added
+// or removed; users already in (or absent from) the segment are not counted.
+type SegmentMembersResponse struct {
+	SegmentID   string `json:"segment_id"`
+	Changed     int    `json:"changed"`
+	MemberCount int    `json:"member_count"`
+}
+
+// EligibleUser is a user meeting an offer's transaction criteria, with the
+// aggregates of their matching transactions in the lookback window.
+type EligibleUser struct {
+	UserID          string `json:"user_id"`
+	TxnCount        int64  `json:"txn_count"`
+	TotalSpendCents int64  `json:"total_spend_cents"`
+	MaxTxnCents     int64  `json:"max_txn_cents"`
+}
+
+type EligibleUsersResponse struct {
+	OfferID     string         `json:"offer_id"`
+	EvaluatedAt time.Time      `json:"evaluated_at"`
+	TotalCount  int            `json:"total_count"`
+	Users       []EligibleUser `json:"users"`
+	NextCursor  string         `json:"next_cursor,omitempty"`
+}
+
+type ExportStatus string
+
+const (
+	ExportStatusPending   ExportStatus = "pending"
+	ExportStatusRunning   ExportStatus = "running"
+	ExportStatusCompleted ExportStatus = "completed"
+	ExportStatusFailed    ExportStatus = "failed"
+)
+
+// EligibleUserExport is an asynchronous job that stores every user eligible
+// for an offer at EvaluatedAt. UserCount is set once it completes.
+type EligibleUserExport struct {
+	ID          string       `json:"id"`
+	TenantID    string       `json:"-"`
+	OfferID     string       `json:"offer_id"`
+	Status      ExportStatus `json:"status"`
+	EvaluatedAt time.Time    `json:"evaluated_at"`
+	UserCount   int          `json:"user_count"`
+	Error       string       `json:"error,omitempty"`
+	CreatedAt   time.Time    `json:"created_at"`
+	CompletedAt *time.Time   `json:"completed_at,omitempty"`
+}
+
+// SimulateOfferRequest asks how many users an unsaved offer would have
+// qualified on each day from From to To, both inclusive. Offer.ID may be
+// omitted.
+type SimulateOfferRequest struct {
+	Offer Offer     `json:"offer"`
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+}
+
+type SimulationDay struct {
+	Now           time.Time `json:"now"`
+	EligibleUsers int       `json:"eligible_users"`
+}
+
+type SimulateOfferResponse struct {
+	Days []SimulationDay `json:"days"`
+}
+
+// RetentionRun reports one pass of the retention purge: every transaction
+// approved, every eligibility check made and every outbox event delivered
+// before Cutoff was deleted, in Batches statements.
+type RetentionRun struct {
+	Cutoff                  time.Time `json:"cutoff"`
+	TransactionsPurged      int64     `json:"transactions_purged"`
+	EligibilityChecksPurged int64     `json:"eligibility_checks_purged"`
+	OutboxEventsPurged      int64     `json:"outbox_events_purged"`
+	Batches                 int       `json:"batches"`
 }
 
 type ErrorResponse struct {
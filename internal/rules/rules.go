@@ -0,0 +1,405 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+type Result struct {
+	Rule                  models.Rule
+	Eligible              bool
+	Required              int64
+	Found                 int64
+	MatchedTransactionIDs []string
+	Children              []Result
+}
+
+func IsWeekday(day string) bool {
+	_, ok := weekdays[day]
+	return ok
+}
+
+// DefaultRule is the rule an offer without an explicit rule tree is evaluated
+// with: at least min_txn_count transactions matching merchant_id or
+// mcc_whitelist, plus the optional min_spend_cents and min_txn_amount_cents
+// thresholds over the same transactions.
+func DefaultRule(offer models.Offer) models.Rule {
+	countRule := models.Rule{
+		Type:  models.RuleMinTxnCount,
+		Value: int64(offer.MinTxnCount),
+	}
+
+	if offer.MinSpendCents == 0 && offer.MinTxnAmountCents == 0 {
+		return countRule
+	}
+
+	rule := models.Rule{
+		Type:  models.RuleAnd,
+		Rules: []models.Rule{countRule},
+	}
+	if offer.MinSpendCents > 0 {
+		rule.Rules = append(rule.Rules, models.Rule{Type: models.RuleMinSpendCents, Value: offer.MinSpendCents})
+	}
+	if offer.MinTxnAmountCents > 0 {
+		rule.Rules = append(rule.Rules, models.Rule{Type: models.RuleMinTxnAmountCents, Value: offer.MinTxnAmountCents})
+	}
+	return rule
+}
+
+// MeetsThresholds reports whether a summary of the offer's matching
+// transactions satisfies DefaultRule(offer), without building the rule.
+func MeetsThresholds(offer models.Offer, summary models.TransactionSummary) bool {
+	return summary.Count >= offer.MinTxnCount &&
+		(offer.MinSpendCents == 0 || summary.TotalCents >= offer.MinSpendCents) &&
+		(offer.MinTxnAmountCents == 0 || summary.MaxCents >= offer.MinTxnAmountCents)
+}
+
+func RuleFor(offer models.Offer) models.Rule {
+	if offer.Rules != nil {
+		return *offer.Rules
+	}
+	return DefaultRule(offer)
+}
+
+// LookbackWindow returns the inclusive window an offer's rules aggregate over.
+// Timestamps are stored with second precision, so both ends are truncated to
+// the second to keep in-memory and SQL evaluation identical.
+func LookbackWindow(offer models.Offer, now time.Time) (time.Time, time.Time) {
+	end := now.Truncate(time.Second)
+	start := now.AddDate(0, 0, -offer.LookbackDays).Truncate(time.Second)
+	return start, end
+}
+
+// Evaluate evaluates the offer's rule against the transactions in its
+// lookback window. Results do not list matched transactions; use Explain for
+// those.
+func Evaluate(offer models.Offer, transactions []models.Transaction, now time.Time) Result {
+	return evaluate(RuleFor(offer), offer, inWindow(offer, transactions, now), false)
+}
+
+// Explain is Evaluate with the IDs of the transactions each criterion matched
+// listed in MatchedTransactionIDs.
+func Explain(offer models.Offer, transactions []models.Transaction, now time.Time) Result {
+	return evaluate(RuleFor(offer), offer, inWindow(offer, transactions, now), true)
+}
+
+// EvaluateSegment evaluates a rule segment against the user's transactions
+// in the segment's lookback window. A segment has no merchant to inherit, so
+// thresholds without a merchant selection match every merchant.
+func EvaluateSegment(segment models.Segment, transactions []models.Transaction, now time.Time) Result {
+	offer := models.Offer{LookbackDays: segment.LookbackDays}
+	var rule models.Rule
+	if segment.Rule != nil {
+		rule = anyMerchantByDefault(*segment.Rule)
+	}
+	return evaluate(rule, offer, inWindow(offer, transactions, now), false)
+}
+
+func anyMerchantByDefault(rule models.Rule) models.Rule {
+	if len(rule.Rules) > 0 {
+		children := make([]models.Rule, len(rule.Rules))
+		for i, child := range rule.Rules {
+			children[i] = anyMerchantByDefault(child)
+		}
+		rule.Rules = children
+		return rule
+	}
+
+	var match models.TransactionMatch
+	if rule.Match != nil {
+		match = *rule.Match
+	}
+	if len(match.MerchantIDs) == 0 && len(match.MCCs) == 0 {
+		match.AnyMerchant = true
+	}
+	rule.Match = &match
+	return rule
+}
+
+// Summarize aggregates the transactions matching the offer's merchant_id or
+// mcc_whitelist in its lookback window, like
+// database.SummarizeMatchingTransactions does in SQL. It makes a single pass
+// and allocates nothing, so it is the cheap way to check offers without a
+// rule tree; see MeetsThresholds.
+func Summarize(offer models.Offer, transactions []models.Transaction, now time.Time) models.TransactionSummary {
+	start, end := LookbackWindow(offer, now)
+	m := newMatcher(nil, offer)
+
+	var summary models.TransactionSummary
+	for i := range transactions {
+		txn := &transactions[i]
+		if txn.ApprovedAt.Before(start) || txn.ApprovedAt.After(end) || !m.matches(txn) {
+			continue
+		}
+		summary.Count++
+		summary.TotalCents += txn.AmountCents
+		if txn.AmountCents > summary.MaxCents {
+			summary.MaxCents = txn.AmountCents
+		}
+	}
+	return summary
+}
+
+// inWindow returns the transactions in the offer's lookback window. Loaded
+// transactions are ordered by approved_at, so the window is usually a
+// contiguous run that is returned without copying.
+func inWindow(offer models.Offer, transactions []models.Transaction, now time.Time) []models.Transaction {
+	start, end := LookbackWindow(offer, now)
+
+	first, last := -1, -1
+	contiguous := true
+	for i := range transactions {
+		if transactions[i].ApprovedAt.Before(start) || transactions[i].ApprovedAt.After(end) {
+			continue
+		}
+		if first == -1 {
+			first = i
+		} else if last != i-1 {
+			contiguous = false
+			break
+		}
+		last = i
+	}
+	if first == -1 {
+		return nil
+	}
+	if contiguous {
+		return transactions[first : last+1 : last+1]
+	}
+
+	var result []models.Transaction
+	for _, txn := range transactions[first:] {
+		if txn.ApprovedAt.Before(start) || txn.ApprovedAt.After(end) {
+			continue
+		}
+		result = append(result, txn)
+	}
+	return result
+}
+
+func evaluate(rule models.Rule, offer models.Offer, transactions []models.Transaction, explain bool) Result {
+	result := Result{Rule: rule}
+
+	switch rule.Type {
+	case models.RuleAnd:
+		result.Eligible = true
+		for _, child := range rule.Rules {
+			childResult := evaluate(child, offer, transactions, explain)
+			result.Children = append(result.Children, childResult)
+			result.Eligible = result.Eligible && childResult.Eligible
+		}
+	case models.RuleOr:
+		for _, child := range rule.Rules {
+			childResult := evaluate(child, offer, transactions, explain)
+			result.Children = append(result.Children, childResult)
+			result.Eligible = result.Eligible || childResult.Eligible
+		}
+	case models.RuleNot:
+		if len(rule.Rules) == 1 {
+			childResult := evaluate(rule.Rules[0], offer, transactions, explain)
+			result.Children = append(result.Children, childResult)
+			result.Eligible = !childResult.Eligible
+		}
+	default:
+		matched := filterTransactions(rule.Match, offer, transactions)
+		result.Required = rule.Value
+		result.Found = aggregate(rule.Type, matched)
+		result.Eligible = result.Found >= result.Required
+		if explain {
+			for _, txn := range matched {
+				result.MatchedTransactionIDs = append(result.MatchedTransactionIDs, txn.ID)
+			}
+		}
+	}
+
+	return result
+}
+
+func aggregate(ruleType models.RuleType, transactions []models.Transaction) int64 {
+	switch ruleType {
+	case models.RuleMinTxnCount:
+		return int64(len(transactions))
+	case models.RuleMinSpendCents:
+		var total int64
+		for _, txn := range transactions {
+			total += txn.AmountCents
+		}
+		return total
+	case models.RuleMinTxnAmountCents:
+		var largest int64
+		for _, txn := range transactions {
+			if txn.AmountCents > largest {
+				largest = txn.AmountCents
+			}
+		}
+		return largest
+	case models.RuleMinDistinctMerchants:
+		merchants := make(map[string]bool)
+		for _, txn := range transactions {
+			merchants[txn.MerchantID] = true
+		}
+		return int64(len(merchants))
+	default:
+		return 0
+	}
+}
+
+// matcher selects transactions by a criterion's match, falling back to the
+// offer's merchant_id and mcc_whitelist. The lists are short, so they are
+// scanned rather than turned into sets for every offer.
+type matcher struct {
+	anyMerchant bool
+	merchantIDs []string
+	mccs        []string
+	excludeMCCs []string
+	days        [7]bool
+	anyDay      bool
+}
+
+func newMatcher(match *models.TransactionMatch, offer models.Offer) matcher {
+	var m models.TransactionMatch
+	if match != nil {
+		m = *match
+	}
+
+	result := matcher{
+		anyMerchant: m.AnyMerchant,
+		merchantIDs: m.MerchantIDs,
+		mccs:        m.MCCs,
+		excludeMCCs: m.ExcludeMCCs,
+		anyDay:      len(m.DaysOfWeek) == 0,
+	}
+	if !m.AnyMerchant && len(m.MerchantIDs) == 0 && len(m.MCCs) == 0 {
+		result.merchantIDs = []string{offer.MerchantID}
+		result.mccs = offer.MCCWhitelist
+	}
+	for _, day := range m.DaysOfWeek {
+		result.days[weekdays[day]] = true
+	}
+	return result
+}
+
+func (m *matcher) matches(txn *models.Transaction) bool {
+	if !m.anyMerchant && !contains(m.merchantIDs, txn.MerchantID) && !contains(m.mccs, txn.MCC) {
+		return false
+	}
+	if contains(m.excludeMCCs, txn.MCC) {
+		return false
+	}
+	return m.anyDay || m.days[txn.ApprovedAt.UTC().Weekday()]
+}
+
+func filterTransactions(match *models.TransactionMatch, offer models.Offer, transactions []models.Transaction) []models.Transaction {
+	m := newMatcher(match, offer)
+
+	var matched []models.Transaction
+	for i := range transactions {
+		if m.matches(&transactions[i]) {
+			matched = append(matched, transactions[i])
+		}
+	}
+
+	return matched
+}
+
+func Describe(result Result) string {
+	return describe(result, false)
+}
+
+func describe(result Result, nested bool) string {
+	switch result.Rule.Type {
+	case models.RuleAnd, models.RuleOr:
+		parts := make([]string, len(result.Children))
+		for i, child := range result.Children {
+			parts[i] = describe(child, true)
+		}
+		joined := strings.Join(parts, " "+string(result.Rule.Type)+" ")
+		if nested && len(parts) > 1 {
+			return "(" + joined + ")"
+		}
+		return joined
+	case models.RuleNot:
+		if len(result.Children) == 1 {
+			return "not " + describe(result.Children[0], true)
+		}
+		return "not ()"
+	default:
+		return fmt.Sprintf("%s >= %d (found %d)", result.Rule.Type, result.Required, result.Found)
+	}
+}
+
+// Criteria flattens a result tree into its leaf criteria. Paths use the same
+// notation as validation errors, rooted at "rules".
+func Criteria(result Result) []models.CriterionVerdict {
+	var criteria []models.CriterionVerdict
+	collectCriteria(result, "rules", &criteria)
+	return criteria
+}
+
+func collectCriteria(result Result, path string, criteria *[]models.CriterionVerdict) {
+	switch result.Rule.Type {
+	case models.RuleAnd, models.RuleOr, models.RuleNot:
+		for i, child := range result.Children {
+			collectCriteria(child, fmt.Sprintf("%s.rules[%d]", path, i), criteria)
+		}
+	default:
+		matched := result.MatchedTransactionIDs
+		if matched == nil {
+			matched = []string{}
+		}
+		*criteria = append(*criteria, models.CriterionVerdict{
+			Path:                  path,
+			Criterion:             result.Rule.Type,
+			Required:              result.Required,
+			Found:                 result.Found,
+			Passed:                result.Eligible,
+			MatchedTransactionIDs: matched,
+		})
+	}
+}
+
+// FailedCriterion returns the path and type of the criterion that made an
+// ineligible result fail, or "" if the result is eligible. For "and" that is
+// the first failing child; an "or" fails on its first child since all of them
+// failed; a "not" fails on itself because its child passed.
+func FailedCriterion(result Result) (string, models.RuleType) {
+	return failedCriterion(result, "rules")
+}
+
+func failedCriterion(result Result, path string) (string, models.RuleType) {
+	if result.Eligible {
+		return "", ""
+	}
+
+	if result.Rule.Type == models.RuleAnd || result.Rule.Type == models.RuleOr {
+		for i, child := range result.Children {
+			if !child.Eligible {
+				return failedCriterion(child, fmt.Sprintf("%s.rules[%d]", path, i))
+			}
+		}
+	}
+
+	return path, result.Rule.Type
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+)
+
+const (
+	merchantA = "0b29823e-667e-4bf5-84d7-8eb39973a401"
+	merchantB = "a2d1e1a9-8b0c-4a6a-9b3a-2f9f1e0d9c11"
+	merchantC = "77777777-1111-4222-8333-444444444444"
+)
+
+func testTransactions() []models.Transaction {
+	// 2025-10-20 is a Monday, 2025-10-18 a Saturday.
+	return []models.Transaction{
+		{ID: "t1", MerchantID: merchantA, MCC: "5812", AmountCents: 1000, ApprovedAt: time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC)},
+		{ID: "t2", MerchantID: merchantB, MCC: "5814", AmountCents: 2500, ApprovedAt: time.Date(2025, 10, 18, 12, 0, 0, 0, time.UTC)},
+		{ID: "t3", MerchantID: merchantC, MCC: "5541", AmountCents: 4000, ApprovedAt: time.Date(2025, 10, 18, 15, 0, 0, 0, time.UTC)},
+		{ID: "t4", MerchantID: merchantA, MCC: "5812", AmountCents: 9000, ApprovedAt: time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+
+	baseOffer := models.Offer{
+		MerchantID:   merchantA,
+		MCCWhitelist: []string{"5814"},
+		MinTxnCount:  2,
+		LookbackDays: 30,
+	}
+
+	tests := []struct {
+		name     string
+		rules    *models.Rule
+		eligible bool
+		found    int64
+	}{
+		{
+			name:     "default rule counts merchant or whitelist matches in window",
+			rules:    nil,
+			eligible: true,
+			found:    2,
+		},
+		{
+			name:     "min spend over default match",
+			rules:    &models.Rule{Type: models.RuleMinSpendCents, Value: 4000},
+			eligible: false,
+			found:    3500,
+		},
+		{
+			name:     "min spend at any merchant",
+			rules:    &models.Rule{Type: models.RuleMinSpendCents, Value: 7500, Match: &models.TransactionMatch{AnyMerchant: true}},
+			eligible: true,
+			found:    7500,
+		},
+		{
+			name:     "largest single transaction",
+			rules:    &models.Rule{Type: models.RuleMinTxnAmountCents, Value: 2000, Match: &models.TransactionMatch{AnyMerchant: true}},
+			eligible: true,
+			found:    4000,
+		},
+		{
+			name:     "distinct merchants excluding fuel",
+			rules:    &models.Rule{Type: models.RuleMinDistinctMerchants, Value: 3, Match: &models.TransactionMatch{AnyMerchant: true, ExcludeMCCs: []string{"5541"}}},
+			eligible: false,
+			found:    2,
+		},
+		{
+			name:     "weekend transactions only",
+			rules:    &models.Rule{Type: models.RuleMinTxnCount, Value: 2, Match: &models.TransactionMatch{AnyMerchant: true, DaysOfWeek: []string{"saturday", "sunday"}}},
+			eligible: true,
+			found:    2,
+		},
+		{
+			name: "and requires every child",
+			rules: &models.Rule{Type: models.RuleAnd, Rules: []models.Rule{
+				{Type: models.RuleMinTxnCount, Value: 1},
+				{Type: models.RuleMinSpendCents, Value: 100000},
+			}},
+			eligible: false,
+		},
+		{
+			name: "or requires any child",
+			rules: &models.Rule{Type: models.RuleOr, Rules: []models.Rule{
+				{Type: models.RuleMinTxnCount, Value: 1},
+				{Type: models.RuleMinSpendCents, Value: 100000},
+			}},
+			eligible: true,
+		},
+		{
+			name: "not inverts its child",
+			rules: &models.Rule{Type: models.RuleNot, Rules: []models.Rule{
+				{Type: models.RuleMinTxnCount, Value: 1, Match: &models.TransactionMatch{MCCs: []string{"5541"}}},
+			}},
+			eligible: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offer := baseOffer
+			offer.Rules = tt.rules
+
+			result := Evaluate(offer, testTransactions(), now)
+
+			if result.Eligible != tt.eligible {
+				t.Errorf("Expected eligible=%v, got %v (%s)", tt.eligible, result.Eligible, Describe(result))
+			}
+
+			if tt.found != 0 && result.Found != tt.found {
+				t.Errorf("Expected found=%d, got %d", tt.found, result.Found)
+			}
+		})
+	}
+}
+
+func TestEvaluateSegment(t *testing.T) {
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		segment  models.Segment
+		eligible bool
+	}{
+		{
+			name: "thresholds without a merchant count every merchant",
+			segment: models.Segment{LookbackDays: 30, Rule: &models.Rule{Type: models.RuleAnd, Rules: []models.Rule{
+				{Type: models.RuleMinDistinctMerchants, Value: 3},
+				{Type: models.RuleMinSpendCents, Value: 7500, Match: &models.TransactionMatch{DaysOfWeek: []string{"saturday", "monday"}}},
+			}}},
+			eligible: true,
+		},
+		{
+			name:     "explicit merchant selection is kept",
+			segment:  models.Segment{LookbackDays: 30, Rule: &models.Rule{Type: models.RuleMinTxnCount, Value: 2, Match: &models.TransactionMatch{MerchantIDs: []string{merchantA}}}},
+			eligible: false,
+		},
+		{
+			name:     "lookback window applies",
+			segment:  models.Segment{LookbackDays: 120, Rule: &models.Rule{Type: models.RuleMinTxnCount, Value: 2, Match: &models.TransactionMatch{MerchantIDs: []string{merchantA}}}},
+			eligible: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := EvaluateSegment(tt.segment, testTransactions(), now)
+			if result.Eligible != tt.eligible {
+				t.Errorf("Expected eligible=%v, got %v (%s)", tt.eligible, result.Eligible, Describe(result))
+			}
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+
+	offer := models.Offer{
+		MerchantID:   merchantA,
+		LookbackDays: 30,
+		Rules: &models.Rule{Type: models.RuleAnd, Rules: []models.Rule{
+			{Type: models.RuleMinTxnCount, Value: 1},
+			{Type: models.RuleOr, Rules: []models.Rule{
+				{Type: models.RuleMinSpendCents, Value: 500},
+				{Type: models.RuleMinDistinctMerchants, Value: 2},
+			}},
+		}},
+	}
+
+	got := Describe(Evaluate(offer, testTransactions(), now))
+	want := "min_txn_count >= 1 (found 1) and (min_spend_cents >= 500 (found 1000) or min_distinct_merchants >= 2 (found 1))"
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestFailedCriterion(t *testing.T) {
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		rules     *models.Rule
+		path      string
+		criterion models.RuleType
+	}{
+		{
+			name:  "eligible has no failed criterion",
+			rules: &models.Rule{Type: models.RuleMinTxnCount, Value: 1},
+		},
+		{
+			name: "first failing child of and",
+			rules: &models.Rule{Type: models.RuleAnd, Rules: []models.Rule{
+				{Type: models.RuleMinTxnCount, Value: 1},
+				{Type: models.RuleOr, Rules: []models.Rule{
+					{Type: models.RuleMinSpendCents, Value: 100000},
+					{Type: models.RuleMinDistinctMerchants, Value: 5},
+				}},
+			}},
+			path:      "rules.rules[1].rules[0]",
+			criterion: models.RuleMinSpendCents,
+		},
+		{
+			name: "not fails on itself",
+			rules: &models.Rule{Type: models.RuleNot, Rules: []models.Rule{
+				{Type: models.RuleMinTxnCount, Value: 1},
+			}},
+			path:      "rules",
+			criterion: models.RuleNot,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offer := models.Offer{MerchantID: merchantA, LookbackDays: 30, Rules: tt.rules}
+
+			path, criterion := FailedCriterion(Evaluate(offer, testTransactions(), now))
+			if path != tt.path || criterion != tt.criterion {
+				t.Errorf("Expected %s at %q, got %s at %q", tt.criterion, tt.path, criterion, path)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/validation"
+)
+
+const (
+	defaultBatchMaxUsers = 1000
+	defaultBatchWorkers  = 8
+)
+
+// SetBatchLimits sets how many users a batch eligibility request may name and
+// how many of them are evaluated at once.
+func (s *Service) SetBatchLimits(maxUsers, workers int) {
+	if maxUsers > 0 {
+		s.batchMaxUsers = maxUsers
+	}
+	if workers > 0 {
+		s.batchWorkers = workers
+	}
+}
+
+// BatchEligibility evaluates every user against a single load of the active
+// offers, with at most the configured number of users in flight. Each user is
+// checked exactly like GetEligibleOffers, including the cache and the
+// eligibility history. Results are passed to emit from the calling goroutine
+// in completion order; a user that fails to evaluate gets a result with Error
+// set. An error from emit stops the batch and is returned.
+func (s *Service) BatchEligibility(ctx context.Context, userIDs []string, now time.Time, emit func(models.BatchEligibilityResult) error) error {
+	if err := validation.ValidateBatchEligibilityRequest(models.BatchEligibilityRequest{UserIDs: userIDs}, s.batchMaxUsers); err != nil {
+		return err
+	}
+
+	activeOffers, err := s.getActiveOffers(ctx, now)
+	if err != nil {
+		return fmt.Errorf("failed to get active offers: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan string)
+	go func() {
+		defer close(jobs)
+		for _, userID := range userIDs {
+			select {
+			case jobs <- userID:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	workers := s.batchWorkers
+	if workers > len(userIDs) {
+		workers = len(userIDs)
+	}
+
+	results := make(chan models.BatchEligibilityResult)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for userID := range jobs {
+				select {
+				case results <- s.batchResult(ctx, userID, now, activeOffers):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	for result := range results {
+		if err := emit(result); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+func (s *Service) batchResult(ctx context.Context, userID string, now time.Time, activeOffers []models.Offer) models.BatchEligibilityResult {
+	cacheKey, response, ok := s.lookupEligibility(ctx, userID, now)
+	if !ok {
+		var err error
+		response, err = s.evaluateEligibility(ctx, userID, now, activeOffers, cacheKey)
+		if err != nil {
+			return models.BatchEligibilityResult{UserID: userID, Error: err.Error()}
+		}
+	}
+
+	eligibleOffers := response.EligibleOffers
+	if eligibleOffers == nil {
+		eligibleOffers = []models.EligibleOffer{}
+	}
+	return models.BatchEligibilityResult{UserID: userID, EligibleOffers: eligibleOffers}
+}
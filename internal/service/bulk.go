@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/validation"
+)
+
+const (
+	defaultBulkChunkSize = 500
+	maxBulkImportErrors  = 1000
+)
+
+func (s *Service) SetBulkChunkSize(size int) {
+	if size > 0 {
+		s.bulkChunkSize = size
+	}
+}
+
+// BulkImport ingests a stream of transactions in chunks of the configured
+// size. Each chunk is committed idempotently on its own, so a failed import can
+// be re-run from the start: already committed lines count as duplicates. The
+// users behind inserted transactions are reconciled once, in the background,
+// when the import finishes.
+type BulkImport struct {
+	service *Service
+	ctx     context.Context
+	chunk   []models.Transaction
+	lines   []int
+	users   map[string]bool
+	summary models.BulkImportResponse
+}
+
+func (s *Service) NewBulkImport(ctx context.Context) *BulkImport {
+	return &BulkImport{
+		service: s,
+		ctx:     ctx,
+		chunk:   make([]models.Transaction, 0, s.bulkChunkSize),
+		lines:   make([]int, 0, s.bulkChunkSize),
+		users:   make(map[string]bool),
+	}
+}
+
+// Add validates the transaction read from line and buffers it, committing the
+// chunk once it is full. Only storage failures are returned; invalid and
+// conflicting transactions are recorded in the summary.
+func (b *BulkImport) Add(line int, txn models.Transaction) error {
+	b.summary.Lines++
+
+	if err := validation.ValidateTransaction(txn); err != nil {
+		b.reject(line, txn.ID, err.Error())
+		return nil
+	}
+
+	b.chunk = append(b.chunk, txn)
+	b.lines = append(b.lines, line)
+
+	if len(b.chunk) >= b.service.bulkChunkSize {
+		return b.flush()
+	}
+	return nil
+}
+
+// Reject records a line that could not be decoded into a transaction.
+func (b *BulkImport) Reject(line int, message string) {
+	b.summary.Lines++
+	b.reject(line, "", message)
+}
+
+// Finish commits the last partial chunk, starts refreshing the eligibility of
+// the users whose transactions were inserted and returns the import summary.
+// Committed chunks are refreshed even when the last one fails.
+func (b *BulkImport) Finish() (models.BulkImportResponse, error) {
+	err := b.flush()
+
+	userIDs := make([]string, 0, len(b.users))
+	for userID := range b.users {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	b.service.refreshEligibilityAsync(b.ctx, userIDs)
+
+	sort.Slice(b.summary.Errors, func(i, j int) bool {
+		return b.summary.Errors[i].Line < b.summary.Errors[j].Line
+	})
+
+	return b.summary, err
+}
+
+func (b *BulkImport) flush() error {
+	if len(b.chunk) == 0 {
+		return nil
+	}
+
+	statuses, err := b.service.insertIdempotent(b.ctx, b.chunk)
+	if err != nil {
+		return fmt.Errorf("failed to commit chunk ending at line %d: %w", b.lines[len(b.lines)-1], err)
+	}
+
+	b.summary.Chunks++
+	for i, status := range statuses {
+		switch status {
+		case models.IngestInserted:
+			b.summary.Inserted++
+			b.users[b.chunk[i].UserID] = true
+		case models.IngestDuplicate:
+			b.summary.Duplicates++
+		case models.IngestConflict:
+			b.reject(b.lines[i], b.chunk[i].ID,
+				fmt.Sprintf("transaction %s already exists with a different payload", b.chunk[i].ID))
+		}
+	}
+
+	b.chunk = b.chunk[:0]
+	b.lines = b.lines[:0]
+	return nil
+}
+
+func (b *BulkImport) reject(line int, id, message string) {
+	b.summary.Rejected++
+	if len(b.summary.Errors) >= maxBulkImportErrors {
+		b.summary.ErrorsTruncated = true
+		return
+	}
+	b.summary.Errors = append(b.summary.Errors, models.BulkImportError{Line: line, ID: id, Error: message})
+}
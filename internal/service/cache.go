@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"offer-eligibility-api/internal/cache"
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
+)
+
+// Cached entries are keyed on a time bucket rather than the exact `now`, so a
+// cached answer may lag an offer window boundary by at most one bucket. Writes
+// never serve stale data: they bump a version that is part of every key.
+// Every key includes the tenant so tenants never share entries.
+const eligibilityBucket = time.Minute
+
+func (s *Service) SetCache(c cache.Cache, ttl time.Duration) {
+	s.cache = c
+	s.cacheTTL = ttl
+}
+
+func (s *Service) getActiveOffers(ctx context.Context, now time.Time) ([]models.Offer, error) {
+	tenantID := tenant.FromContext(ctx)
+	if s.cache == nil {
+		return s.db.GetActiveOffers(tenantID, now)
+	}
+
+	key := fmt.Sprintf("offers:active:%s:%s:%d", tenantID, s.cacheVersion(ctx, offersVersionKey(tenantID)), bucketOf(now))
+
+	var offers []models.Offer
+	if err := cache.GetJSON(ctx, s.cache, key, &offers); err == nil {
+		return offers, nil
+	} else if !errors.Is(err, cache.ErrNotFound) {
+		log.Printf("cache: failed to read %s: %v", key, err)
+	}
+
+	offers, err := s.db.GetActiveOffers(tenantID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cache.SetJSON(ctx, s.cache, key, offers, s.cacheTTL); err != nil {
+		log.Printf("cache: failed to write %s: %v", key, err)
+	}
+
+	return offers, nil
+}
+
+func (s *Service) eligibilityCacheKey(ctx context.Context, userID string, now time.Time) string {
+	tenantID := tenant.FromContext(ctx)
+	return fmt.Sprintf("eligibility:%s:%s:%s:%s:%d",
+		tenantID,
+		userID,
+		s.cacheVersion(ctx, offersVersionKey(tenantID)),
+		s.cacheVersion(ctx, userVersionKey(tenantID, userID)),
+		bucketOf(now),
+	)
+}
+
+// cachedEligibility keeps the full verdicts and the time they were evaluated
+// for next to the response, so a cache hit is recorded in the eligibility
+// history as the evaluation it reuses.
+type cachedEligibility struct {
+	Response    models.EligibleOffersResponse `json:"response"`
+	Verdicts    []models.OfferCheckVerdict    `json:"verdicts"`
+	EvaluatedAt time.Time                     `json:"evaluated_at"`
+}
+
+func (s *Service) getCachedEligibility(ctx context.Context, key string) (cachedEligibility, bool) {
+	var cached cachedEligibility
+	if err := cache.GetJSON(ctx, s.cache, key, &cached); err != nil {
+		if !errors.Is(err, cache.ErrNotFound) {
+			log.Printf("cache: failed to read %s: %v", key, err)
+		}
+		return cachedEligibility{}, false
+	}
+	return cached, true
+}
+
+func (s *Service) setCachedEligibility(ctx context.Context, key string, cached cachedEligibility) {
+	if err := cache.SetJSON(ctx, s.cache, key, cached, s.cacheTTL); err != nil {
+		log.Printf("cache: failed to write %s: %v", key, err)
+	}
+}
+
+func (s *Service) invalidateOffers(ctx context.Context) {
+	if s.cache == nil {
+		return
+	}
+	s.bumpCacheVersion(ctx, offersVersionKey(tenant.FromContext(ctx)))
+}
+
+func (s *Service) invalidateUsers(ctx context.Context, transactions []models.Transaction) {
+	if s.cache == nil {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, txn := range transactions {
+		key := userVersionKey(txn.TenantID, txn.UserID)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		s.bumpCacheVersion(ctx, key)
+	}
+}
+
+func (s *Service) invalidateUser(ctx context.Context, userID string) {
+	if s.cache == nil {
+		return
+	}
+	s.bumpCacheVersion(ctx, userVersionKey(tenant.FromContext(ctx), userID))
+}
+
+func (s *Service) cacheVersion(ctx context.Context, key string) string {
+	version, err := s.cache.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, cache.ErrNotFound) {
+			log.Printf("cache: failed to read %s: %v", key, err)
+		}
+		return "0"
+	}
+	return string(version)
+}
+
+// The version key lives exactly as long as the entries it guards, so an entry
+// written under an older version always expires before that version can be
+// observed again.
+func (s *Service) bumpCacheVersion(ctx context.Context, key string) {
+	version := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err := s.cache.Set(ctx, key, []byte(version), s.cacheTTL); err != nil {
+		log.Printf("cache: failed to invalidate %s: %v", key, err)
+	}
+}
+
+func offersVersionKey(tenantID string) string {
+	return "offers:" + tenantID + ":version"
+}
+
+func userVersionKey(tenantID, userID string) string {
+	return "user:" + tenantID + ":" + userID + ":version"
+}
+
+func bucketOf(now time.Time) int64 {
+	return now.Truncate(eligibilityBucket).Unix()
+}
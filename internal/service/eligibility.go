@@ -0,0 +1,84 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/rules"
+)
+
+func maxLookbackDays(offers []models.Offer) int {
+	maxDays := 0
+	for _, offer := range offers {
+		if offer.LookbackDays > maxDays {
+			maxDays = offer.LookbackDays
+		}
+	}
+	return maxDays
+}
+
+// evaluateOffer reports whether the user is eligible and why. Offers without a
+// rule tree are checked with one pass over the transactions, which also
+// yields the figures for the reason.
+func evaluateOffer(offer models.Offer, transactions []models.Transaction, now time.Time) (bool, string) {
+	if offer.Rules == nil {
+		summary := rules.Summarize(offer, transactions, now)
+		if !rules.MeetsThresholds(offer, summary) {
+			return false, ""
+		}
+		reason := fmt.Sprintf(">= %d matching transactions in last %d days (found %d, spent %d cents)",
+			offer.MinTxnCount, offer.LookbackDays, summary.Count, summary.TotalCents)
+		if offer.MinSpendCents > 0 {
+			reason += fmt.Sprintf("; spend >= %d cents", offer.MinSpendCents)
+		}
+		if offer.MinTxnAmountCents > 0 {
+			reason += fmt.Sprintf("; single transaction >= %d cents (largest %d cents)",
+				offer.MinTxnAmountCents, summary.MaxCents)
+		}
+		return true, reason
+	}
+
+	result := rules.Evaluate(offer, transactions, now)
+	if !result.Eligible {
+		return false, ""
+	}
+	return true, fmt.Sprintf("%s in last %d days", rules.Describe(result), offer.LookbackDays)
+}
+
+// explainOffer reports the offer's transaction count criterion as the headline
+// required/found pair; every other criterion is listed in Criteria.
+func explainOffer(offer models.Offer, transactions []models.Transaction, now time.Time) models.OfferVerdict {
+	result := rules.Explain(offer, transactions, now)
+	start, end := rules.LookbackWindow(offer, now)
+	failedPath, failedCriterion := rules.FailedCriterion(result)
+
+	verdict := models.OfferVerdict{
+		OfferID:               offer.ID,
+		Eligible:              result.Eligible,
+		WindowStart:           start,
+		WindowEnd:             end,
+		MatchedTransactionIDs: []string{},
+		FailedCriterion:       failedCriterion,
+		FailedPath:            failedPath,
+		Criteria:              rules.Criteria(result),
+	}
+
+	countFound := false
+	seen := make(map[string]bool)
+	for _, criterion := range verdict.Criteria {
+		if criterion.Criterion == models.RuleMinTxnCount && !countFound {
+			verdict.RequiredCount = criterion.Required
+			verdict.FoundCount = criterion.Found
+			countFound = true
+		}
+		for _, id := range criterion.MatchedTransactionIDs {
+			if !seen[id] {
+				seen[id] = true
+				verdict.MatchedTransactionIDs = append(verdict.MatchedTransactionIDs, id)
+			}
+		}
+	}
+
+	return verdict
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"offer-eligibility-api/internal/database"
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/rules"
+	"offer-eligibility-api/internal/tenant"
+	"offer-eligibility-api/internal/validation"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultEligibleUsersLimit = 50
+	maxEligibleUsersLimit     = 500
+
+	// exportPageSize is how many rows of a completed export are read at once
+	// while it is downloaded.
+	exportPageSize = 500
+	// exportClaimTimeout is how long a running export may go without
+	// completing before another worker claims it again.
+	exportClaimTimeout = 15 * time.Minute
+)
+
+// ListEligibleUsers returns a page of the users meeting the offer's
+// transaction criteria at now, ordered by user ID, with the total across all
+// pages. The cursor is the NextCursor of a previous page and carries that
+// page's evaluation time, so every page sees the same lookback window. Offers
+// with a rule tree or targeting a rule segment cannot be listed and are
+// reported as ErrConflict.
+func (s *Service) ListEligibleUsers(ctx context.Context, offerID string, now time.Time, limit int, cursor string) (models.EligibleUsersResponse, error) {
+	afterUserID := ""
+	if cursor != "" {
+		evaluatedAt, userID, err := decodeEligibleUsersCursor(cursor)
+		if err != nil {
+			return models.EligibleUsersResponse{}, &validation.ValidationError{Field: "cursor", Message: "is not a valid cursor"}
+		}
+		now = evaluatedAt
+		afterUserID = userID
+	}
+	now = now.UTC().Truncate(time.Second)
+
+	offer, err := s.reverseLookupOffer(ctx, offerID)
+	if err != nil {
+		return models.EligibleUsersResponse{}, err
+	}
+
+	switch {
+	case limit <= 0:
+		limit = defaultEligibleUsersLimit
+	case limit > maxEligibleUsersLimit:
+		limit = maxEligibleUsersLimit
+	}
+
+	from, to := rules.LookbackWindow(offer, now)
+	total, err := s.db.CountEligibleUsers(offer, from, to)
+	if err != nil {
+		return models.EligibleUsersResponse{}, err
+	}
+
+	// One extra row tells whether there is another page.
+	users, err := s.db.ListEligibleUsers(offer, from, to, afterUserID, limit+1)
+	if err != nil {
+		return models.EligibleUsersResponse{}, err
+	}
+
+	response := models.EligibleUsersResponse{
+		OfferID:     offer.ID,
+		EvaluatedAt: now,
+		TotalCount:  total,
+		Users:       users,
+	}
+	if len(users) > limit {
+		response.Users = users[:limit]
+		response.NextCursor = encodeEligibleUsersCursor(now, response.Users[limit-1].UserID)
+	}
+	if response.Users == nil {
+		response.Users = []models.EligibleUser{}
+	}
+
+	return response, nil
+}
+
+// CreateEligibleUserExport queues an export of every user eligible for the
+// offer at now. The export runs in the background; poll it with
+// GetEligibleUserExport.
+func (s *Service) CreateEligibleUserExport(ctx context.Context, offerID string, now time.Time) (models.EligibleUserExport, error) {
+	offer, err := s.reverseLookupOffer(ctx, offerID)
+	if err != nil {
+		return models.EligibleUserExport{}, err
+	}
+
+	export := models.EligibleUserExport{
+		ID:          uuid.New().String(),
+		TenantID:    offer.TenantID,
+		OfferID:     offer.ID,
+		Status:      models.ExportStatusPending,
+		EvaluatedAt: now.UTC().Truncate(time.Second),
+		CreatedAt:   s.now().UTC().Truncate(time.Second),
+	}
+
+	if err := s.db.CreateEligibleUserExport(export); err != nil {
+		return models.EligibleUserExport{}, err
+	}
+
+	return export, nil
+}
+
+func (s *Service) GetEligibleUserExport(ctx context.Context, offerID, exportID string) (models.EligibleUserExport, error) {
+	if err := validation.ValidateUUID(offerID, "id"); err != nil {
+		return models.EligibleUserExport{}, err
+	}
+	if err := validation.ValidateUUID(exportID, "export_id"); err != nil {
+		return models.EligibleUserExport{}, err
+	}
+
+	export, err := s.db.GetEligibleUserExport(tenant.FromContext(ctx), exportID)
+	if err != nil {
+		return models.EligibleUserExport{}, err
+	}
+	if export.OfferID != offerID {
+		return models.EligibleUserExport{}, fmt.Errorf("export %s: %w", exportID, database.ErrNotFound)
+	}
+
+	return export, nil
+}
+
+// StreamEligibleUserExport passes every row of a completed export to emit, in
+// user ID order. An export that has not completed is reported as ErrConflict.
+// An error from emit stops the stream and is returned.
+func (s *Service) StreamEligibleUserExport(ctx context.Context, offerID, exportID string, emit func(models.EligibleUser) error) error {
+	export, err := s.GetEligibleUserExport(ctx, offerID, exportID)
+	if err != nil {
+		return err
+	}
+	if export.Status != models.ExportStatusCompleted {
+		return fmt.Errorf("export %s is %s: %w", exportID, export.Status, database.ErrConflict)
+	}
+
+	afterUserID := ""
+	for {
+		users, err := s.db.ListEligibleUserExportRows(export.TenantID, export.ID, afterUserID, exportPageSize)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if err := emit(user); err != nil {
+				return err
+			}
+		}
+		if len(users) < exportPageSize {
+			return nil
+		}
+		afterUserID = users[len(users)-1].UserID
+	}
+}
+
+// RunEligibleUserExports runs queued exports until none is left and returns
+// how many it ran. An export whose offer can no longer be exported is marked
+// failed rather than stopping the run.
+func (s *Service) RunEligibleUserExports(ctx context.Context) (int, error) {
+	ran := 0
+	for {
+		now := s.now().UTC()
+		export, ok, err := s.db.ClaimEligibleUserExport(now, now.Add(-exportClaimTimeout))
+		if err != nil {
+			return ran, err
+		}
+		if !ok {
+			return ran, nil
+		}
+
+		if err := s.runEligibleUserExport(ctx, export); err != nil {
+			if failErr := s.db.FailEligibleUserExport(export.ID, err.Error(), s.now()); failErr != nil {
+				return ran, failErr
+			}
+			log.Printf("eligibility: export %s failed: %v", export.ID, err)
+		}
+		ran++
+	}
+}
+
+func (s *Service) runEligibleUserExport(ctx context.Context, export models.EligibleUserExport) error {
+	offer, err := s.reverseLookupOffer(tenant.WithTenant(ctx, export.TenantID), export.OfferID)
+	if err != nil {
+		return err
+	}
+
+	from, to := rules.LookbackWindow(offer, export.EvaluatedAt)
+	_, err = s.db.CompleteEligibleUserExport(export, offer, from, to, s.now())
+	return err
+}
+
+// reverseLookupOffer loads an offer whose eligible users can be computed in
+// SQL, which excludes offers with a rule tree or targeting a rule segment.
+func (s *Service) reverseLookupOffer(ctx context.Context, offerID string) (models.Offer, error) {
+	offer, err := s.GetOffer(ctx, offerID)
+	if err != nil {
+		return models.Offer{}, err
+	}
+	if offer.Rules != nil {
+		return models.Offer{}, fmt.Errorf("offer %s uses a rule tree, which cannot be evaluated for every user: %w", offerID, database.ErrConflict)
+	}
+	if len(offer.Segments) > 0 {
+		segments, err := s.db.GetSegments(offer.TenantID, offer.Segments)
+		if err != nil {
+			return models.Offer{}, err
+		}
+		for _, segment := range segments {
+			if segment.Type == models.SegmentTypeRule {
+				return models.Offer{}, fmt.Errorf("offer %s targets rule segment %s, which cannot be evaluated for every user: %w", offerID, segment.ID, database.ErrConflict)
+			}
+		}
+	}
+	return offer, nil
+}
+
+func encodeEligibleUsersCursor(evaluatedAt time.Time, userID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(evaluatedAt.UTC().Format(time.RFC3339) + "|" + userID))
+}
+
+func decodeEligibleUsersCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	evaluatedAtStr, userID, ok := strings.Cut(string(raw), "|")
+	if !ok || userID == "" {
+		return time.Time{}, "", errors.New("malformed cursor")
+	}
+
+	evaluatedAt, err := time.Parse(time.RFC3339, evaluatedAtStr)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	return evaluatedAt, userID, nil
+}
+
+// EligibleUserExporter runs queued eligible user exports on a fixed interval.
+type EligibleUserExporter struct {
+	service  *Service
+	interval time.Duration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewEligibleUserExporter(service *Service, interval time.Duration) *EligibleUserExporter {
+	return &EligibleUserExporter{
+		service:  service,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (w *EligibleUserExporter) Start() {
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+
+			if _, err := w.service.RunEligibleUserExports(context.Background()); err != nil {
+				log.Printf("eligibility: export run failed: %v", err)
+			}
+		}
+	}()
+}
+
+func (w *EligibleUserExporter) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
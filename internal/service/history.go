@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
+	"offer-eligibility-api/internal/validation"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// recordEligibilityCheck stores the answer about to be returned. Like a cache
+// failure, a failure to record is logged rather than failing the read.
+func (s *Service) recordEligibilityCheck(ctx context.Context, userID string, now time.Time, verdicts []models.OfferCheckVerdict) {
+	if verdicts == nil {
+		verdicts = []models.OfferCheckVerdict{}
+	}
+
+	err := s.db.RecordEligibilityCheck(models.EligibilityCheck{
+		ID:          uuid.New().String(),
+		TenantID:    tenant.FromContext(ctx),
+		UserID:      userID,
+		EvaluatedAt: now,
+		CheckedAt:   s.now().UTC(),
+		Offers:      verdicts,
+	})
+	if err != nil {
+		log.Printf("eligibility: failed to record check for user %s: %v", userID, err)
+	}
+}
+
+// GetEligibilityHistory returns the user's recorded checks, newest first. The
+// cursor is the NextCursor of a previous page.
+func (s *Service) GetEligibilityHistory(ctx context.Context, userID string, filter models.EligibilityHistoryFilter, cursor string) (models.EligibilityHistoryResponse, error) {
+	if err := validation.ValidateUUID(userID, "user_id"); err != nil {
+		return models.EligibilityHistoryResponse{}, err
+	}
+
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return models.EligibilityHistoryResponse{}, &validation.ValidationError{Field: "from", Message: "must be before to"}
+	}
+
+	if cursor != "" {
+		checkedAt, id, err := decodeHistoryCursor(cursor)
+		if err != nil {
+			return models.EligibilityHistoryResponse{}, &validation.ValidationError{Field: "cursor", Message: "is not a valid cursor"}
+		}
+		filter.BeforeCheckedAt = &checkedAt
+		filter.BeforeID = id
+	}
+
+	limit := filter.Limit
+	switch {
+	case limit <= 0:
+		limit = defaultHistoryLimit
+	case limit > maxHistoryLimit:
+		limit = maxHistoryLimit
+	}
+	// One extra row tells whether there is another page.
+	filter.Limit = limit + 1
+
+	checks, err := s.db.ListEligibilityChecks(tenant.FromContext(ctx), userID, filter)
+	if err != nil {
+		return models.EligibilityHistoryResponse{}, err
+	}
+
+	response := models.EligibilityHistoryResponse{
+		UserID: userID,
+		Checks: checks,
+	}
+	if len(checks) > limit {
+		response.Checks = checks[:limit]
+		last := response.Checks[limit-1]
+		response.NextCursor = encodeHistoryCursor(last.CheckedAt, last.ID)
+	}
+	if response.Checks == nil {
+		response.Checks = []models.EligibilityCheck{}
+	}
+
+	return response, nil
+}
+
+func encodeHistoryCursor(checkedAt time.Time, id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(checkedAt.UTC().Format(time.RFC3339) + "|" + id))
+}
+
+func decodeHistoryCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	checkedAtStr, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return time.Time{}, "", fmt.Errorf("malformed cursor")
+	}
+
+	checkedAt, err := time.Parse(time.RFC3339, checkedAtStr)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	return checkedAt, id, nil
+}
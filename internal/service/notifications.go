@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"offer-eligibility-api/internal/events"
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
+)
+
+// refreshEligibility re-evaluates the users behind newly ingested transactions
+// and announces the offers they gained or lost. The transactions are already
+// committed, so a failure is logged rather than failing the ingest.
+func (s *Service) refreshEligibility(ctx context.Context, transactions []models.Transaction) {
+	if s.events == nil {
+		return
+	}
+
+	var userIDs []string
+	seen := make(map[string]bool)
+	for _, txn := range transactions {
+		if !seen[txn.UserID] {
+			seen[txn.UserID] = true
+			userIDs = append(userIDs, txn.UserID)
+		}
+	}
+	s.refreshUsers(ctx, userIDs)
+}
+
+// refreshEligibilityAsync refreshes the users in the background, detached from
+// the request that ingested their transactions. Bulk imports use it so a large
+// import is not held up by reconciling every user it touched.
+func (s *Service) refreshEligibilityAsync(ctx context.Context, userIDs []string) {
+	if s.events == nil || len(userIDs) == 0 {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	s.refreshes.Add(1)
+	go func() {
+		defer s.refreshes.Done()
+		s.refreshUsers(ctx, userIDs)
+	}()
+}
+
+// WaitForRefreshes blocks until background eligibility refreshes started by
+// bulk imports have finished.
+func (s *Service) WaitForRefreshes() {
+	s.refreshes.Wait()
+}
+
+func (s *Service) refreshUsers(ctx context.Context, userIDs []string) {
+	now := s.now().UTC()
+	offers, err := s.getActiveOffers(ctx, now)
+	if err != nil {
+		log.Printf("eligibility: failed to get active offers: %v", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		if _, err := s.reconcileEligibility(ctx, userID, offers, now); err != nil {
+			log.Printf("eligibility: failed to refresh user %s: %v", userID, err)
+		}
+	}
+}
+
+// sweepBatchSize is how many eligibility state rows SweepEligibility reads at
+// once.
+const sweepBatchSize = 500
+
+// SweepEligibility re-evaluates every user currently recorded as eligible for
+// some offer and announces the offers they lost, typically because the
+// lookback window slid past their qualifying transactions or the offer ended.
+// The state is read in batches of sweepBatchSize rows. It returns the number
+// of changes announced.
+func (s *Service) SweepEligibility(ctx context.Context) (int, error) {
+	if s.events == nil {
+		return 0, nil
+	}
+
+	now := s.now().UTC()
+	offersByTenant := make(map[string][]models.Offer)
+	changed := 0
+
+	var last models.EligibilityState
+	for {
+		states, err := s.db.ListEligibilityStates(last, sweepBatchSize)
+		if err != nil {
+			return changed, err
+		}
+
+		for _, state := range states {
+			// A user's rows may span batches; each user is swept once.
+			if state.TenantID == last.TenantID && state.UserID == last.UserID {
+				last = state
+				continue
+			}
+			last = state
+
+			tenantCtx := tenant.WithTenant(ctx, state.TenantID)
+			offers, ok := offersByTenant[state.TenantID]
+			if !ok {
+				offers, err = s.getActiveOffers(tenantCtx, now)
+				if err != nil {
+					return changed, fmt.Errorf("failed to get active offers: %w", err)
+				}
+				offersByTenant[state.TenantID] = offers
+			}
+
+			n, err := s.reconcileEligibility(tenantCtx, state.UserID, offers, now)
+			if err != nil {
+				return changed, fmt.Errorf("failed to sweep user %s: %w", state.UserID, err)
+			}
+			changed += n
+		}
+
+		if len(states) < sweepBatchSize {
+			return changed, nil
+		}
+	}
+}
+
+// reconcileEligibility compares the user's eligibility against offers with the
+// recorded state and writes an eligibility.gained or eligibility.lost event
+// for every difference.
+func (s *Service) reconcileEligibility(ctx context.Context, userID string, offers []models.Offer, now time.Time) (int, error) {
+	tenantID := tenant.FromContext(ctx)
+
+	recorded, err := s.db.GetEligibilityStates(tenantID, userID)
+	if err != nil {
+		return 0, err
+	}
+	wasEligible := make(map[string]bool, len(recorded))
+	for _, state := range recorded {
+		wasEligible[state.OfferID] = true
+	}
+
+	transactions, err := s.loadUserTransactions(tenantID, userID, offers, now)
+	if err != nil {
+		return 0, err
+	}
+
+	var changes []models.EligibilityChange
+	addChange := func(offerID string, eligible bool, reason string) error {
+		eventType := events.EventEligibilityLost
+		if eligible {
+			eventType = events.EventEligibilityGained
+		}
+		outbox, err := s.outboxEvents(ctx, eventType, events.EligibilityChangedData{
+			UserID:    userID,
+			OfferID:   offerID,
+			Reason:    reason,
+			ChangedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+		changes = append(changes, models.EligibilityChange{
+			State: models.EligibilityState{
+				TenantID:      tenantID,
+				UserID:        userID,
+				OfferID:       offerID,
+				EligibleSince: now,
+			},
+			Eligible: eligible,
+			Outbox:   outbox,
+		})
+		return nil
+	}
+
+	excluded, err := s.excludedOffers(tenantID, userID, offers, transactions, now)
+	if err != nil {
+		return 0, err
+	}
+
+	isEligible := make(map[string]bool, len(offers))
+	for _, offer := range offers {
+		if _, ok := excluded[offer.ID]; ok {
+			continue
+		}
+		eligible, reason := evaluateOffer(offer, transactions, now)
+		if !eligible {
+			continue
+		}
+		isEligible[offer.ID] = true
+		if !wasEligible[offer.ID] {
+			if err := addChange(offer.ID, true, reason); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	for _, state := range recorded {
+		if !isEligible[state.OfferID] {
+			if err := addChange(state.OfferID, false, ""); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	return s.db.ApplyEligibilityChanges(changes)
+}
+
+// EligibilitySweeper runs SweepEligibility on a fixed interval.
+type EligibilitySweeper struct {
+	service  *Service
+	interval time.Duration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewEligibilitySweeper(service *Service, interval time.Duration) *EligibilitySweeper {
+	return &EligibilitySweeper{
+		service:  service,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (w *EligibilitySweeper) Start() {
+	go func() {
+		defer close(w.done)
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+
+			if _, err := w.service.SweepEligibility(context.Background()); err != nil {
+				log.Printf("eligibility: sweep failed: %v", err)
+			}
+		}
+	}()
+}
+
+func (w *EligibilitySweeper) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
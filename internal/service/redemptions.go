@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"offer-eligibility-api/internal/database"
+	"offer-eligibility-api/internal/events"
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
+	"offer-eligibility-api/internal/validation"
+
+	"github.com/google/uuid"
+)
+
+// ActivateOffer opts the user in to an offer they are currently eligible for.
+// Activating again returns the original activation; the second result reports
+// whether this call created it.
+func (s *Service) ActivateOffer(ctx context.Context, userID, offerID string) (models.OfferActivation, bool, error) {
+	if err := validation.ValidateUUID(userID, "user_id"); err != nil {
+		return models.OfferActivation{}, false, err
+	}
+	if err := validation.ValidateUUID(offerID, "offer_id"); err != nil {
+		return models.OfferActivation{}, false, err
+	}
+
+	tenantID := tenant.FromContext(ctx)
+	now := s.now().UTC()
+
+	activeOffers, err := s.getActiveOffers(ctx, now)
+	if err != nil {
+		return models.OfferActivation{}, false, fmt.Errorf("failed to get active offers: %w", err)
+	}
+
+	var offer *models.Offer
+	for i := range activeOffers {
+		if activeOffers[i].ID == offerID {
+			offer = &activeOffers[i]
+			break
+		}
+	}
+	if offer == nil {
+		if _, err := s.GetOffer(ctx, offerID); err != nil {
+			return models.OfferActivation{}, false, err
+		}
+		return models.OfferActivation{}, false, fmt.Errorf("offer %s is not live: %w", offerID, database.ErrConflict)
+	}
+
+	transactions, err := s.loadUserTransactions(tenantID, userID, []models.Offer{*offer}, now)
+	if err != nil {
+		return models.OfferActivation{}, false, err
+	}
+
+	excluded, err := s.excludedOffers(tenantID, userID, []models.Offer{*offer}, transactions, now)
+	if err != nil {
+		return models.OfferActivation{}, false, err
+	}
+	if criterion, ok := excluded[offerID]; ok {
+		return models.OfferActivation{}, false, fmt.Errorf("offer %s: %s: %w", offerID, exclusionReason(criterion), database.ErrConflict)
+	}
+	if eligible, _ := evaluateOffer(*offer, transactions, now); !eligible {
+		return models.OfferActivation{}, false, fmt.Errorf("user %s is not eligible for offer %s: %w", userID, offerID, database.ErrConflict)
+	}
+
+	outbox, err := s.outboxEvents(ctx, events.EventOfferActivated, events.OfferActivatedData{
+		UserID:      userID,
+		OfferID:     offerID,
+		ActivatedAt: now,
+	})
+	if err != nil {
+		return models.OfferActivation{}, false, err
+	}
+
+	return s.db.ActivateOffer(models.OfferActivation{
+		TenantID:    tenantID,
+		UserID:      userID,
+		OfferID:     offerID,
+		ActivatedAt: now,
+	}, outbox...)
+}
+
+// RedeemOffer records one redemption of an offer the user has activated and
+// pays its reward from the offer's budget. Eligibility is not re-checked: the
+// purchase being rewarded may itself have changed it. Redemptions of an offer
+// that is inactive or outside its schedule, and redemptions beyond either cap
+// or the budget, are rejected as ErrConflict.
+func (s *Service) RedeemOffer(ctx context.Context, userID, offerID string) (models.Redemption, error) {
+	if err := validation.ValidateUUID(userID, "user_id"); err != nil {
+		return models.Redemption{}, err
+	}
+
+	offer, err := s.GetOffer(ctx, offerID)
+	if err != nil {
+		return models.Redemption{}, err
+	}
+
+	redemption := models.Redemption{
+		ID:         uuid.New().String(),
+		TenantID:   tenant.FromContext(ctx),
+		UserID:     userID,
+		OfferID:    offerID,
+		RedeemedAt: s.now().UTC(),
+	}
+
+	outbox, err := s.outboxEvents(ctx, events.EventOfferRedeemed, events.OfferRedeemedData{
+		RedemptionID: redemption.ID,
+		UserID:       userID,
+		OfferID:      offerID,
+		RedeemedAt:   redemption.RedeemedAt,
+	})
+	if err != nil {
+		return models.Redemption{}, err
+	}
+
+	var budgetExhausted []models.OutboxEvent
+	if offer.BudgetCents > 0 {
+		budgetExhausted, err = s.outboxEvents(ctx, events.EventOfferBudgetExhausted, events.OfferBudgetExhaustedData{
+			OfferID:      offerID,
+			BudgetCents:  offer.BudgetCents,
+			RewardCents:  offer.RewardCents,
+			RedemptionID: redemption.ID,
+			ExhaustedAt:  redemption.RedeemedAt,
+		})
+		if err != nil {
+			return models.Redemption{}, err
+		}
+	}
+
+	redemption, err = s.db.RedeemOffer(redemption, budgetExhausted, outbox...)
+	if err != nil {
+		return models.Redemption{}, err
+	}
+
+	s.invalidateUser(ctx, userID)
+	if redemption.BudgetExhausted || (offer.MaxRedemptions > 0 && redemption.OfferRedemptionCount >= offer.MaxRedemptions) {
+		s.invalidateOffers(ctx)
+	}
+
+	return redemption, nil
+}
+
+// exhaustedOffers returns the offers whose redemption caps the user has
+// reached, mapped to the cap. It skips the lookup when no offer has a cap.
+func (s *Service) exhaustedOffers(tenantID, userID string, offers []models.Offer) (map[string]models.RuleType, error) {
+	for _, offer := range offers {
+		if offer.MaxRedemptions > 0 || offer.MaxRedemptionsPerUser > 0 {
+			exhausted, err := s.db.GetExhaustedOffers(tenantID, userID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get exhausted offers: %w", err)
+			}
+			return exhausted, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/validation"
+)
+
+const (
+	defaultRetentionGraceDays = 30
+	defaultRetentionBatchSize = 1000
+)
+
+// retentionMetrics is published with the other expvar variables under
+// "retention": the totals of transactions_purged, eligibility_checks_purged,
+// outbox_events_purged, runs and errors since the process started, and the
+// time and purge counts of the last run.
+var retentionMetrics = expvar.NewMap("retention")
+
+// SetRetention sets how many days past the longest possible offer lookback
+// transactions and eligibility checks are kept, and how many are deleted per
+// statement.
+func (s *Service) SetRetention(graceDays, batchSize int) {
+	if graceDays >= 0 {
+		s.retentionGraceDays = graceDays
+	}
+	if batchSize > 0 {
+		s.retentionBatchSize = batchSize
+	}
+}
+
+// RunRetention deletes the transactions of every tenant that no offer can
+// read any more: those approved more than validation.MaxLookbackDays plus the
+// grace period ago. Eligibility checks made and outbox events delivered
+// before the same cutoff are deleted too. Rows are deleted in batches of the configured size, each in
+// its own statement, so writers are never locked out for long. A cancelled
+// ctx stops the run between batches.
+func (s *Service) RunRetention(ctx context.Context) (models.RetentionRun, error) {
+	now := s.now().UTC().Truncate(time.Second)
+	run := models.RetentionRun{
+		Cutoff: now.AddDate(0, 0, -(validation.MaxLookbackDays + s.retentionGraceDays)),
+	}
+
+	var err error
+	run.TransactionsPurged, err = s.purgeInBatches(ctx, &run, "transactions_purged", s.db.PurgeTransactions)
+	if err != nil {
+		return run, err
+	}
+	run.EligibilityChecksPurged, err = s.purgeInBatches(ctx, &run, "eligibility_checks_purged", s.db.PurgeEligibilityChecks)
+	if err != nil {
+		return run, err
+	}
+	run.OutboxEventsPurged, err = s.purgeInBatches(ctx, &run, "outbox_events_purged", s.db.PurgeOutboxEvents)
+	if err != nil {
+		return run, err
+	}
+
+	var lastRunAt expvar.String
+	lastRunAt.Set(now.Format(time.RFC3339))
+	var lastRunPurged, lastRunChecksPurged, lastRunOutboxPurged expvar.Int
+	lastRunPurged.Set(run.TransactionsPurged)
+	lastRunChecksPurged.Set(run.EligibilityChecksPurged)
+	lastRunOutboxPurged.Set(run.OutboxEventsPurged)
+	retentionMetrics.Add("runs", 1)
+	retentionMetrics.Set("last_run_at", &lastRunAt)
+	retentionMetrics.Set("last_run_transactions_purged", &lastRunPurged)
+	retentionMetrics.Set("last_run_eligibility_checks_purged", &lastRunChecksPurged)
+	retentionMetrics.Set("last_run_outbox_events_purged", &lastRunOutboxPurged)
+
+	return run, nil
+}
+
+// purgeInBatches calls purge until it deletes less than a full batch, counting
+// the batches in run and the deleted rows under metric. It returns how many
+// rows were deleted.
+func (s *Service) purgeInBatches(ctx context.Context, run *models.RetentionRun, metric string, purge func(cutoff time.Time, limit int) (int64, error)) (int64, error) {
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			retentionMetrics.Add("errors", 1)
+			return total, err
+		}
+
+		purged, err := purge(run.Cutoff, s.retentionBatchSize)
+		if err != nil {
+			retentionMetrics.Add("errors", 1)
+			return total, err
+		}
+		run.Batches++
+		total += purged
+		retentionMetrics.Add(metric, purged)
+
+		if purged < int64(s.retentionBatchSize) {
+			return total, nil
+		}
+	}
+}
+
+// RetentionPurger runs RunRetention on a fixed interval.
+type RetentionPurger struct {
+	service  *Service
+	interval time.Duration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewRetentionPurger(service *Service, interval time.Duration) *RetentionPurger {
+	return &RetentionPurger{
+		service:  service,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (w *RetentionPurger) Start() {
+	go func() {
+		defer close(w.done)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-w.stop:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+			}
+
+			run, err := w.service.RunRetention(ctx)
+			if err != nil {
+				log.Printf("retention: run failed: %v", err)
+				continue
+			}
+			if run.TransactionsPurged > 0 || run.EligibilityChecksPurged > 0 || run.OutboxEventsPurged > 0 {
+				log.Printf("retention: purged %d transactions, %d eligibility checks and %d outbox events before %s",
+					run.TransactionsPurged, run.EligibilityChecksPurged, run.OutboxEventsPurged, run.Cutoff.Format(time.RFC3339))
+			}
+		}
+	}()
+}
+
+func (w *RetentionPurger) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
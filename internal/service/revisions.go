@@ -0,0 +1,47 @@
+package service
+
+import (
+	"context"
+
+	"offer-eligibility-api/internal/middleware"
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
+	"offer-eligibility-api/internal/validation"
+)
+
+// anonymousActor records changes made while authentication is disabled.
+const anonymousActor = "anonymous"
+
+// changedBy names the caller for an offer revision: the authenticated
+// principal's subject, or anonymousActor.
+func changedBy(ctx context.Context) string {
+	if principal, ok := middleware.PrincipalFromContext(ctx); ok && principal.Subject != "" {
+		return principal.Subject
+	}
+	return anonymousActor
+}
+
+// ListOfferRevisions returns every recorded revision of an offer, oldest
+// first, including those after it was deleted.
+func (s *Service) ListOfferRevisions(ctx context.Context, id string) ([]models.OfferRevision, error) {
+	if err := validation.ValidateUUID(id, "id"); err != nil {
+		return nil, err
+	}
+
+	tenantID := tenant.FromContext(ctx)
+
+	revisions, err := s.db.ListOfferRevisions(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(revisions) == 0 {
+		// Offers written before revisions were recorded still exist.
+		if _, err := s.db.GetOffer(tenantID, id); err != nil {
+			return nil, err
+		}
+		return []models.OfferRevision{}, nil
+	}
+
+	return revisions, nil
+}
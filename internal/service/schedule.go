@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"offer-eligibility-api/internal/events"
+	"offer-eligibility-api/internal/tenant"
+)
+
+// schedulerChangedBy is recorded on the revisions of offers the scheduler
+// deactivates.
+const schedulerChangedBy = "scheduler"
+
+// Clock tells time for the OfferScheduler. Tests substitute a fake clock to
+// fast-forward through offer windows.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// SystemClock is the wall clock.
+var SystemClock Clock = systemClock{}
+
+// RunOfferSchedule handles every offer start and end that has passed by now.
+// Active offers whose ends_at has passed are deactivated, with an offer.ended
+// event. Live offers whose start has not been handled yet get an
+// offer.started event. Each start and end is announced once, however often
+// this runs and however many servers run it. The active offers of every
+// affected tenant are reloaded into the cache. It returns the number of
+// offers started or ended.
+func (s *Service) RunOfferSchedule(ctx context.Context, now time.Time) (int, error) {
+	now = now.UTC()
+	changed := 0
+	tenants := make(map[string]bool)
+
+	expired, err := s.db.ListExpiredOffers(now)
+	if err != nil {
+		return 0, err
+	}
+	for _, offer := range expired {
+		outbox, err := s.outboxEvents(tenant.WithTenant(ctx, offer.TenantID), events.EventOfferEnded, events.OfferEndedData{
+			OfferID: offer.ID,
+			EndedAt: offer.EndsAt,
+		})
+		if err != nil {
+			return changed, err
+		}
+
+		ok, err := s.db.ExpireOffer(offer, schedulerChangedBy, now, outbox...)
+		if err != nil {
+			return changed, fmt.Errorf("failed to expire offer %s: %w", offer.ID, err)
+		}
+		if ok {
+			changed++
+			tenants[offer.TenantID] = true
+		}
+	}
+
+	started, err := s.db.ListStartedOffers(now)
+	if err != nil {
+		return changed, err
+	}
+	for _, offer := range started {
+		outbox, err := s.outboxEvents(tenant.WithTenant(ctx, offer.TenantID), events.EventOfferStarted, events.OfferStartedData{
+			Offer:     offer,
+			StartedAt: offer.StartsAt,
+		})
+		if err != nil {
+			return changed, err
+		}
+
+		ok, err := s.db.MarkOfferStarted(offer, now, outbox...)
+		if err != nil {
+			return changed, fmt.Errorf("failed to start offer %s: %w", offer.ID, err)
+		}
+		if ok {
+			changed++
+			tenants[offer.TenantID] = true
+		}
+	}
+
+	for tenantID := range tenants {
+		s.warmActiveOffers(tenant.WithTenant(ctx, tenantID), now)
+	}
+
+	return changed, nil
+}
+
+// NextOfferScheduleChange returns when RunOfferSchedule next has an offer to
+// start or end. The second result is false when nothing is scheduled.
+func (s *Service) NextOfferScheduleChange(now time.Time) (time.Time, bool, error) {
+	return s.db.NextOfferScheduleChange(now.UTC())
+}
+
+// warmActiveOffers drops the cached active offers of the tenant and loads the
+// new set, so the first eligibility check after an offer starts or ends does
+// not pay for it. Failures are logged; the next read loads the offers anyway.
+func (s *Service) warmActiveOffers(ctx context.Context, now time.Time) {
+	if s.cache == nil {
+		return
+	}
+
+	s.invalidateOffers(ctx)
+	if _, err := s.getActiveOffers(ctx, now); err != nil {
+		log.Printf("scheduler: failed to warm active offers of tenant %s: %v", tenant.FromContext(ctx), err)
+	}
+}
+
+// offerScheduleChanged wakes the OfferScheduler after an offer is written, in
+// case its window moved ahead of the scheduler's next wake-up.
+func (s *Service) offerScheduleChanged() {
+	select {
+	case s.scheduleChanged <- struct{}{}:
+	default:
+	}
+}
+
+// OfferScheduler runs RunOfferSchedule at every offer start and end, and at
+// least every maxWait so that offers written by other servers are picked up.
+type OfferScheduler struct {
+	service *Service
+	clock   Clock
+	maxWait time.Duration
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewOfferScheduler(service *Service, clock Clock, maxWait time.Duration) *OfferScheduler {
+	return &OfferScheduler{
+		service: service,
+		clock:   clock,
+		maxWait: maxWait,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (w *OfferScheduler) Start() {
+	go func() {
+		defer close(w.done)
+
+		// The first run covers the offers written before the scheduler started.
+		select {
+		case <-w.service.scheduleChanged:
+		default:
+		}
+
+		for {
+			now := w.clock.Now()
+			if _, err := w.service.RunOfferSchedule(context.Background(), now); err != nil {
+				log.Printf("scheduler: run failed: %v", err)
+			}
+
+			wait := w.maxWait
+			if next, ok, err := w.service.NextOfferScheduleChange(now); err != nil {
+				log.Printf("scheduler: failed to find the next offer start or end: %v", err)
+			} else if ok && next.Sub(now) < wait {
+				wait = next.Sub(now)
+			}
+
+			select {
+			case <-w.stop:
+				return
+			case <-w.service.scheduleChanged:
+			case <-w.clock.After(wait):
+			}
+		}
+	}()
+}
+
+func (w *OfferScheduler) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/rules"
+	"offer-eligibility-api/internal/tenant"
+	"offer-eligibility-api/internal/validation"
+
+	"github.com/google/uuid"
+)
+
+func (s *Service) CreateSegment(ctx context.Context, req models.CreateSegmentRequest) (models.Segment, error) {
+	if err := validation.ValidateSegmentRequest(req); err != nil {
+		return models.Segment{}, err
+	}
+
+	segment := models.Segment{
+		ID:           uuid.New().String(),
+		TenantID:     tenant.FromContext(ctx),
+		Name:         validation.SanitizeString(req.Name),
+		Type:         req.Type,
+		Rule:         req.Rule,
+		LookbackDays: req.LookbackDays,
+		CreatedAt:    s.now().UTC().Truncate(time.Second),
+	}
+
+	if err := s.db.CreateSegment(segment); err != nil {
+		return models.Segment{}, err
+	}
+
+	return segment, nil
+}
+
+func (s *Service) GetSegment(ctx context.Context, id string) (models.Segment, error) {
+	if err := validation.ValidateUUID(id, "id"); err != nil {
+		return models.Segment{}, err
+	}
+
+	return s.db.GetSegment(tenant.FromContext(ctx), id)
+}
+
+func (s *Service) ListSegments(ctx context.Context) ([]models.Segment, error) {
+	segments, err := s.db.ListSegments(tenant.FromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list segments: %w", err)
+	}
+
+	if segments == nil {
+		segments = []models.Segment{}
+	}
+
+	return segments, nil
+}
+
+// DeleteSegment removes a segment no offer targets any more.
+func (s *Service) DeleteSegment(ctx context.Context, id string) error {
+	if err := validation.ValidateUUID(id, "id"); err != nil {
+		return err
+	}
+
+	return s.db.DeleteSegment(tenant.FromContext(ctx), id)
+}
+
+// AddSegmentMembers uploads user IDs into a list segment.
+func (s *Service) AddSegmentMembers(ctx context.Context, id string, req models.SegmentMembersRequest) (models.SegmentMembersResponse, error) {
+	return s.changeSegmentMembers(ctx, id, req, func(tenantID string) (int, error) {
+		return s.db.AddSegmentMembers(tenantID, id, req.UserIDs, s.now())
+	})
+}
+
+// RemoveSegmentMembers removes user IDs from a list segment.
+func (s *Service) RemoveSegmentMembers(ctx context.Context, id string, req models.SegmentMembersRequest) (models.SegmentMembersResponse, error) {
+	return s.changeSegmentMembers(ctx, id, req, func(tenantID string) (int, error) {
+		return s.db.RemoveSegmentMembers(tenantID, id, req.UserIDs)
+	})
+}
+
+func (s *Service) changeSegmentMembers(ctx context.Context, id string, req models.SegmentMembersRequest, change func(tenantID string) (int, error)) (models.SegmentMembersResponse, error) {
+	segment, err := s.GetSegment(ctx, id)
+	if err != nil {
+		return models.SegmentMembersResponse{}, err
+	}
+
+	if segment.Type != models.SegmentTypeList {
+		return models.SegmentMembersResponse{}, &validation.ValidationError{
+			Field:   "id",
+			Message: "members can only be changed on list segments",
+		}
+	}
+
+	if err := validation.ValidateSegmentMembersRequest(req); err != nil {
+		return models.SegmentMembersResponse{}, err
+	}
+
+	changed, err := change(segment.TenantID)
+	if err != nil {
+		return models.SegmentMembersResponse{}, err
+	}
+
+	for _, userID := range req.UserIDs {
+		s.invalidateUser(ctx, userID)
+	}
+
+	segment, err = s.db.GetSegment(segment.TenantID, id)
+	if err != nil {
+		return models.SegmentMembersResponse{}, err
+	}
+
+	return models.SegmentMembersResponse{
+		SegmentID:   id,
+		Changed:     changed,
+		MemberCount: segment.MemberCount,
+	}, nil
+}
+
+// validateOfferSegments checks that every segment the offer targets exists in
+// the tenant.
+func (s *Service) validateOfferSegments(offer models.Offer) error {
+	if len(offer.Segments) == 0 {
+		return nil
+	}
+
+	segments, err := s.db.GetSegments(offer.TenantID, offer.Segments)
+	if err != nil {
+		return err
+	}
+
+	found := make(map[string]bool, len(segments))
+	for _, segment := range segments {
+		found[segment.ID] = true
+	}
+	for _, id := range offer.Segments {
+		if !found[id] {
+			return &validation.ValidationError{
+				Field:   "segments",
+				Message: fmt.Sprintf("unknown segment: %s", id),
+			}
+		}
+	}
+
+	return nil
+}
+
+// untargetedOffers returns the IDs of the offers restricted to segments the
+// user is in none of. List membership is read from the database; rule
+// segments are evaluated against the user's transactions, which are reloaded
+// when a segment looks back further than the offers they were loaded for.
+func (s *Service) untargetedOffers(tenantID, userID string, offers []models.Offer, transactions []models.Transaction, now time.Time) (map[string]bool, error) {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, offer := range offers {
+		for _, id := range offer.Segments {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	segments, err := s.db.GetSegments(tenantID, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get segments: %w", err)
+	}
+
+	listed, err := s.db.GetUserSegmentIDs(tenantID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get segment memberships: %w", err)
+	}
+
+	lookbackDays := 0
+	for _, segment := range segments {
+		if segment.Type == models.SegmentTypeRule && segment.LookbackDays > lookbackDays {
+			lookbackDays = segment.LookbackDays
+		}
+	}
+	if lookbackDays > maxLookbackDays(offers) {
+		transactions, err = s.db.GetUserTransactions(tenantID, userID, now.AddDate(0, 0, -lookbackDays), now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get transactions: %w", err)
+		}
+	}
+
+	member := segmentMembership(segments, listed, transactions, now)
+
+	untargeted := make(map[string]bool)
+	for _, offer := range offers {
+		if !targets(offer, member) {
+			untargeted[offer.ID] = true
+		}
+	}
+
+	return untargeted, nil
+}
+
+// segmentMembership reports which of the segments a user is in at now, given
+// the list segments that name them and their transactions.
+func segmentMembership(segments []models.Segment, listed map[string]bool, transactions []models.Transaction, now time.Time) map[string]bool {
+	member := make(map[string]bool, len(segments))
+	for _, segment := range segments {
+		switch segment.Type {
+		case models.SegmentTypeList:
+			member[segment.ID] = listed[segment.ID]
+		case models.SegmentTypeRule:
+			member[segment.ID] = rules.EvaluateSegment(segment, transactions, now).Eligible
+		}
+	}
+	return member
+}
+
+// targets reports whether the offer is evaluated for a user in the member
+// segments. Offers without segments target everyone.
+func targets(offer models.Offer, member map[string]bool) bool {
+	if len(offer.Segments) == 0 {
+		return true
+	}
+	for _, id := range offer.Segments {
+		if member[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedOffers returns the offers the user cannot get whatever their
+// transactions, mapped to the criterion that excludes them: segments the user
+// is not in, or a reached redemption cap.
+func (s *Service) excludedOffers(tenantID, userID string, offers []models.Offer, transactions []models.Transaction, now time.Time) (map[string]models.RuleType, error) {
+	excluded, err := s.exhaustedOffers(tenantID, userID, offers)
+	if err != nil {
+		return nil, err
+	}
+
+	untargeted, err := s.untargetedOffers(tenantID, userID, offers, transactions, now)
+	if err != nil {
+		return nil, err
+	}
+	if len(untargeted) > 0 && excluded == nil {
+		excluded = make(map[string]models.RuleType, len(untargeted))
+	}
+	for offerID := range untargeted {
+		excluded[offerID] = models.CriterionSegments
+	}
+
+	return excluded, nil
+}
+
+// exclusionReason describes why an offer excluded by excludedOffers is not
+// available to the user.
+func exclusionReason(criterion models.RuleType) string {
+	if criterion == models.CriterionSegments {
+		return "user is not in any targeted segment"
+	}
+	return fmt.Sprintf("%s reached", criterion)
+}
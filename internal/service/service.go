@@ -2,24 +2,52 @@ package service
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
+	"offer-eligibility-api/internal/cache"
 	"offer-eligibility-api/internal/database"
 	"offer-eligibility-api/internal/events"
 	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
 	"offer-eligibility-api/internal/validation"
+
+	"github.com/google/uuid"
 )
 
 type Service struct {
-	db     *database.DB
-	events *events.Manager
+	db            database.Store
+	events        *events.Manager
+	cache         cache.Cache
+	cacheTTL      time.Duration
+	bulkChunkSize int
+	batchMaxUsers int
+	batchWorkers  int
+	now           func() time.Time
+
+	retentionGraceDays int
+	retentionBatchSize int
+
+	scheduleChanged chan struct{}
+	refreshes       sync.WaitGroup
 }
 
-func NewService(db *database.DB) *Service {
+func NewService(db database.Store) *Service {
 	return &Service{
-		db:     db,
-		events: nil,
+		db:            db,
+		events:        nil,
+		bulkChunkSize: defaultBulkChunkSize,
+		batchMaxUsers: defaultBatchMaxUsers,
+		batchWorkers:  defaultBatchWorkers,
+		now:           time.Now,
+
+		retentionGraceDays: defaultRetentionGraceDays,
+		retentionBatchSize: defaultRetentionBatchSize,
+
+		scheduleChanged: make(chan struct{}, 1),
 	}
 }
 
@@ -27,22 +55,163 @@ func (s *Service) SetEventManager(em *events.Manager) {
 	s.events = em
 }
 
+// SetNow replaces the clock the service stamps writes and checks with.
+func (s *Service) SetNow(now func() time.Time) {
+	s.now = now
+}
+
 func (s *Service) CreateOffer(ctx context.Context, offer models.Offer) error {
+	offer.TenantID = tenant.FromContext(ctx)
+
 	if err := validation.ValidateOffer(offer); err != nil {
 		return err
 	}
 
-	if err := s.db.UpsertOffer(offer); err != nil {
+	if err := s.validateOfferSegments(offer); err != nil {
 		return err
 	}
 
-	if s.events != nil {
-		s.events.PublishOfferCreated(ctx, offer)
+	outbox, err := s.outboxEvents(ctx, events.EventOfferCreated, events.OfferCreatedData{Offer: offer})
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.UpsertOffer(offer, changedBy(ctx), s.now(), outbox...); err != nil {
+		return err
+	}
+
+	s.invalidateOffers(ctx)
+	s.offerScheduleChanged()
+
+	return nil
+}
+
+func (s *Service) GetOffer(ctx context.Context, id string) (models.Offer, error) {
+	if err := validation.ValidateUUID(id, "id"); err != nil {
+		return models.Offer{}, err
+	}
+
+	return s.db.GetOffer(tenant.FromContext(ctx), id)
+}
+
+func (s *Service) ListOffers(ctx context.Context, filter models.OfferFilter) ([]models.Offer, error) {
+	if filter.MerchantID != "" {
+		if err := validation.ValidateUUID(filter.MerchantID, "merchant_id"); err != nil {
+			return nil, err
+		}
+	}
+
+	offers, err := s.db.ListOffers(tenant.FromContext(ctx), filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offers: %w", err)
+	}
+
+	if offers == nil {
+		offers = []models.Offer{}
+	}
+
+	return offers, nil
+}
+
+func (s *Service) PatchOffer(ctx context.Context, id string, patch models.OfferPatch) (models.Offer, error) {
+	offer, err := s.GetOffer(ctx, id)
+	if err != nil {
+		return models.Offer{}, err
+	}
+
+	applyOfferPatch(&offer, patch)
+
+	if err := validation.ValidateOffer(offer); err != nil {
+		return models.Offer{}, err
+	}
+
+	if err := s.validateOfferSegments(offer); err != nil {
+		return models.Offer{}, err
+	}
+
+	outbox, err := s.outboxEvents(ctx, events.EventOfferUpdated, events.OfferUpdatedData{Offer: offer})
+	if err != nil {
+		return models.Offer{}, err
+	}
+
+	if err := s.db.UpsertOffer(offer, changedBy(ctx), s.now(), outbox...); err != nil {
+		return models.Offer{}, err
 	}
+	offer.Version++
+
+	s.invalidateOffers(ctx)
+	s.offerScheduleChanged()
+
+	return offer, nil
+}
+
+func (s *Service) DeleteOffer(ctx context.Context, id string) error {
+	if err := validation.ValidateUUID(id, "id"); err != nil {
+		return err
+	}
+
+	outbox, err := s.outboxEvents(ctx, events.EventOfferDeleted, events.OfferDeletedData{OfferID: id})
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.DeleteOffer(tenant.FromContext(ctx), id, changedBy(ctx), s.now(), outbox...); err != nil {
+		return err
+	}
+
+	s.invalidateOffers(ctx)
 
 	return nil
 }
 
+func applyOfferPatch(offer *models.Offer, patch models.OfferPatch) {
+	if patch.MerchantID != nil {
+		offer.MerchantID = *patch.MerchantID
+	}
+	if patch.MCCWhitelist != nil {
+		offer.MCCWhitelist = *patch.MCCWhitelist
+	}
+	if patch.Active != nil {
+		offer.Active = *patch.Active
+	}
+	if patch.MinTxnCount != nil {
+		offer.MinTxnCount = *patch.MinTxnCount
+	}
+	if patch.MinSpendCents != nil {
+		offer.MinSpendCents = *patch.MinSpendCents
+	}
+	if patch.MinTxnAmountCents != nil {
+		offer.MinTxnAmountCents = *patch.MinTxnAmountCents
+	}
+	if patch.LookbackDays != nil {
+		offer.LookbackDays = *patch.LookbackDays
+	}
+	if patch.StartsAt != nil {
+		offer.StartsAt = *patch.StartsAt
+	}
+	if patch.EndsAt != nil {
+		offer.EndsAt = *patch.EndsAt
+	}
+	if patch.Rules != nil {
+		offer.Rules = patch.Rules
+	}
+	if patch.MaxRedemptions != nil {
+		offer.MaxRedemptions = *patch.MaxRedemptions
+	}
+	if patch.MaxRedemptionsPerUser != nil {
+		offer.MaxRedemptionsPerUser = *patch.MaxRedemptionsPerUser
+	}
+	if patch.BudgetCents != nil {
+		offer.BudgetCents = *patch.BudgetCents
+	}
+	if patch.RewardCents != nil {
+		offer.RewardCents = *patch.RewardCents
+	}
+	if patch.Segments != nil {
+		offer.Segments = *patch.Segments
+	}
+}
+
 func (s *Service) CreateTransactions(ctx context.Context, transactions []models.Transaction) (int, error) {
 	if len(transactions) == 0 {
 		return 0, fmt.Errorf("no transactions provided")
@@ -58,44 +227,233 @@ func (s *Service) CreateTransactions(ctx context.Context, transactions []models.
 		}
 	}
 
-	count, err := s.db.InsertTransactions(transactions)
+	setTransactionTenant(ctx, transactions)
+
+	outbox, err := s.outboxEvents(ctx, events.EventTransactionCreated, events.TransactionCreatedData{
+		Transactions: transactions,
+		Count:        len(transactions),
+	})
 	if err != nil {
 		return 0, err
 	}
 
-	if s.events != nil {
-		s.events.PublishTransactionCreated(ctx, transactions, count)
+	count, err := s.db.InsertTransactions(transactions, outbox...)
+	if err != nil {
+		return 0, err
 	}
 
+	s.invalidateUsers(ctx, transactions)
+	s.refreshEligibility(ctx, transactions)
+
 	return count, nil
 }
 
+// CreateTransactionsIdempotent ingests a batch item by item: invalid items are
+// rejected, items already stored with an identical payload count as
+// duplicates, and items whose ID is stored with a different payload are
+// rejected as conflicts. Retrying a partially delivered batch is always safe.
+func (s *Service) CreateTransactionsIdempotent(ctx context.Context, transactions []models.Transaction) (models.CreateTransactionsResponse, error) {
+	if len(transactions) == 0 {
+		return models.CreateTransactionsResponse{}, fmt.Errorf("no transactions provided")
+	}
+
+	if len(transactions) > 1000 {
+		return models.CreateTransactionsResponse{}, fmt.Errorf("cannot process more than 1000 transactions per request")
+	}
+
+	var response models.CreateTransactionsResponse
+	var valid []models.Transaction
+	var validIndexes []int
+
+	for i, txn := range transactions {
+		if err := validation.ValidateTransaction(txn); err != nil {
+			response.Rejected++
+			response.Errors = append(response.Errors, models.TransactionError{Index: i, ID: txn.ID, Error: err.Error()})
+			continue
+		}
+		valid = append(valid, txn)
+		validIndexes = append(validIndexes, i)
+	}
+
+	statuses, err := s.insertIdempotent(ctx, valid)
+	if err != nil {
+		return models.CreateTransactionsResponse{}, err
+	}
+
+	var inserted []models.Transaction
+	for j, status := range statuses {
+		txn := valid[j]
+		switch status {
+		case models.IngestInserted:
+			response.Inserted++
+			inserted = append(inserted, txn)
+		case models.IngestDuplicate:
+			response.Duplicates++
+		case models.IngestConflict:
+			response.Rejected++
+			response.Errors = append(response.Errors, models.TransactionError{
+				Index: validIndexes[j],
+				ID:    txn.ID,
+				Error: fmt.Sprintf("transaction %s already exists with a different payload", txn.ID),
+			})
+		}
+	}
+
+	sort.Slice(response.Errors, func(i, j int) bool {
+		return response.Errors[i].Index < response.Errors[j].Index
+	})
+
+	s.refreshEligibility(ctx, inserted)
+
+	return response, nil
+}
+
+func (s *Service) insertIdempotent(ctx context.Context, transactions []models.Transaction) ([]models.IngestStatus, error) {
+	setTransactionTenant(ctx, transactions)
+
+	var outbox database.OutboxFunc
+	if s.events != nil {
+		outbox = func(inserted []models.Transaction) ([]models.OutboxEvent, error) {
+			return s.outboxEvents(ctx, events.EventTransactionCreated, events.TransactionCreatedData{
+				Transactions: inserted,
+				Count:        len(inserted),
+			})
+		}
+	}
+
+	statuses, err := s.db.InsertTransactionsIdempotent(transactions, outbox)
+	if err != nil {
+		return nil, err
+	}
+
+	var inserted []models.Transaction
+	for i, status := range statuses {
+		if status == models.IngestInserted {
+			inserted = append(inserted, transactions[i])
+		}
+	}
+
+	if len(inserted) > 0 {
+		s.invalidateUsers(ctx, inserted)
+	}
+
+	return statuses, nil
+}
+
+// outboxEvents returns the event to write alongside a change, or nothing when
+// no event manager is configured. Events reach subscribers through the outbox
+// relay, never directly, so a crash after commit cannot lose them.
+func (s *Service) outboxEvents(ctx context.Context, eventType events.EventType, data interface{}) ([]models.OutboxEvent, error) {
+	if s.events == nil {
+		return nil, nil
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	return []models.OutboxEvent{{
+		ID:        uuid.New().String(),
+		TenantID:  tenant.FromContext(ctx),
+		EventType: string(eventType),
+		Payload:   payload,
+		CreatedAt: s.now().UTC(),
+	}}, nil
+}
+
+// Transactions always belong to the caller's tenant, whatever the payload says.
+func setTransactionTenant(ctx context.Context, transactions []models.Transaction) {
+	tenantID := tenant.FromContext(ctx)
+	for i := range transactions {
+		transactions[i].TenantID = tenantID
+	}
+}
+
 func (s *Service) GetEligibleOffers(ctx context.Context, userID string, now time.Time) (models.EligibleOffersResponse, error) {
 	if err := validation.ValidateUUID(userID, "user_id"); err != nil {
 		return models.EligibleOffersResponse{}, err
 	}
 
-	activeOffers, err := s.db.GetActiveOffers(now)
+	cacheKey, cached, ok := s.lookupEligibility(ctx, userID, now)
+	if ok {
+		return cached, nil
+	}
+
+	activeOffers, err := s.getActiveOffers(ctx, now)
 	if err != nil {
 		return models.EligibleOffersResponse{}, fmt.Errorf("failed to get active offers: %w", err)
 	}
 
+	return s.evaluateEligibility(ctx, userID, now, activeOffers, cacheKey)
+}
+
+// lookupEligibility serves a cached result, recording the check with the time
+// the cached result was evaluated for. The returned key is where a computed
+// result belongs; it is empty without a cache.
+func (s *Service) lookupEligibility(ctx context.Context, userID string, now time.Time) (string, models.EligibleOffersResponse, bool) {
+	if s.cache == nil {
+		return "", models.EligibleOffersResponse{}, false
+	}
+
+	cacheKey := s.eligibilityCacheKey(ctx, userID, now)
+	cached, ok := s.getCachedEligibility(ctx, cacheKey)
+	if !ok {
+		return cacheKey, models.EligibleOffersResponse{}, false
+	}
+
+	evaluatedAt := cached.EvaluatedAt
+	if evaluatedAt.IsZero() {
+		evaluatedAt = now
+	}
+	s.recordEligibilityCheck(ctx, userID, evaluatedAt, cached.Verdicts)
+	if s.events != nil {
+		s.events.PublishEligibilityChecked(ctx, userID, cached.Response.EligibleOffers)
+	}
+	return cacheKey, cached.Response, true
+}
+
+// evaluateEligibility evaluates the user against activeOffers, caches the
+// result under cacheKey and records the check.
+func (s *Service) evaluateEligibility(ctx context.Context, userID string, now time.Time, activeOffers []models.Offer, cacheKey string) (models.EligibleOffersResponse, error) {
+	tenantID := tenant.FromContext(ctx)
+
+	transactions, err := s.loadUserTransactions(tenantID, userID, activeOffers, now)
+	if err != nil {
+		return models.EligibleOffersResponse{}, err
+	}
+
+	excluded, err := s.excludedOffers(tenantID, userID, activeOffers, transactions, now)
+	if err != nil {
+		return models.EligibleOffersResponse{}, err
+	}
+
 	var eligibleOffers []models.EligibleOffer
+	verdicts := make([]models.OfferCheckVerdict, 0, len(activeOffers))
 
 	for _, offer := range activeOffers {
-		matchCount, err := s.db.CountMatchingTransactions(userID, offer, now)
-		if err != nil {
-			return models.EligibleOffersResponse{}, fmt.Errorf("failed to count transactions: %w", err)
+		if criterion, ok := excluded[offer.ID]; ok {
+			verdicts = append(verdicts, models.OfferCheckVerdict{
+				OfferID:      offer.ID,
+				OfferVersion: offer.Version,
+				Reason:       exclusionReason(criterion),
+			})
+			continue
 		}
 
-		if matchCount >= offer.MinTxnCount {
-			reason := fmt.Sprintf(">= %d matching transactions in last %d days (found %d)",
-				offer.MinTxnCount, offer.LookbackDays, matchCount)
+		eligible, reason := evaluateOffer(offer, transactions, now)
+		if eligible {
 			eligibleOffers = append(eligibleOffers, models.EligibleOffer{
 				OfferID: offer.ID,
 				Reason:  reason,
 			})
 		}
+		verdicts = append(verdicts, models.OfferCheckVerdict{
+			OfferID:      offer.ID,
+			OfferVersion: offer.Version,
+			Eligible:     eligible,
+			Reason:       reason,
+		})
 	}
 
 	response := models.EligibleOffersResponse{
@@ -103,9 +461,72 @@ func (s *Service) GetEligibleOffers(ctx context.Context, userID string, now time
 		EligibleOffers: eligibleOffers,
 	}
 
+	if cacheKey != "" {
+		s.setCachedEligibility(ctx, cacheKey, cachedEligibility{Response: response, Verdicts: verdicts, EvaluatedAt: now})
+	}
+
+	s.recordEligibilityCheck(ctx, userID, now, verdicts)
+
 	if s.events != nil {
 		s.events.PublishEligibilityChecked(ctx, userID, eligibleOffers)
 	}
 
 	return response, nil
 }
+
+// ExplainEligibility returns a verdict for every active offer, including the
+// ones the user is not eligible for. It always reads through to the database
+// so support tooling never sees a cached answer.
+func (s *Service) ExplainEligibility(ctx context.Context, userID string, now time.Time) (models.EligibilityExplanationResponse, error) {
+	if err := validation.ValidateUUID(userID, "user_id"); err != nil {
+		return models.EligibilityExplanationResponse{}, err
+	}
+
+	tenantID := tenant.FromContext(ctx)
+
+	activeOffers, err := s.db.GetActiveOffers(tenantID, now)
+	if err != nil {
+		return models.EligibilityExplanationResponse{}, fmt.Errorf("failed to get active offers: %w", err)
+	}
+
+	transactions, err := s.loadUserTransactions(tenantID, userID, activeOffers, now)
+	if err != nil {
+		return models.EligibilityExplanationResponse{}, err
+	}
+
+	excluded, err := s.excludedOffers(tenantID, userID, activeOffers, transactions, now)
+	if err != nil {
+		return models.EligibilityExplanationResponse{}, err
+	}
+
+	verdicts := make([]models.OfferVerdict, 0, len(activeOffers))
+	for _, offer := range activeOffers {
+		verdict := explainOffer(offer, transactions, now)
+		if criterion, ok := excluded[offer.ID]; ok {
+			verdict.Eligible = false
+			verdict.FailedCriterion = criterion
+			verdict.FailedPath = ""
+		}
+		verdicts = append(verdicts, verdict)
+	}
+
+	return models.EligibilityExplanationResponse{
+		UserID:      userID,
+		EvaluatedAt: now,
+		Offers:      verdicts,
+	}, nil
+}
+
+func (s *Service) loadUserTransactions(tenantID, userID string, offers []models.Offer, now time.Time) ([]models.Transaction, error) {
+	if len(offers) == 0 {
+		return nil, nil
+	}
+
+	from := now.AddDate(0, 0, -maxLookbackDays(offers))
+	transactions, err := s.db.GetUserTransactions(tenantID, userID, from, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transactions: %w", err)
+	}
+
+	return transactions, nil
+}
@@ -2,19 +2,28 @@ package service
 
 import (
 	"context"
-	"os"
+	"errors"
+	"expvar"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"offer-eligibility-api/internal/cache"
 	"offer-eligibility-api/internal/database"
 	"offer-eligibility-api/internal/events"
 	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
+	"offer-eligibility-api/internal/validation"
 
 	"github.com/google/uuid"
 )
 
-func setupTestDB(t *testing.T) (*database.DB, func()) {
-	dbPath := "./test_" + time.Now().Format("20060102150405") + ".db"
+func setupTestDB(t testing.TB) (*database.DB, func()) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
 	db, err := database.NewDB(dbPath)
 	if err != nil {
 		t.Fatalf("Failed to create test database: %v", err)
@@ -22,7 +31,6 @@ func setupTestDB(t *testing.T) (*database.DB, func()) {
 
 	cleanup := func() {
 		db.Close()
-		os.Remove(dbPath)
 	}
 
 	return db, cleanup
@@ -34,6 +42,7 @@ func TestGetEligibleOffers_UserQualifies(t *testing.T) {
 
 	svc := NewService(db)
 	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
 
 	offerID := uuid.New().String()
 	merchantID := uuid.New().String()
@@ -270,6 +279,7 @@ func TestGetEligibleOffers_MultipleOffers(t *testing.T) {
 
 	svc := NewService(db)
 	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
 
 	offer1ID := uuid.New().String()
 	merchant1ID := uuid.New().String()
@@ -520,3 +530,2641 @@ func TestGetEligibleOffers_InvalidUserID(t *testing.T) {
 		t.Error("Expected error for invalid user_id")
 	}
 }
+
+func TestDeleteOffer_ExcludedFromEligibility(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+
+	merchantID := uuid.New().String()
+	userID := uuid.New().String()
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+
+	if err := svc.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	transactions := []models.Transaction{
+		{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		},
+	}
+
+	if _, err := svc.CreateTransactions(context.Background(), transactions); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	if err := svc.DeleteOffer(context.Background(), offer.ID); err != nil {
+		t.Fatalf("Failed to delete offer: %v", err)
+	}
+
+	response, err := svc.GetEligibleOffers(context.Background(), userID, now)
+	if err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+
+	if len(response.EligibleOffers) != 0 {
+		t.Fatalf("Expected 0 eligible offers (offer is deleted), got %d", len(response.EligibleOffers))
+	}
+
+	if _, err := svc.GetOffer(context.Background(), offer.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for deleted offer, got %v", err)
+	}
+
+	if err := svc.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to recreate offer: %v", err)
+	}
+
+	if _, err := svc.GetOffer(context.Background(), offer.ID); err != nil {
+		t.Errorf("Expected recreated offer to be readable, got %v", err)
+	}
+}
+
+func TestPatchOffer_NotFound(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+
+	active := false
+	_, err := svc.PatchOffer(context.Background(), uuid.New().String(), models.OfferPatch{Active: &active})
+	if !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestGetEligibleOffers_CacheInvalidatedByWrites(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	svc.SetCache(cache.NewInMemoryCache(), time.Minute)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	merchantID := uuid.New().String()
+	userID := uuid.New().String()
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  2,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+
+	if err := svc.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	newTxn := func() models.Transaction {
+		return models.Transaction{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		}
+	}
+
+	if _, err := svc.CreateTransactions(context.Background(), []models.Transaction{newTxn()}); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	response, err := svc.GetEligibleOffers(context.Background(), userID, now)
+	if err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+	if len(response.EligibleOffers) != 0 {
+		t.Fatalf("Expected 0 eligible offers before second transaction, got %d", len(response.EligibleOffers))
+	}
+
+	if _, err := svc.CreateTransactions(context.Background(), []models.Transaction{newTxn()}); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	response, err = svc.GetEligibleOffers(context.Background(), userID, now)
+	if err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+	if len(response.EligibleOffers) != 1 {
+		t.Fatalf("Expected 1 eligible offer after new transaction, got %d", len(response.EligibleOffers))
+	}
+
+	offer.MinTxnCount = 3
+	if err := svc.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to update offer: %v", err)
+	}
+
+	response, err = svc.GetEligibleOffers(context.Background(), userID, now)
+	if err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+	if len(response.EligibleOffers) != 0 {
+		t.Fatalf("Expected 0 eligible offers after offer update, got %d", len(response.EligibleOffers))
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	svc.SetCache(cache.NewInMemoryCache(), time.Minute)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	tenantA := tenant.WithTenant(context.Background(), "tenant-a")
+	tenantB := tenant.WithTenant(context.Background(), "tenant-b")
+
+	merchantID := uuid.New().String()
+	userID := uuid.New().String()
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		TenantID:     "tenant-b",
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+
+	if err := svc.CreateOffer(tenantA, offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	txn := models.Transaction{
+		ID:          uuid.New().String(),
+		TenantID:    "tenant-b",
+		UserID:      userID,
+		MerchantID:  merchantID,
+		MCC:         "5812",
+		AmountCents: 1000,
+		ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+	}
+	if _, err := svc.CreateTransactions(tenantA, []models.Transaction{txn}); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	response, err := svc.GetEligibleOffers(tenantA, userID, now)
+	if err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+	if len(response.EligibleOffers) != 1 {
+		t.Fatalf("Expected 1 eligible offer for tenant-a, got %d", len(response.EligibleOffers))
+	}
+
+	response, err = svc.GetEligibleOffers(tenantB, userID, now)
+	if err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+	if len(response.EligibleOffers) != 0 {
+		t.Errorf("Expected no eligible offers for tenant-b, got %d", len(response.EligibleOffers))
+	}
+
+	if _, err := svc.GetOffer(tenantB, offer.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound reading tenant-a's offer from tenant-b, got %v", err)
+	}
+
+	reused := offer
+	reused.MinTxnCount = 5
+	if err := svc.CreateOffer(tenantB, reused); err != nil {
+		t.Errorf("Expected tenant-b to create its own offer with the same ID, got %v", err)
+	}
+
+	got, err := svc.GetOffer(tenantA, offer.ID)
+	if err != nil {
+		t.Fatalf("Failed to get offer: %v", err)
+	}
+	if got.TenantID != "tenant-a" || got.MinTxnCount != 1 {
+		t.Errorf("Expected tenant-a's offer to be untouched, got %+v", got)
+	}
+	if got, err := svc.GetOffer(tenantB, offer.ID); err != nil || got.MinTxnCount != 5 {
+		t.Errorf("Expected tenant-b's own offer, got %+v (%v)", got, err)
+	}
+}
+
+func TestGetEligibleOffers_ServedFromCache(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	svc.SetCache(cache.NewInMemoryCache(), time.Minute)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	userID := uuid.New().String()
+
+	if _, err := svc.GetEligibleOffers(context.Background(), userID, now); err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+
+	db.Close()
+
+	if _, err := svc.GetEligibleOffers(context.Background(), userID, now.Add(10*time.Second)); err != nil {
+		t.Errorf("Expected cached response within the same time bucket, got error: %v", err)
+	}
+}
+
+func TestGetEligibleOffers_CacheHitRecordsOriginalEvaluation(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	svc.SetCache(cache.NewInMemoryCache(), time.Minute)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+	userID := uuid.New().String()
+
+	if _, err := svc.GetEligibleOffers(ctx, userID, now); err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+	if _, err := svc.GetEligibleOffers(ctx, userID, now.Add(10*time.Second)); err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+
+	history, err := svc.GetEligibilityHistory(ctx, userID, models.EligibilityHistoryFilter{}, "")
+	if err != nil {
+		t.Fatalf("Failed to get eligibility history: %v", err)
+	}
+	if len(history.Checks) != 2 {
+		t.Fatalf("Expected 2 recorded checks, got %d", len(history.Checks))
+	}
+	for _, check := range history.Checks {
+		if !check.EvaluatedAt.Equal(now) {
+			t.Errorf("Expected every check to be recorded as evaluated for %v, got %v", now, check.EvaluatedAt)
+		}
+	}
+}
+
+// seedBenchmarkData creates offerCount live offers and 200 transactions for
+// userID in the tenant.
+func seedBenchmarkData(tb testing.TB, db *database.DB, tenantID string, offerCount int, userID string) {
+	mccs := []string{"5812", "5814", "5411", "5541", "5912"}
+	merchantIDs := make([]string, 20)
+	for i := range merchantIDs {
+		merchantIDs[i] = uuid.New().String()
+	}
+
+	for i := 0; i < offerCount; i++ {
+		offer := models.Offer{
+			ID:            uuid.New().String(),
+			TenantID:      tenantID,
+			MerchantID:    merchantIDs[i%len(merchantIDs)],
+			MCCWhitelist:  []string{mccs[i%len(mccs)]},
+			Active:        true,
+			MinTxnCount:   1 + i%5,
+			MinSpendCents: int64(1000 * (i % 7)),
+			LookbackDays:  7 + i%60,
+			StartsAt:      time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndsAt:        time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+		if err := db.UpsertOffer(offer, "tester", offer.StartsAt); err != nil {
+			tb.Fatalf("Failed to create offer: %v", err)
+		}
+	}
+
+	transactions := make([]models.Transaction, 200)
+	for i := range transactions {
+		transactions[i] = models.Transaction{
+			ID:          uuid.New().String(),
+			TenantID:    tenantID,
+			UserID:      userID,
+			MerchantID:  merchantIDs[i%len(merchantIDs)],
+			MCC:         mccs[i%len(mccs)],
+			AmountCents: int64(100 * (i + 1)),
+			ApprovedAt:  time.Date(2025, 10, 21, 0, 0, 0, 0, time.UTC).Add(-time.Duration(i) * 7 * time.Hour),
+		}
+	}
+	if _, err := db.InsertTransactions(transactions); err != nil {
+		tb.Fatalf("Failed to create transactions: %v", err)
+	}
+}
+
+func TestGetEligibleOffers_MatchesPerOfferCount(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	userID := uuid.New().String()
+
+	const offerCount = 100
+	seedBenchmarkData(t, db, tenant.Default, offerCount, userID)
+
+	offers, err := db.GetActiveOffers(tenant.Default, now)
+	if err != nil {
+		t.Fatalf("Failed to get active offers: %v", err)
+	}
+	if len(offers) != offerCount {
+		t.Fatalf("Expected %d active offers, got %d", offerCount, len(offers))
+	}
+
+	expected := make(map[string]bool)
+	for _, offer := range offers {
+		summary, err := db.SummarizeMatchingTransactions(userID, offer, now)
+		if err != nil {
+			t.Fatalf("Failed to summarize transactions: %v", err)
+		}
+		if summary.Count >= offer.MinTxnCount &&
+			summary.TotalCents >= offer.MinSpendCents &&
+			summary.MaxCents >= offer.MinTxnAmountCents {
+			expected[offer.ID] = true
+		}
+	}
+
+	response, err := svc.GetEligibleOffers(context.Background(), userID, now)
+	if err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+
+	if len(expected) == 0 {
+		t.Fatal("Expected the seeded transactions to unlock some offers")
+	}
+	if len(response.EligibleOffers) != len(expected) {
+		t.Fatalf("Expected %d eligible offers, got %d", len(expected), len(response.EligibleOffers))
+	}
+
+	for _, eo := range response.EligibleOffers {
+		if !expected[eo.OfferID] {
+			t.Errorf("Offer %s eligible in memory but not per SQL count", eo.OfferID)
+		}
+	}
+}
+
+// countingStore counts the Store reads and writes made while checking
+// eligibility.
+type countingStore struct {
+	database.Store
+	calls int
+}
+
+func (c *countingStore) GetOffer(tenantID, id string) (models.Offer, error) {
+	c.calls++
+	return c.Store.GetOffer(tenantID, id)
+}
+
+func (c *countingStore) ListOffers(tenantID string, filter models.OfferFilter) ([]models.Offer, error) {
+	c.calls++
+	return c.Store.ListOffers(tenantID, filter)
+}
+
+func (c *countingStore) GetActiveOffers(tenantID string, now time.Time) ([]models.Offer, error) {
+	c.calls++
+	return c.Store.GetActiveOffers(tenantID, now)
+}
+
+func (c *countingStore) GetUserTransactions(tenantID, userID string, from, to time.Time) ([]models.Transaction, error) {
+	c.calls++
+	return c.Store.GetUserTransactions(tenantID, userID, from, to)
+}
+
+func (c *countingStore) GetExhaustedOffers(tenantID, userID string) (map[string]models.RuleType, error) {
+	c.calls++
+	return c.Store.GetExhaustedOffers(tenantID, userID)
+}
+
+func (c *countingStore) GetSegments(tenantID string, ids []string) ([]models.Segment, error) {
+	c.calls++
+	return c.Store.GetSegments(tenantID, ids)
+}
+
+func (c *countingStore) GetUserSegmentIDs(tenantID, userID string) (map[string]bool, error) {
+	c.calls++
+	return c.Store.GetUserSegmentIDs(tenantID, userID)
+}
+
+func (c *countingStore) RecordEligibilityCheck(check models.EligibilityCheck) error {
+	c.calls++
+	return c.Store.RecordEligibilityCheck(check)
+}
+
+// Guards the single-load path: checking eligibility loads the user's
+// transactions once, so the number of queries must not grow with the number of
+// live offers.
+func TestGetEligibleOffers_QueriesDoNotGrowWithOffers(t *testing.T) {
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	ctx := tenant.WithTenant(context.Background(), "tenant-a")
+
+	queries := func(offerCount int) int {
+		db, cleanup := setupTestDB(t)
+		defer cleanup()
+
+		userID := uuid.New().String()
+		seedBenchmarkData(t, db, "tenant-a", offerCount, userID)
+		seedBenchmarkData(t, db, tenant.Default, offerCount, userID)
+
+		store := &countingStore{Store: db}
+		svc := NewService(store)
+		response, err := svc.GetEligibleOffers(ctx, userID, now)
+		if err != nil {
+			t.Fatalf("Failed to get eligible offers: %v", err)
+		}
+		if len(response.EligibleOffers) == 0 || len(response.EligibleOffers) > offerCount {
+			t.Fatalf("Expected between 1 and %d eligible offers, got %d", offerCount, len(response.EligibleOffers))
+		}
+		return store.calls
+	}
+
+	few, many := queries(5), queries(200)
+	if many != few {
+		t.Errorf("Expected the same number of queries for 5 and 200 offers, got %d and %d", few, many)
+	}
+	if many > 4 {
+		t.Errorf("Expected at most 4 queries per eligibility check, got %d", many)
+	}
+}
+
+func BenchmarkGetEligibleOffers(b *testing.B) {
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+
+	for _, offerCount := range []int{10, 100, 1000} {
+		db, cleanup := setupTestDB(b)
+		userID := uuid.New().String()
+		seedBenchmarkData(b, db, tenant.Default, offerCount, userID)
+		svc := NewService(db)
+
+		b.Run(fmt.Sprintf("single_query/offers=%d", offerCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := svc.GetEligibleOffers(context.Background(), userID, now); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(fmt.Sprintf("per_offer_count/offers=%d", offerCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				offers, err := db.GetActiveOffers(tenant.Default, now)
+				if err != nil {
+					b.Fatal(err)
+				}
+				for _, offer := range offers {
+					if _, err := db.SummarizeMatchingTransactions(userID, offer, now); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+
+		cleanup()
+	}
+}
+
+func TestGetEligibleOffers_RuleTree(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	merchantID := uuid.New().String()
+	userID := uuid.New().String()
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+		Rules: &models.Rule{Type: models.RuleAnd, Rules: []models.Rule{
+			{Type: models.RuleMinSpendCents, Value: 5000, Match: &models.TransactionMatch{AnyMerchant: true, ExcludeMCCs: []string{"5541"}}},
+			{Type: models.RuleMinDistinctMerchants, Value: 2, Match: &models.TransactionMatch{AnyMerchant: true}},
+		}},
+	}
+
+	if err := svc.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	stored, err := svc.GetOffer(context.Background(), offer.ID)
+	if err != nil {
+		t.Fatalf("Failed to get offer: %v", err)
+	}
+	if stored.Rules == nil || len(stored.Rules.Rules) != 2 {
+		t.Fatalf("Expected rule tree to round-trip, got %+v", stored.Rules)
+	}
+
+	transactions := []models.Transaction{
+		{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 3000,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  uuid.New().String(),
+			MCC:         "5541",
+			AmountCents: 9000,
+			ApprovedAt:  time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC),
+		},
+	}
+
+	if _, err := svc.CreateTransactions(context.Background(), transactions); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	response, err := svc.GetEligibleOffers(context.Background(), userID, now)
+	if err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+	if len(response.EligibleOffers) != 0 {
+		t.Fatalf("Expected 0 eligible offers (fuel spend excluded), got %d", len(response.EligibleOffers))
+	}
+
+	extra := models.Transaction{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		MerchantID:  uuid.New().String(),
+		MCC:         "5411",
+		AmountCents: 2500,
+		ApprovedAt:  time.Date(2025, 10, 20, 18, 0, 0, 0, time.UTC),
+	}
+
+	if _, err := svc.CreateTransactions(context.Background(), []models.Transaction{extra}); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	response, err = svc.GetEligibleOffers(context.Background(), userID, now)
+	if err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+	if len(response.EligibleOffers) != 1 {
+		t.Fatalf("Expected 1 eligible offer, got %d", len(response.EligibleOffers))
+	}
+}
+
+func TestCreateOffer_InvalidRuleTree(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   uuid.New().String(),
+		Active:       true,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+		Rules: &models.Rule{Type: models.RuleNot, Rules: []models.Rule{
+			{Type: models.RuleMinTxnCount, Value: 1, Match: &models.TransactionMatch{DaysOfWeek: []string{"funday"}}},
+		}},
+	}
+
+	err := svc.CreateOffer(context.Background(), offer)
+
+	var validationErr *validation.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected validation error, got %v", err)
+	}
+
+	if validationErr.Field != "rules.rules[0].match.days_of_week[0]" {
+		t.Errorf("Expected error on rules.rules[0].match.days_of_week[0], got %s", validationErr.Field)
+	}
+}
+
+func TestGetEligibleOffers_MinSpendThresholds(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	merchantID := uuid.New().String()
+	userID := uuid.New().String()
+
+	offer := models.Offer{
+		ID:                uuid.New().String(),
+		MerchantID:        merchantID,
+		Active:            true,
+		MinTxnCount:       2,
+		MinSpendCents:     5000,
+		MinTxnAmountCents: 3000,
+		LookbackDays:      30,
+		StartsAt:          time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:            time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+
+	if err := svc.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	newTxn := func(amountCents int64) models.Transaction {
+		return models.Transaction{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: amountCents,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		}
+	}
+
+	if _, err := svc.CreateTransactions(context.Background(), []models.Transaction{newTxn(2500), newTxn(2500)}); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	response, err := svc.GetEligibleOffers(context.Background(), userID, now)
+	if err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+	if len(response.EligibleOffers) != 0 {
+		t.Fatalf("Expected 0 eligible offers (no single transaction >= 3000), got %d", len(response.EligibleOffers))
+	}
+
+	if _, err := svc.CreateTransactions(context.Background(), []models.Transaction{newTxn(3200)}); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	response, err = svc.GetEligibleOffers(context.Background(), userID, now)
+	if err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+	if len(response.EligibleOffers) != 1 {
+		t.Fatalf("Expected 1 eligible offer, got %d", len(response.EligibleOffers))
+	}
+
+	expectedReason := ">= 2 matching transactions in last 30 days (found 3, spent 8200 cents); spend >= 5000 cents; single transaction >= 3000 cents (largest 3200 cents)"
+	if response.EligibleOffers[0].Reason != expectedReason {
+		t.Errorf("Expected reason %q, got %q", expectedReason, response.EligibleOffers[0].Reason)
+	}
+
+	offer.TenantID = tenant.Default
+	summary, err := db.SummarizeMatchingTransactions(userID, offer, now)
+	if err != nil {
+		t.Fatalf("Failed to summarize transactions: %v", err)
+	}
+	if summary.Count != 3 || summary.TotalCents != 8200 || summary.MaxCents != 3200 {
+		t.Errorf("Expected summary {3 8200 3200}, got %+v", summary)
+	}
+}
+
+func TestExplainEligibility_IncludesIneligibleOffers(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	merchantID := uuid.New().String()
+	userID := uuid.New().String()
+
+	eligibleOffer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	spendOffer := eligibleOffer
+	spendOffer.ID = uuid.New().String()
+	spendOffer.MinSpendCents = 10000
+
+	for _, offer := range []models.Offer{eligibleOffer, spendOffer} {
+		if err := svc.CreateOffer(context.Background(), offer); err != nil {
+			t.Fatalf("Failed to create offer: %v", err)
+		}
+	}
+
+	txnID := uuid.New().String()
+	txns := []models.Transaction{{
+		ID:          txnID,
+		UserID:      userID,
+		MerchantID:  merchantID,
+		MCC:         "5812",
+		AmountCents: 2500,
+		ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+	}}
+	if _, err := svc.CreateTransactions(context.Background(), txns); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	response, err := svc.ExplainEligibility(context.Background(), userID, now)
+	if err != nil {
+		t.Fatalf("Failed to explain eligibility: %v", err)
+	}
+
+	if len(response.Offers) != 2 {
+		t.Fatalf("Expected 2 verdicts, got %d", len(response.Offers))
+	}
+
+	verdicts := make(map[string]models.OfferVerdict)
+	for _, verdict := range response.Offers {
+		verdicts[verdict.OfferID] = verdict
+	}
+
+	eligible := verdicts[eligibleOffer.ID]
+	if !eligible.Eligible || eligible.FailedCriterion != "" {
+		t.Errorf("Expected offer %s to be eligible, got %+v", eligibleOffer.ID, eligible)
+	}
+	if eligible.RequiredCount != 1 || eligible.FoundCount != 1 {
+		t.Errorf("Expected required=1 found=1, got required=%d found=%d", eligible.RequiredCount, eligible.FoundCount)
+	}
+	if len(eligible.MatchedTransactionIDs) != 1 || eligible.MatchedTransactionIDs[0] != txnID {
+		t.Errorf("Expected matched transactions [%s], got %v", txnID, eligible.MatchedTransactionIDs)
+	}
+	wantStart := time.Date(2025, 9, 21, 10, 0, 0, 0, time.UTC)
+	if !eligible.WindowStart.Equal(wantStart) || !eligible.WindowEnd.Equal(now) {
+		t.Errorf("Expected window %v - %v, got %v - %v", wantStart, now, eligible.WindowStart, eligible.WindowEnd)
+	}
+
+	ineligible := verdicts[spendOffer.ID]
+	if ineligible.Eligible {
+		t.Errorf("Expected offer %s to be ineligible", spendOffer.ID)
+	}
+	if ineligible.FailedCriterion != models.RuleMinSpendCents || ineligible.FailedPath != "rules.rules[1]" {
+		t.Errorf("Expected failed criterion min_spend_cents at rules.rules[1], got %s at %s", ineligible.FailedCriterion, ineligible.FailedPath)
+	}
+	if len(ineligible.Criteria) != 2 || ineligible.Criteria[1].Found != 2500 || ineligible.Criteria[1].Required != 10000 {
+		t.Errorf("Expected spend criterion required=10000 found=2500, got %+v", ineligible.Criteria)
+	}
+}
+
+func TestCreateTransactionsIdempotent_RetryPartialBatch(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	userID := uuid.New().String()
+
+	newTxn := func(amountCents int64) models.Transaction {
+		return models.Transaction{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  uuid.New().String(),
+			MCC:         "5812",
+			AmountCents: amountCents,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		}
+	}
+
+	batch := []models.Transaction{newTxn(100), newTxn(200), newTxn(300)}
+
+	if _, err := svc.CreateTransactions(context.Background(), batch[:2]); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	conflicting := batch[1]
+	conflicting.AmountCents = 999
+	invalid := newTxn(400)
+	invalid.MCC = "12"
+
+	retry := append(append([]models.Transaction{}, batch...), conflicting, invalid)
+
+	response, err := svc.CreateTransactionsIdempotent(context.Background(), retry)
+	if err != nil {
+		t.Fatalf("Failed to ingest transactions: %v", err)
+	}
+
+	if response.Inserted != 1 || response.Duplicates != 2 || response.Rejected != 2 {
+		t.Errorf("Expected inserted=1 duplicates=2 rejected=2, got %+v", response)
+	}
+
+	if len(response.Errors) != 2 || response.Errors[0].Index != 3 || response.Errors[1].Index != 4 {
+		t.Fatalf("Expected errors at indexes 3 and 4, got %+v", response.Errors)
+	}
+	if response.Errors[0].ID != conflicting.ID {
+		t.Errorf("Expected conflict for %s, got %s", conflicting.ID, response.Errors[0].ID)
+	}
+
+	transactions, err := db.GetUserTransactions(tenant.Default, userID, time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 10, 31, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Failed to get transactions: %v", err)
+	}
+	if len(transactions) != 3 {
+		t.Errorf("Expected 3 stored transactions, got %d", len(transactions))
+	}
+	for _, txn := range transactions {
+		if txn.ID == conflicting.ID && txn.AmountCents != 200 {
+			t.Errorf("Expected conflicting payload to be ignored, got amount %d", txn.AmountCents)
+		}
+	}
+}
+
+func TestBulkImport_CommitsInChunks(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	svc.SetBulkChunkSize(2)
+
+	userID := uuid.New().String()
+	var txns []models.Transaction
+	for i := 0; i < 5; i++ {
+		txns = append(txns, models.Transaction{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  uuid.New().String(),
+			MCC:         "5812",
+			AmountCents: int64(100 * (i + 1)),
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		})
+	}
+
+	runImport := func() models.BulkImportResponse {
+		bulk := svc.NewBulkImport(context.Background())
+		for i, txn := range txns {
+			if err := bulk.Add(i+1, txn); err != nil {
+				t.Fatalf("Failed to add line %d: %v", i+1, err)
+			}
+		}
+		summary, err := bulk.Finish()
+		if err != nil {
+			t.Fatalf("Failed to finish import: %v", err)
+		}
+		return summary
+	}
+
+	summary := runImport()
+	if summary.Chunks != 3 || summary.Inserted != 5 || summary.Lines != 5 {
+		t.Errorf("Expected chunks=3 inserted=5 lines=5, got %+v", summary)
+	}
+
+	summary = runImport()
+	if summary.Inserted != 0 || summary.Duplicates != 5 {
+		t.Errorf("Expected re-running the import to only find duplicates, got %+v", summary)
+	}
+}
+
+func TestBulkImport_RefreshesEligibilityOnceFinished(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	svc.SetEventManager(events.NewManager(true))
+	svc.SetBulkChunkSize(2)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	merchantID := uuid.New().String()
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  2,
+		LookbackDays: 7,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	if err := svc.CreateOffer(ctx, offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	userIDs := []string{uuid.New().String(), uuid.New().String()}
+	bulk := svc.NewBulkImport(ctx)
+	for i := 0; i < 4; i++ {
+		txn := models.Transaction{
+			ID:          uuid.New().String(),
+			UserID:      userIDs[i%2],
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		}
+		if err := bulk.Add(i+1, txn); err != nil {
+			t.Fatalf("Failed to add line %d: %v", i+1, err)
+		}
+	}
+	if _, err := bulk.Finish(); err != nil {
+		t.Fatalf("Failed to finish import: %v", err)
+	}
+	svc.WaitForRefreshes()
+
+	due := now.Add(time.Hour)
+	pending, err := db.GetPendingOutboxEvents(due, due, 100)
+	if err != nil {
+		t.Fatalf("Failed to get pending events: %v", err)
+	}
+	gained := make(map[string]int)
+	for _, e := range pending {
+		if e.EventType != string(events.EventEligibilityGained) {
+			continue
+		}
+		data, err := events.DecodeData(events.EventEligibilityGained, e.Payload)
+		if err != nil {
+			t.Fatalf("Failed to decode event: %v", err)
+		}
+		gained[data.(events.EligibilityChangedData).UserID]++
+	}
+	for _, userID := range userIDs {
+		if gained[userID] != 1 {
+			t.Errorf("Expected one eligibility.gained for user %s, got %d", userID, gained[userID])
+		}
+	}
+}
+
+func BenchmarkBulkImport(b *testing.B) {
+	const rows = 5000
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+
+	for _, withEvents := range []bool{false, true} {
+		b.Run(fmt.Sprintf("events=%t", withEvents), func(b *testing.B) {
+			db, cleanup := setupTestDB(b)
+			defer cleanup()
+			seedBenchmarkData(b, db, tenant.Default, 100, uuid.New().String())
+
+			svc := NewService(db)
+			svc.now = func() time.Time { return now }
+			if withEvents {
+				svc.SetEventManager(events.NewManager(true))
+			}
+
+			userIDs := make([]string, 500)
+			for i := range userIDs {
+				userIDs[i] = uuid.New().String()
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				txns := make([]models.Transaction, rows)
+				for j := range txns {
+					txns[j] = models.Transaction{
+						ID:          uuid.New().String(),
+						UserID:      userIDs[j%len(userIDs)],
+						MerchantID:  uuid.New().String(),
+						MCC:         "5812",
+						AmountCents: int64(100 + j),
+						ApprovedAt:  now.Add(-time.Duration(j) * time.Minute),
+					}
+				}
+				b.StartTimer()
+
+				bulk := svc.NewBulkImport(context.Background())
+				for j, txn := range txns {
+					if err := bulk.Add(j+1, txn); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if _, err := bulk.Finish(); err != nil {
+					b.Fatal(err)
+				}
+
+				// The refresh runs after the import has answered; keep it out of
+				// the measurement but do not let refreshes pile up.
+				b.StopTimer()
+				svc.WaitForRefreshes()
+				b.StartTimer()
+			}
+		})
+	}
+}
+
+func TestCreateOffer_EventsRelayedFromOutbox(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	eventManager := events.NewManager(true)
+	svc.SetEventManager(eventManager)
+
+	var received []events.Event
+	failing := true
+	eventManager.Subscribe(events.EventOfferCreated, func(ctx context.Context, event events.Event) error {
+		if failing {
+			return errors.New("subscriber unavailable")
+		}
+		if tenant.FromContext(ctx) != "tenant-a" {
+			t.Errorf("Expected tenant-a in handler context, got %s", tenant.FromContext(ctx))
+		}
+		received = append(received, event)
+		return nil
+	})
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   uuid.New().String(),
+		MCCWhitelist: []string{"5812"},
+		Active:       true,
+		MinTxnCount:  3,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	ctx := tenant.WithTenant(context.Background(), "tenant-a")
+	if err := svc.CreateOffer(ctx, offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	pending, err := db.GetPendingOutboxEvents(later, later, 10)
+	if err != nil {
+		t.Fatalf("Failed to get pending events: %v", err)
+	}
+	if len(pending) != 1 || pending[0].EventType != string(events.EventOfferCreated) || pending[0].TenantID != "tenant-a" {
+		t.Fatalf("Expected one offer.created event in the outbox, got %+v", pending)
+	}
+
+	relay := events.NewRelay(db, eventManager, events.RelayOptions{PollInterval: time.Millisecond})
+
+	delivered, err := relay.RelayPending(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to relay events: %v", err)
+	}
+	if delivered != 0 {
+		t.Errorf("Expected no events delivered while the handler fails, got %d", delivered)
+	}
+	if pending, _ = db.GetPendingOutboxEvents(later, later, 10); len(pending) != 1 || pending[0].Attempts != 1 {
+		t.Fatalf("Expected the event to stay pending after a failure, got %+v", pending)
+	}
+
+	failing = false
+	time.Sleep(5 * time.Millisecond)
+	delivered, err = relay.RelayPending(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to relay events: %v", err)
+	}
+	if delivered != 1 || len(received) != 1 {
+		t.Fatalf("Expected the event to be delivered on retry, got %d delivered", delivered)
+	}
+	if received[0].ID != pending[0].ID {
+		t.Errorf("Expected event ID %s, got %s", pending[0].ID, received[0].ID)
+	}
+	data, ok := received[0].Data.(events.OfferCreatedData)
+	if !ok || data.Offer.ID != offer.ID {
+		t.Errorf("Unexpected event data: %+v", received[0].Data)
+	}
+
+	if pending, _ = db.GetPendingOutboxEvents(later, later, 10); len(pending) != 0 {
+		t.Errorf("Expected no pending events after delivery, got %+v", pending)
+	}
+}
+
+func TestRelay_SkipsClaimedEventsAndGivesUpOnPoisonEvents(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	eventManager := events.NewManager(true)
+	svc.SetEventManager(eventManager)
+
+	dispatched := 0
+	eventManager.Subscribe(events.EventOfferCreated, func(ctx context.Context, event events.Event) error {
+		dispatched++
+		return errors.New("cannot handle this event")
+	})
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   uuid.New().String(),
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	if err := svc.CreateOffer(context.Background(), offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	later := time.Now().Add(time.Hour)
+	pending, err := db.GetPendingOutboxEvents(later, later, 10)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("Expected one pending event, got %+v (%v)", pending, err)
+	}
+
+	relay := events.NewRelay(db, eventManager, events.RelayOptions{PollInterval: time.Millisecond, MaxAttempts: 2})
+
+	// Another server has claimed the event.
+	now := time.Now()
+	if claimed, err := db.ClaimOutboxEvent(pending[0].ID, now, now.Add(-time.Minute)); err != nil || !claimed {
+		t.Fatalf("Expected to claim the event, got %v (%v)", claimed, err)
+	}
+	if _, err := relay.RelayPending(context.Background()); err != nil {
+		t.Fatalf("Failed to relay events: %v", err)
+	}
+	if dispatched != 0 {
+		t.Fatalf("Expected a claimed event not to be dispatched, got %d dispatches", dispatched)
+	}
+	if err := db.MarkOutboxEventFailed(pending[0].ID, "released", now); err != nil {
+		t.Fatalf("Failed to release the event: %v", err)
+	}
+
+	// The release above was the first failed attempt; the next one is the
+	// last.
+	if _, err := relay.RelayPending(context.Background()); err != nil {
+		t.Fatalf("Failed to relay events: %v", err)
+	}
+	if dispatched != 1 {
+		t.Fatalf("Expected the event to be dispatched once, got %d", dispatched)
+	}
+	if pending, _ = db.GetPendingOutboxEvents(later, later, 10); len(pending) != 0 {
+		t.Errorf("Expected the event to be dead after 2 attempts, got %+v", pending)
+	}
+
+	if _, err := relay.RelayPending(context.Background()); err != nil || dispatched != 1 {
+		t.Errorf("Expected a dead event not to be dispatched again, got %d dispatches (%v)", dispatched, err)
+	}
+}
+
+func TestEligibilityChanges_GainedOnIngestLostOnSweep(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	svc.SetEventManager(events.NewManager(true))
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	userID := uuid.New().String()
+	merchantID := uuid.New().String()
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		MCCWhitelist: []string{"5812"},
+		Active:       true,
+		MinTxnCount:  2,
+		LookbackDays: 7,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	if err := svc.CreateOffer(ctx, offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	changes := func(eventType events.EventType) []events.EligibilityChangedData {
+		due := time.Now().Add(time.Hour)
+		pending, err := db.GetPendingOutboxEvents(due, due, 100)
+		if err != nil {
+			t.Fatalf("Failed to get pending events: %v", err)
+		}
+		var found []events.EligibilityChangedData
+		for _, e := range pending {
+			if e.EventType != string(eventType) {
+				continue
+			}
+			data, err := events.DecodeData(eventType, e.Payload)
+			if err != nil {
+				t.Fatalf("Failed to decode event: %v", err)
+			}
+			found = append(found, data.(events.EligibilityChangedData))
+		}
+		return found
+	}
+
+	ingest := func(day int) {
+		_, err := svc.CreateTransactions(ctx, []models.Transaction{{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  time.Date(2025, 10, day, 12, 0, 0, 0, time.UTC),
+		}})
+		if err != nil {
+			t.Fatalf("Failed to create transactions: %v", err)
+		}
+	}
+
+	ingest(19)
+	if gained := changes(events.EventEligibilityGained); len(gained) != 0 {
+		t.Fatalf("Expected no eligibility.gained after one transaction, got %+v", gained)
+	}
+
+	ingest(20)
+	gained := changes(events.EventEligibilityGained)
+	if len(gained) != 1 || gained[0].UserID != userID || gained[0].OfferID != offer.ID || gained[0].Reason == "" {
+		t.Fatalf("Expected one eligibility.gained for %s, got %+v", offer.ID, gained)
+	}
+
+	ingest(20)
+	if gained := changes(events.EventEligibilityGained); len(gained) != 1 {
+		t.Errorf("Expected eligibility.gained to be announced once, got %d", len(gained))
+	}
+
+	swept, err := svc.SweepEligibility(ctx)
+	if err != nil {
+		t.Fatalf("Failed to sweep: %v", err)
+	}
+	if swept != 0 {
+		t.Errorf("Expected no changes while the user is still eligible, got %d", swept)
+	}
+
+	// By the afternoon of the 27th every transaction is outside the 7-day window.
+	now = time.Date(2025, 10, 27, 13, 0, 0, 0, time.UTC)
+	swept, err = svc.SweepEligibility(ctx)
+	if err != nil {
+		t.Fatalf("Failed to sweep: %v", err)
+	}
+	if swept != 1 {
+		t.Fatalf("Expected 1 change after the window slides, got %d", swept)
+	}
+
+	lost := changes(events.EventEligibilityLost)
+	if len(lost) != 1 || lost[0].UserID != userID || lost[0].OfferID != offer.ID {
+		t.Fatalf("Expected one eligibility.lost for %s, got %+v", offer.ID, lost)
+	}
+
+	if swept, _ := svc.SweepEligibility(ctx); swept != 0 {
+		t.Errorf("Expected a second sweep to find nothing, got %d", swept)
+	}
+}
+
+func TestGetEligibilityHistory_RecordsEveryCheck(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	checkedAt := time.Date(2025, 10, 18, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return checkedAt }
+
+	ctx := context.Background()
+	userID := uuid.New().String()
+	merchantID := uuid.New().String()
+
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		MCCWhitelist: []string{"5812"},
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	if err := svc.CreateOffer(ctx, offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	now := time.Date(2025, 10, 20, 0, 0, 0, 0, time.UTC)
+	if _, err := svc.GetEligibleOffers(ctx, userID, now); err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+
+	if _, err := svc.CreateTransactions(ctx, []models.Transaction{{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		MerchantID:  merchantID,
+		MCC:         "5812",
+		AmountCents: 1000,
+		ApprovedAt:  time.Date(2025, 10, 19, 12, 0, 0, 0, time.UTC),
+	}}); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+	if _, err := svc.PatchOffer(ctx, offer.ID, models.OfferPatch{}); err != nil {
+		t.Fatalf("Failed to patch offer: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		checkedAt = checkedAt.Add(time.Hour)
+		if _, err := svc.GetEligibleOffers(ctx, userID, now); err != nil {
+			t.Fatalf("Failed to get eligible offers: %v", err)
+		}
+	}
+
+	history, err := svc.GetEligibilityHistory(ctx, userID, models.EligibilityHistoryFilter{Limit: 2}, "")
+	if err != nil {
+		t.Fatalf("Failed to get eligibility history: %v", err)
+	}
+	if len(history.Checks) != 2 || history.NextCursor == "" {
+		t.Fatalf("Expected a first page of 2 checks with a cursor, got %+v", history)
+	}
+
+	latest := history.Checks[0]
+	if !latest.CheckedAt.Equal(checkedAt) || !latest.EvaluatedAt.Equal(now) {
+		t.Errorf("Expected check at %v evaluated for %v, got %+v", checkedAt, now, latest)
+	}
+	if len(latest.Offers) != 1 || !latest.Offers[0].Eligible || latest.Offers[0].OfferVersion != 2 {
+		t.Errorf("Expected an eligible verdict for offer version 2, got %+v", latest.Offers)
+	}
+
+	page, err := svc.GetEligibilityHistory(ctx, userID, models.EligibilityHistoryFilter{Limit: 2}, history.NextCursor)
+	if err != nil {
+		t.Fatalf("Failed to get eligibility history: %v", err)
+	}
+	if len(page.Checks) != 1 || page.NextCursor != "" {
+		t.Fatalf("Expected a last page with 1 check, got %+v", page)
+	}
+	first := page.Checks[0]
+	if len(first.Offers) != 1 || first.Offers[0].Eligible || first.Offers[0].OfferVersion != 1 {
+		t.Errorf("Expected the first check to record an ineligible verdict for version 1, got %+v", first.Offers)
+	}
+
+	from := checkedAt
+	ranged, err := svc.GetEligibilityHistory(ctx, userID, models.EligibilityHistoryFilter{From: &from}, "")
+	if err != nil {
+		t.Fatalf("Failed to get eligibility history: %v", err)
+	}
+	if len(ranged.Checks) != 1 || ranged.Checks[0].ID != latest.ID {
+		t.Errorf("Expected only the latest check from %v, got %+v", from, ranged.Checks)
+	}
+
+	if _, err := svc.GetEligibilityHistory(ctx, userID, models.EligibilityHistoryFilter{}, "not-a-cursor"); err == nil {
+		t.Error("Expected an invalid cursor to be rejected")
+	}
+}
+
+func TestRedeemOffer_CapsExcludeExhaustedOffers(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	svc.SetCache(cache.NewInMemoryCache(), time.Minute)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	merchantID := uuid.New().String()
+	offer := models.Offer{
+		ID:                    uuid.New().String(),
+		MerchantID:            merchantID,
+		Active:                true,
+		MinTxnCount:           1,
+		LookbackDays:          30,
+		StartsAt:              time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:                time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+		MaxRedemptions:        3,
+		MaxRedemptionsPerUser: 2,
+	}
+	if err := svc.CreateOffer(ctx, offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	alice, bob, carol := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	for _, userID := range []string{alice, bob} {
+		if _, err := svc.CreateTransactions(ctx, []models.Transaction{{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		}}); err != nil {
+			t.Fatalf("Failed to create transactions: %v", err)
+		}
+	}
+
+	eligibleCount := func(userID string) int {
+		t.Helper()
+		response, err := svc.GetEligibleOffers(ctx, userID, now)
+		if err != nil {
+			t.Fatalf("Failed to get eligible offers: %v", err)
+		}
+		return len(response.EligibleOffers)
+	}
+	redeem := func(userID string) error {
+		_, err := svc.RedeemOffer(ctx, userID, offer.ID)
+		return err
+	}
+
+	if err := redeem(alice); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("Expected redeeming before activation to conflict, got %v", err)
+	}
+	if _, _, err := svc.ActivateOffer(ctx, carol, offer.ID); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("Expected an ineligible user's activation to conflict, got %v", err)
+	}
+	if _, _, err := svc.ActivateOffer(ctx, alice, uuid.New().String()); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound activating an unknown offer, got %v", err)
+	}
+
+	for i, wantCreated := range []bool{true, false} {
+		activation, created, err := svc.ActivateOffer(ctx, alice, offer.ID)
+		if err != nil {
+			t.Fatalf("Failed to activate offer: %v", err)
+		}
+		if created != wantCreated || !activation.ActivatedAt.Equal(now) {
+			t.Errorf("Activation %d: expected created=%v at %v, got %v %+v", i+1, wantCreated, now, created, activation)
+		}
+	}
+
+	if eligibleCount(alice) != 1 {
+		t.Fatal("Expected alice to be eligible before redeeming")
+	}
+	for i := 1; i <= 2; i++ {
+		redemption, err := svc.RedeemOffer(ctx, alice, offer.ID)
+		if err != nil {
+			t.Fatalf("Failed to redeem offer: %v", err)
+		}
+		if redemption.UserRedemptionCount != i || redemption.OfferRedemptionCount != i {
+			t.Errorf("Expected counts %d/%d, got %+v", i, i, redemption)
+		}
+	}
+	if err := redeem(alice); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("Expected the per-user cap to conflict, got %v", err)
+	}
+	if n := eligibleCount(alice); n != 0 {
+		t.Errorf("Expected alice's exhausted offer to be excluded, got %d eligible", n)
+	}
+
+	explanation, err := svc.ExplainEligibility(ctx, alice, now)
+	if err != nil {
+		t.Fatalf("Failed to explain eligibility: %v", err)
+	}
+	if len(explanation.Offers) != 1 || explanation.Offers[0].Eligible ||
+		explanation.Offers[0].FailedCriterion != models.CriterionMaxRedemptionsPerUser {
+		t.Errorf("Expected a max_redemptions_per_user verdict, got %+v", explanation.Offers)
+	}
+
+	if eligibleCount(bob) != 1 {
+		t.Fatal("Expected bob to be eligible before the global cap")
+	}
+	if _, _, err := svc.ActivateOffer(ctx, bob, offer.ID); err != nil {
+		t.Fatalf("Failed to activate offer: %v", err)
+	}
+	if err := redeem(bob); err != nil {
+		t.Fatalf("Failed to redeem offer: %v", err)
+	}
+	if err := redeem(bob); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("Expected the global cap to conflict, got %v", err)
+	}
+	if n := eligibleCount(bob); n != 0 {
+		t.Errorf("Expected the globally exhausted offer to be excluded, got %d eligible", n)
+	}
+}
+
+func TestRedeemOffer_BudgetExhaustionHidesOffer(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	svc.SetCache(cache.NewInMemoryCache(), time.Minute)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	merchantID := uuid.New().String()
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+		BudgetCents:  500,
+		RewardCents:  500,
+	}
+	if err := svc.CreateOffer(ctx, offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	alice, bob := uuid.New().String(), uuid.New().String()
+	for _, userID := range []string{alice, bob} {
+		if _, err := svc.CreateTransactions(ctx, []models.Transaction{{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		}}); err != nil {
+			t.Fatalf("Failed to create transactions: %v", err)
+		}
+	}
+
+	if response, _ := svc.GetEligibleOffers(ctx, bob, now); len(response.EligibleOffers) != 1 {
+		t.Fatalf("Expected bob to be eligible before the budget is spent, got %+v", response)
+	}
+
+	if _, _, err := svc.ActivateOffer(ctx, alice, offer.ID); err != nil {
+		t.Fatalf("Failed to activate offer: %v", err)
+	}
+	redemption, err := svc.RedeemOffer(ctx, alice, offer.ID)
+	if err != nil {
+		t.Fatalf("Failed to redeem offer: %v", err)
+	}
+	if !redemption.BudgetExhausted || redemption.RewardCents != 500 {
+		t.Errorf("Expected the redemption to exhaust the budget, got %+v", redemption)
+	}
+
+	response, err := svc.GetEligibleOffers(ctx, bob, now)
+	if err != nil {
+		t.Fatalf("Failed to get eligible offers: %v", err)
+	}
+	if len(response.EligibleOffers) != 0 {
+		t.Errorf("Expected the exhausted offer to be hidden, got %+v", response.EligibleOffers)
+	}
+	if _, _, err := svc.ActivateOffer(ctx, bob, offer.ID); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("Expected activating an exhausted offer to conflict, got %v", err)
+	}
+
+	invalid := offer
+	invalid.RewardCents = 0
+	var validationErr *validation.ValidationError
+	if err := svc.CreateOffer(ctx, invalid); !errors.As(err, &validationErr) {
+		t.Errorf("Expected a budget without a reward to be rejected, got %v", err)
+	}
+}
+
+func TestRedeemOffer_RejectsOffersThatAreNotLive(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	merchantID := uuid.New().String()
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	if err := svc.CreateOffer(ctx, offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	userID := uuid.New().String()
+	if _, err := svc.CreateTransactions(ctx, []models.Transaction{{
+		ID:          uuid.New().String(),
+		UserID:      userID,
+		MerchantID:  merchantID,
+		MCC:         "5812",
+		AmountCents: 1000,
+		ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+	}}); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+	if _, _, err := svc.ActivateOffer(ctx, userID, offer.ID); err != nil {
+		t.Fatalf("Failed to activate offer: %v", err)
+	}
+
+	for _, at := range []time.Time{offer.StartsAt.Add(-time.Second), offer.EndsAt.Add(time.Second)} {
+		svc.now = func() time.Time { return at }
+		if _, err := svc.RedeemOffer(ctx, userID, offer.ID); !errors.Is(err, database.ErrConflict) {
+			t.Errorf("Expected ErrConflict redeeming at %s, outside the schedule, got %v", at, err)
+		}
+	}
+
+	svc.now = func() time.Time { return now }
+	if _, err := svc.RedeemOffer(ctx, userID, offer.ID); err != nil {
+		t.Fatalf("Failed to redeem offer: %v", err)
+	}
+
+	inactive := false
+	if _, err := svc.PatchOffer(ctx, offer.ID, models.OfferPatch{Active: &inactive}); err != nil {
+		t.Fatalf("Failed to patch offer: %v", err)
+	}
+	if _, err := svc.RedeemOffer(ctx, userID, offer.ID); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("Expected ErrConflict redeeming an inactive offer, got %v", err)
+	}
+
+	if err := svc.DeleteOffer(ctx, offer.ID); err != nil {
+		t.Fatalf("Failed to delete offer: %v", err)
+	}
+	if _, err := svc.RedeemOffer(ctx, userID, offer.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound redeeming a deleted offer, got %v", err)
+	}
+}
+
+func TestGetEligibleOffers_SegmentTargeting(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	svc.SetCache(cache.NewInMemoryCache(), time.Minute)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	vip, err := svc.CreateSegment(ctx, models.CreateSegmentRequest{Name: "vip", Type: models.SegmentTypeList})
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+	// The offer looks back 30 days; the rule segment needs the older purchase.
+	regulars, err := svc.CreateSegment(ctx, models.CreateSegmentRequest{
+		Name:         "regulars",
+		Type:         models.SegmentTypeRule,
+		Rule:         &models.Rule{Type: models.RuleMinTxnCount, Value: 2},
+		LookbackDays: 90,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+
+	merchantID := uuid.New().String()
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+		Segments:     []string{vip.ID, regulars.ID},
+	}
+	if err := svc.CreateOffer(ctx, offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	unknown := offer
+	unknown.ID = uuid.New().String()
+	unknown.Segments = []string{uuid.New().String()}
+	var validationErr *validation.ValidationError
+	if err := svc.CreateOffer(ctx, unknown); !errors.As(err, &validationErr) || validationErr.Field != "segments" {
+		t.Errorf("Expected a segments validation error, got %v", err)
+	}
+
+	alice, bob, carol := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	for _, userID := range []string{alice, bob, carol} {
+		if _, err := svc.CreateTransactions(ctx, []models.Transaction{{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		}}); err != nil {
+			t.Fatalf("Failed to create transactions: %v", err)
+		}
+	}
+	if _, err := svc.CreateTransactions(ctx, []models.Transaction{{
+		ID:          uuid.New().String(),
+		UserID:      bob,
+		MerchantID:  uuid.New().String(),
+		MCC:         "5411",
+		AmountCents: 2000,
+		ApprovedAt:  time.Date(2025, 8, 15, 12, 0, 0, 0, time.UTC),
+	}}); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	eligible := func(userID string) int {
+		t.Helper()
+		response, err := svc.GetEligibleOffers(ctx, userID, now)
+		if err != nil {
+			t.Fatalf("Failed to get eligible offers: %v", err)
+		}
+		return len(response.EligibleOffers)
+	}
+
+	if n := eligible(alice); n != 0 {
+		t.Errorf("Expected alice to be outside the targeted segments, got %d offers", n)
+	}
+	if n := eligible(bob); n != 1 {
+		t.Errorf("Expected bob to qualify through the rule segment, got %d offers", n)
+	}
+
+	if _, err := svc.AddSegmentMembers(ctx, vip.ID, models.SegmentMembersRequest{UserIDs: []string{alice}}); err != nil {
+		t.Fatalf("Failed to add segment members: %v", err)
+	}
+	if n := eligible(alice); n != 1 {
+		t.Errorf("Expected alice to be eligible once listed, got %d offers", n)
+	}
+
+	explanation, err := svc.ExplainEligibility(ctx, carol, now)
+	if err != nil {
+		t.Fatalf("Failed to explain eligibility: %v", err)
+	}
+	if len(explanation.Offers) != 1 || explanation.Offers[0].Eligible || explanation.Offers[0].FailedCriterion != models.CriterionSegments {
+		t.Errorf("Expected carol's verdict to fail on segments, got %+v", explanation.Offers)
+	}
+	if _, _, err := svc.ActivateOffer(ctx, carol, offer.ID); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("Expected ErrConflict activating outside the segments, got %v", err)
+	}
+
+	if _, err := svc.AddSegmentMembers(ctx, regulars.ID, models.SegmentMembersRequest{UserIDs: []string{carol}}); !errors.As(err, &validationErr) {
+		t.Errorf("Expected a validation error adding members to a rule segment, got %v", err)
+	}
+	if err := svc.DeleteSegment(ctx, vip.ID); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("Expected ErrConflict deleting a targeted segment, got %v", err)
+	}
+}
+
+func TestBatchEligibility(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	svc.SetBatchLimits(3, 2)
+	ctx := context.Background()
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	merchantID := uuid.New().String()
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	if err := svc.CreateOffer(ctx, offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	alice, bob, carol := uuid.New().String(), uuid.New().String(), uuid.New().String()
+	for _, userID := range []string{alice, carol} {
+		if _, err := svc.CreateTransactions(ctx, []models.Transaction{{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		}}); err != nil {
+			t.Fatalf("Failed to create transactions: %v", err)
+		}
+	}
+
+	results := make(map[string]models.BatchEligibilityResult)
+	err := svc.BatchEligibility(ctx, []string{alice, bob, carol}, now, func(result models.BatchEligibilityResult) error {
+		results[result.UserID] = result
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to run batch: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	for userID, want := range map[string]int{alice: 1, bob: 0, carol: 1} {
+		if got := results[userID]; got.Error != "" || len(got.EligibleOffers) != want {
+			t.Errorf("Expected %d offers for %s, got %+v", want, userID, got)
+		}
+	}
+
+	checks, err := db.ListEligibilityChecks(tenant.Default, bob, models.EligibilityHistoryFilter{Limit: 10})
+	if err != nil || len(checks) != 1 {
+		t.Errorf("Expected the batch to record bob's check, got %d (%v)", len(checks), err)
+	}
+
+	var validationErr *validation.ValidationError
+	tooMany := []string{uuid.New().String(), uuid.New().String(), uuid.New().String(), uuid.New().String()}
+	if err := svc.BatchEligibility(ctx, tooMany, now, func(models.BatchEligibilityResult) error { return nil }); !errors.As(err, &validationErr) {
+		t.Errorf("Expected a validation error above the user limit, got %v", err)
+	}
+	if err := svc.BatchEligibility(ctx, []string{alice, alice}, now, func(models.BatchEligibilityResult) error { return nil }); !errors.As(err, &validationErr) {
+		t.Errorf("Expected a validation error for duplicate users, got %v", err)
+	}
+
+	stop := errors.New("client went away")
+	emitted := 0
+	err = svc.BatchEligibility(ctx, []string{alice, bob, carol}, now, func(models.BatchEligibilityResult) error {
+		emitted++
+		return stop
+	})
+	if !errors.Is(err, stop) || emitted != 1 {
+		t.Errorf("Expected the batch to stop after the failed emit, got %d emitted (%v)", emitted, err)
+	}
+}
+
+func TestListEligibleUsers(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	merchantID := uuid.New().String()
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	if err := svc.CreateOffer(ctx, offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	var transactions []models.Transaction
+	for i := 0; i < 3; i++ {
+		transactions = append(transactions, models.Transaction{
+			ID:          uuid.New().String(),
+			UserID:      uuid.New().String(),
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		})
+	}
+	if _, err := svc.CreateTransactions(ctx, transactions); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	first, err := svc.ListEligibleUsers(ctx, offer.ID, now, 2, "")
+	if err != nil {
+		t.Fatalf("Failed to list eligible users: %v", err)
+	}
+	if first.TotalCount != 3 || len(first.Users) != 2 || first.NextCursor == "" {
+		t.Fatalf("Unexpected first page %+v", first)
+	}
+
+	// The cursor keeps the first page's window even once it has slid past the
+	// transactions.
+	second, err := svc.ListEligibleUsers(ctx, offer.ID, now.AddDate(0, 0, 60), 2, first.NextCursor)
+	if err != nil {
+		t.Fatalf("Failed to list eligible users: %v", err)
+	}
+	if len(second.Users) != 1 || second.NextCursor != "" || !second.EvaluatedAt.Equal(now) {
+		t.Errorf("Unexpected second page %+v", second)
+	}
+	if second.Users[0].UserID <= first.Users[1].UserID {
+		t.Errorf("Expected pages in user ID order, got %s after %s", second.Users[0].UserID, first.Users[1].UserID)
+	}
+
+	later, err := svc.ListEligibleUsers(ctx, offer.ID, now.AddDate(0, 0, 60), 0, "")
+	if err != nil || later.TotalCount != 0 || later.Users == nil {
+		t.Errorf("Expected no users once the window slid past, got %+v (%v)", later, err)
+	}
+
+	var validationErr *validation.ValidationError
+	if _, err := svc.ListEligibleUsers(ctx, offer.ID, now, 0, "not-a-cursor"); !errors.As(err, &validationErr) {
+		t.Errorf("Expected a validation error for a bad cursor, got %v", err)
+	}
+	if _, err := svc.ListEligibleUsers(ctx, uuid.New().String(), now, 0, ""); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown offer, got %v", err)
+	}
+
+	ruled := offer
+	ruled.ID = uuid.New().String()
+	ruled.Rules = &models.Rule{Type: models.RuleMinTxnCount, Value: 1}
+	if err := svc.CreateOffer(ctx, ruled); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	if _, err := svc.ListEligibleUsers(ctx, ruled.ID, now, 0, ""); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("Expected ErrConflict for a rule tree offer, got %v", err)
+	}
+}
+
+func TestListEligibleUsers_SegmentsAndCaps(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	merchantID := uuid.New().String()
+	users := []string{uuid.New().String(), uuid.New().String(), uuid.New().String()}
+	var transactions []models.Transaction
+	for _, userID := range users {
+		transactions = append(transactions, models.Transaction{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		})
+	}
+	if _, err := svc.CreateTransactions(ctx, transactions); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	vip, err := svc.CreateSegment(ctx, models.CreateSegmentRequest{Name: "vip", Type: models.SegmentTypeList})
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+	if _, err := svc.AddSegmentMembers(ctx, vip.ID, models.SegmentMembersRequest{UserIDs: users[:2]}); err != nil {
+		t.Fatalf("Failed to add segment members: %v", err)
+	}
+
+	newOffer := func(configure func(*models.Offer)) models.Offer {
+		t.Helper()
+		offer := models.Offer{
+			ID:           uuid.New().String(),
+			MerchantID:   merchantID,
+			Active:       true,
+			MinTxnCount:  1,
+			LookbackDays: 30,
+			StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+			EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+		}
+		configure(&offer)
+		if err := svc.CreateOffer(ctx, offer); err != nil {
+			t.Fatalf("Failed to create offer: %v", err)
+		}
+		return offer
+	}
+	redeem := func(userID, offerID string) {
+		t.Helper()
+		if _, _, err := svc.ActivateOffer(ctx, userID, offerID); err != nil {
+			t.Fatalf("Failed to activate offer: %v", err)
+		}
+		if _, err := svc.RedeemOffer(ctx, userID, offerID); err != nil {
+			t.Fatalf("Failed to redeem offer: %v", err)
+		}
+	}
+	listed := func(offerID string) []string {
+		t.Helper()
+		response, err := svc.ListEligibleUsers(ctx, offerID, now, 0, "")
+		if err != nil {
+			t.Fatalf("Failed to list eligible users: %v", err)
+		}
+		if response.TotalCount != len(response.Users) {
+			t.Errorf("Expected total_count %d to match the page, got %d", len(response.Users), response.TotalCount)
+		}
+		var userIDs []string
+		for _, user := range response.Users {
+			userIDs = append(userIDs, user.UserID)
+		}
+		sort.Strings(userIDs)
+		return userIDs
+	}
+
+	// Only list members are listed, minus those who used up their redemptions.
+	targeted := newOffer(func(offer *models.Offer) {
+		offer.Segments = []string{vip.ID}
+		offer.MaxRedemptionsPerUser = 1
+	})
+	redeem(users[0], targeted.ID)
+	if got := listed(targeted.ID); len(got) != 1 || got[0] != users[1] {
+		t.Errorf("Expected only %s, got %v", users[1], got)
+	}
+
+	capped := newOffer(func(offer *models.Offer) { offer.MaxRedemptions = 1 })
+	if got := listed(capped.ID); len(got) != 3 {
+		t.Errorf("Expected all 3 users before the cap is reached, got %v", got)
+	}
+	redeem(users[2], capped.ID)
+	if got := listed(capped.ID); len(got) != 0 {
+		t.Errorf("Expected no users once max_redemptions is reached, got %v", got)
+	}
+
+	budgeted := newOffer(func(offer *models.Offer) {
+		offer.BudgetCents = 1500
+		offer.RewardCents = 1000
+	})
+	redeem(users[2], budgeted.ID)
+	if got := listed(budgeted.ID); len(got) != 0 {
+		t.Errorf("Expected no users once the budget cannot pay another reward, got %v", got)
+	}
+
+	regulars, err := svc.CreateSegment(ctx, models.CreateSegmentRequest{
+		Name:         "regulars",
+		Type:         models.SegmentTypeRule,
+		Rule:         &models.Rule{Type: models.RuleMinTxnCount, Value: 1},
+		LookbackDays: 30,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+	ruleTargeted := newOffer(func(offer *models.Offer) { offer.Segments = []string{vip.ID, regulars.ID} })
+	if _, err := svc.ListEligibleUsers(ctx, ruleTargeted.ID, now, 0, ""); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("Expected ErrConflict for an offer targeting a rule segment, got %v", err)
+	}
+	if _, err := svc.CreateEligibleUserExport(ctx, ruleTargeted.ID, now); !errors.Is(err, database.ErrConflict) {
+		t.Errorf("Expected ErrConflict exporting an offer targeting a rule segment, got %v", err)
+	}
+}
+
+func TestListEligibleUsers_NoThresholdsMatchesGetEligibleOffers(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	merchantID := uuid.New().String()
+	matching, elsewhere, lapsed, listedOnly := uuid.New().String(), uuid.New().String(), uuid.New().String(), uuid.New().String()
+	transactions := []models.Transaction{
+		{ID: uuid.New().String(), UserID: matching, MerchantID: merchantID, MCC: "5812", AmountCents: 1000, ApprovedAt: time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC)},
+		{ID: uuid.New().String(), UserID: elsewhere, MerchantID: uuid.New().String(), MCC: "5411", AmountCents: 1000, ApprovedAt: time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC)},
+		{ID: uuid.New().String(), UserID: lapsed, MerchantID: merchantID, MCC: "5812", AmountCents: 1000, ApprovedAt: time.Date(2025, 8, 1, 12, 0, 0, 0, time.UTC)},
+	}
+	if _, err := svc.CreateTransactions(ctx, transactions); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	vip, err := svc.CreateSegment(ctx, models.CreateSegmentRequest{Name: "vip", Type: models.SegmentTypeList})
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+	if _, err := svc.AddSegmentMembers(ctx, vip.ID, models.SegmentMembersRequest{UserIDs: []string{matching, listedOnly}}); err != nil {
+		t.Fatalf("Failed to add segment members: %v", err)
+	}
+
+	open := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	targeted := open
+	targeted.ID = uuid.New().String()
+	targeted.Segments = []string{vip.ID}
+	for _, offer := range []models.Offer{open, targeted} {
+		if err := svc.CreateOffer(ctx, offer); err != nil {
+			t.Fatalf("Failed to create offer: %v", err)
+		}
+	}
+
+	// Users GetEligibleOffers finds eligible for each offer. A user with no
+	// transactions is only known to the tenant through a segment.
+	expected := make(map[string][]string)
+	for _, userID := range []string{elsewhere, lapsed, listedOnly, matching} {
+		response, err := svc.GetEligibleOffers(ctx, userID, now)
+		if err != nil {
+			t.Fatalf("Failed to get eligible offers: %v", err)
+		}
+		for _, eligible := range response.EligibleOffers {
+			if eligible.OfferID == open.ID && userID == listedOnly {
+				continue
+			}
+			expected[eligible.OfferID] = append(expected[eligible.OfferID], userID)
+		}
+	}
+	if len(expected[open.ID]) != 3 || len(expected[targeted.ID]) != 2 {
+		t.Fatalf("Expected 3 users eligible for the open offer and 2 for the targeted one, got %v", expected)
+	}
+
+	for _, offer := range []models.Offer{open, targeted} {
+		response, err := svc.ListEligibleUsers(ctx, offer.ID, now, 0, "")
+		if err != nil {
+			t.Fatalf("Failed to list eligible users: %v", err)
+		}
+		var listed []string
+		for _, user := range response.Users {
+			listed = append(listed, user.UserID)
+		}
+
+		want := expected[offer.ID]
+		sort.Strings(want)
+		if response.TotalCount != len(want) || strings.Join(listed, ",") != strings.Join(want, ",") {
+			t.Errorf("Expected %v (total %d) for offer %s, got %v (total %d)", want, len(want), offer.ID, listed, response.TotalCount)
+		}
+	}
+
+	export, err := svc.CreateEligibleUserExport(ctx, open.ID, now)
+	if err != nil {
+		t.Fatalf("Failed to create export: %v", err)
+	}
+	if _, err := svc.RunEligibleUserExports(ctx); err != nil {
+		t.Fatalf("Failed to run exports: %v", err)
+	}
+	if export, err = svc.GetEligibleUserExport(ctx, open.ID, export.ID); err != nil || export.UserCount != 3 {
+		t.Errorf("Expected the export to hold 3 users, got %+v (%v)", export, err)
+	}
+}
+
+func TestEligibleUserExports(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	merchantID := uuid.New().String()
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	if err := svc.CreateOffer(ctx, offer); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+
+	var transactions []models.Transaction
+	for i := 0; i < exportPageSize+1; i++ {
+		transactions = append(transactions, models.Transaction{
+			ID:          uuid.New().String(),
+			UserID:      uuid.New().String(),
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  time.Date(2025, 10, 20, 12, 0, 0, 0, time.UTC),
+		})
+	}
+	if _, err := svc.CreateTransactions(ctx, transactions); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	export, err := svc.CreateEligibleUserExport(ctx, offer.ID, now)
+	if err != nil || export.Status != models.ExportStatusPending {
+		t.Fatalf("Unexpected export %+v (%v)", export, err)
+	}
+	err = svc.StreamEligibleUserExport(ctx, offer.ID, export.ID, func(models.EligibleUser) error { return nil })
+	if !errors.Is(err, database.ErrConflict) {
+		t.Errorf("Expected ErrConflict downloading a pending export, got %v", err)
+	}
+	if _, err := svc.GetEligibleUserExport(ctx, uuid.New().String(), export.ID); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for another offer's export, got %v", err)
+	}
+
+	// An export whose offer is deleted before it runs fails.
+	doomed := offer
+	doomed.ID = uuid.New().String()
+	if err := svc.CreateOffer(ctx, doomed); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	doomedExport, err := svc.CreateEligibleUserExport(ctx, doomed.ID, now)
+	if err != nil {
+		t.Fatalf("Failed to create export: %v", err)
+	}
+	if err := svc.DeleteOffer(ctx, doomed.ID); err != nil {
+		t.Fatalf("Failed to delete offer: %v", err)
+	}
+
+	ran, err := svc.RunEligibleUserExports(ctx)
+	if err != nil || ran != 2 {
+		t.Fatalf("Expected 2 exports to run, got %d (%v)", ran, err)
+	}
+
+	export, err = svc.GetEligibleUserExport(ctx, offer.ID, export.ID)
+	if err != nil || export.Status != models.ExportStatusCompleted || export.UserCount != exportPageSize+1 {
+		t.Fatalf("Unexpected completed export %+v (%v)", export, err)
+	}
+	doomedExport, err = svc.GetEligibleUserExport(ctx, doomed.ID, doomedExport.ID)
+	if err != nil || doomedExport.Status != models.ExportStatusFailed || doomedExport.Error == "" {
+		t.Errorf("Expected the export of a deleted offer to fail, got %+v (%v)", doomedExport, err)
+	}
+
+	var streamed []string
+	err = svc.StreamEligibleUserExport(ctx, offer.ID, export.ID, func(user models.EligibleUser) error {
+		streamed = append(streamed, user.UserID)
+		return nil
+	})
+	if err != nil || len(streamed) != exportPageSize+1 {
+		t.Fatalf("Expected %d streamed users, got %d (%v)", exportPageSize+1, len(streamed), err)
+	}
+	if !sort.StringsAreSorted(streamed) {
+		t.Errorf("Expected the export in user ID order")
+	}
+
+	if ran, err := svc.RunEligibleUserExports(ctx); err != nil || ran != 0 {
+		t.Errorf("Expected nothing left to run, got %d (%v)", ran, err)
+	}
+}
+
+func TestSimulateOffer(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	ctx := context.Background()
+
+	merchantID := uuid.New().String()
+	alice, bob := uuid.New().String(), uuid.New().String()
+	var transactions []models.Transaction
+	for _, txn := range []struct {
+		userID     string
+		approvedAt time.Time
+	}{
+		{alice, time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC)},
+		{alice, time.Date(2025, 10, 3, 12, 0, 0, 0, time.UTC)},
+		{bob, time.Date(2025, 10, 2, 12, 0, 0, 0, time.UTC)},
+	} {
+		transactions = append(transactions, models.Transaction{
+			ID:          uuid.New().String(),
+			UserID:      txn.userID,
+			MerchantID:  merchantID,
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  txn.approvedAt,
+		})
+	}
+	if _, err := svc.CreateTransactions(ctx, transactions); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+
+	offer := models.Offer{
+		MerchantID:   merchantID,
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 2,
+		StartsAt:     time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		EndsAt:       time.Date(2025, 10, 31, 23, 59, 59, 0, time.UTC),
+	}
+	req := models.SimulateOfferRequest{
+		Offer: offer,
+		From:  time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+		To:    time.Date(2025, 10, 6, 0, 0, 0, 0, time.UTC),
+	}
+
+	counts := func(req models.SimulateOfferRequest) []int {
+		t.Helper()
+		response, err := svc.SimulateOffer(ctx, req)
+		if err != nil {
+			t.Fatalf("Failed to simulate offer: %v", err)
+		}
+		var counts []int
+		for _, day := range response.Days {
+			counts = append(counts, day.EligibleUsers)
+		}
+		return counts
+	}
+
+	// Days start at midnight: Oct 1 sees nothing yet, Oct 5 still sees
+	// alice's Oct 3 purchase and Oct 6 sees none.
+	want := []int{0, 1, 2, 2, 1, 0}
+	if got := counts(req); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected daily counts %v, got %v", want, got)
+	}
+
+	ruled := req
+	ruled.Offer.Rules = &models.Rule{Type: models.RuleMinTxnCount, Value: 1}
+	if got := counts(ruled); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected the rule tree to match the grouped query, got %v", got)
+	}
+	ruled.Offer.Rules = &models.Rule{Type: models.RuleMinTxnCount, Value: 2}
+	ruled.Offer.LookbackDays = 3
+	if got, want := counts(ruled), []int{0, 0, 0, 1, 0, 0}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected daily counts %v, got %v", want, got)
+	}
+
+	// Days outside the offer's schedule count no one.
+	windowed := req
+	windowed.Offer.StartsAt = time.Date(2025, 10, 3, 0, 0, 0, 0, time.UTC)
+	windowed.Offer.EndsAt = time.Date(2025, 10, 4, 23, 59, 59, 0, time.UTC)
+	if got, want := counts(windowed), []int{0, 0, 2, 2, 0, 0}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected daily counts %v within the schedule, got %v", want, got)
+	}
+	windowed.Offer.Rules = &models.Rule{Type: models.RuleMinTxnCount, Value: 1}
+	if got, want := counts(windowed), []int{0, 0, 2, 2, 0, 0}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected daily counts %v within the schedule for a rule tree, got %v", want, got)
+	}
+
+	// Segments restrict the count to their members. Alice joins the rule
+	// segment with her second purchase, on Oct 4.
+	vip, err := svc.CreateSegment(ctx, models.CreateSegmentRequest{Name: "vip", Type: models.SegmentTypeList})
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+	if _, err := svc.AddSegmentMembers(ctx, vip.ID, models.SegmentMembersRequest{UserIDs: []string{bob}}); err != nil {
+		t.Fatalf("Failed to add segment members: %v", err)
+	}
+	regulars, err := svc.CreateSegment(ctx, models.CreateSegmentRequest{
+		Name:         "regulars",
+		Type:         models.SegmentTypeRule,
+		Rule:         &models.Rule{Type: models.RuleMinTxnCount, Value: 2},
+		LookbackDays: 10,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create segment: %v", err)
+	}
+
+	targeted := req
+	targeted.Offer.Segments = []string{vip.ID}
+	if got, want := counts(targeted), []int{0, 0, 1, 1, 0, 0}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected daily counts %v for the list segment, got %v", want, got)
+	}
+	targeted.Offer.Segments = []string{regulars.ID}
+	if got, want := counts(targeted), []int{0, 0, 0, 1, 1, 0}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected daily counts %v for the rule segment, got %v", want, got)
+	}
+	targeted.Offer.Segments = []string{vip.ID, regulars.ID}
+	if got, want := counts(targeted), []int{0, 0, 1, 2, 1, 0}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected daily counts %v for either segment, got %v", want, got)
+	}
+
+	// An offer without thresholds is met by every known user, with or
+	// without matching transactions, as in GetEligibleOffers; carol is only
+	// known through the list segment.
+	carol := uuid.New().String()
+	if _, err := svc.AddSegmentMembers(ctx, vip.ID, models.SegmentMembersRequest{UserIDs: []string{carol}}); err != nil {
+		t.Fatalf("Failed to add segment members: %v", err)
+	}
+	open := req
+	open.Offer.MinTxnCount = 0
+	if got, want := counts(open), []int{2, 2, 2, 2, 2, 2}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected daily counts %v without thresholds, got %v", want, got)
+	}
+	open.Offer.Segments = []string{vip.ID}
+	if got, want := counts(open), []int{2, 2, 2, 2, 2, 2}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Expected daily counts %v without thresholds for the list segment, got %v", want, got)
+	}
+
+	offers, err := svc.ListOffers(ctx, models.OfferFilter{})
+	if err != nil || len(offers) != 0 {
+		t.Errorf("Expected the simulation not to store an offer, got %d (%v)", len(offers), err)
+	}
+
+	var validationErr *validation.ValidationError
+	invalid := req
+	invalid.Offer.MerchantID = ""
+	if _, err := svc.SimulateOffer(ctx, invalid); !errors.As(err, &validationErr) {
+		t.Errorf("Expected a validation error for an invalid offer, got %v", err)
+	}
+	invalid = req
+	invalid.To = req.From.AddDate(1, 0, 0)
+	if _, err := svc.SimulateOffer(ctx, invalid); !errors.As(err, &validationErr) || validationErr.Field != "to" {
+		t.Errorf("Expected a validation error for a long range, got %v", err)
+	}
+}
+
+// fakeClock only moves when Advance is called. Every After call is reported on
+// waits, so tests know when the scheduler has gone back to sleep and for how
+// long.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+	waits  chan time.Duration
+}
+
+type fakeTimer struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now, waits: make(chan time.Duration, 100)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+	} else {
+		c.timers = append(c.timers, fakeTimer{at: c.now.Add(d), ch: ch})
+	}
+	c.mu.Unlock()
+
+	c.waits <- d
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if timer.at.After(c.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.ch <- c.now
+	}
+	c.timers = pending
+}
+
+func (c *fakeClock) nextWait(t *testing.T) time.Duration {
+	t.Helper()
+	select {
+	case d := <-c.waits:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the scheduler to sleep")
+		return 0
+	}
+}
+
+func TestOfferScheduler(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	start := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	clock := newFakeClock(start)
+
+	svc := NewService(db)
+	svc.SetEventManager(events.NewManager(true))
+	svc.SetCache(cache.NewInMemoryCache(), time.Minute)
+	svc.now = clock.Now
+	ctx := context.Background()
+
+	newOffer := func(startsAt, endsAt time.Time) models.Offer {
+		t.Helper()
+		offer := models.Offer{
+			ID:           uuid.New().String(),
+			MerchantID:   uuid.New().String(),
+			Active:       true,
+			MinTxnCount:  1,
+			LookbackDays: 30,
+			StartsAt:     startsAt,
+			EndsAt:       endsAt,
+		}
+		if err := svc.CreateOffer(ctx, offer); err != nil {
+			t.Fatalf("Failed to create offer: %v", err)
+		}
+		return offer
+	}
+	live := newOffer(start.Add(-time.Hour), start.Add(2*time.Hour))
+	upcoming := newOffer(start.Add(time.Hour), start.Add(3*time.Hour))
+
+	scheduler := NewOfferScheduler(svc, clock, time.Hour*24)
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	// The first run starts the live offer and sleeps until the upcoming one.
+	if d := clock.nextWait(t); d != time.Hour {
+		t.Errorf("Expected to sleep until the upcoming offer starts, got %v", d)
+	}
+
+	clock.Advance(time.Hour)
+	// The live offer is live through its ends_at and expires a second later.
+	if d := clock.nextWait(t); d != time.Hour+time.Second {
+		t.Errorf("Expected to sleep until the live offer expires, got %v", d)
+	}
+
+	clock.Advance(time.Hour + time.Second)
+	if d := clock.nextWait(t); d != time.Hour {
+		t.Errorf("Expected to sleep until the upcoming offer expires, got %v", d)
+	}
+
+	expired, err := svc.GetOffer(ctx, live.ID)
+	if err != nil || expired.Active {
+		t.Errorf("Expected the ended offer to be deactivated, got %+v (%v)", expired, err)
+	}
+	revisions, err := db.ListOfferRevisions(tenant.Default, live.ID)
+	if err != nil || len(revisions) != 2 || revisions[1].ChangedBy != schedulerChangedBy {
+		t.Errorf("Expected a scheduler revision, got %+v (%v)", revisions, err)
+	}
+	if got, _ := svc.GetOffer(ctx, upcoming.ID); !got.Active {
+		t.Errorf("Expected the upcoming offer to stay active")
+	}
+
+	// A new offer that starts sooner wakes the scheduler.
+	newOffer(clock.Now().Add(10*time.Minute), clock.Now().Add(24*time.Hour))
+	if d := clock.nextWait(t); d != 10*time.Minute {
+		t.Errorf("Expected to sleep until the new offer starts, got %v", d)
+	}
+
+	scheduler.Stop()
+
+	due := clock.Now().Add(time.Hour)
+	pending, err := db.GetPendingOutboxEvents(due, due, 100)
+	if err != nil {
+		t.Fatalf("Failed to get pending events: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, event := range pending {
+		counts[event.EventType]++
+		if event.EventType == string(events.EventOfferEnded) {
+			data, err := events.DecodeData(events.EventOfferEnded, event.Payload)
+			if err != nil || data.(events.OfferEndedData).OfferID != live.ID {
+				t.Errorf("Unexpected offer.ended payload %s (%v)", event.Payload, err)
+			}
+		}
+	}
+	if counts[string(events.EventOfferStarted)] != 2 || counts[string(events.EventOfferEnded)] != 1 {
+		t.Errorf("Expected 2 offer.started and 1 offer.ended events, got %v", counts)
+	}
+
+	if changed, err := svc.RunOfferSchedule(ctx, clock.Now()); err != nil || changed != 0 {
+		t.Errorf("Expected nothing left to start or end, got %d (%v)", changed, err)
+	}
+}
+
+func TestRunRetention(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	svc := NewService(db)
+	svc.SetRetention(30, 2)
+	now := time.Now().UTC().Truncate(time.Second)
+	svc.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	userID := uuid.New().String()
+	var transactions []models.Transaction
+	for _, daysAgo := range []int{800, 700, 500, 400, 396, 394, 1} {
+		transactions = append(transactions, models.Transaction{
+			ID:          uuid.New().String(),
+			UserID:      userID,
+			MerchantID:  uuid.New().String(),
+			MCC:         "5812",
+			AmountCents: 1000,
+			ApprovedAt:  now.AddDate(0, 0, -daysAgo),
+		})
+	}
+	if _, err := svc.CreateTransactions(ctx, transactions); err != nil {
+		t.Fatalf("Failed to create transactions: %v", err)
+	}
+	for _, daysAgo := range []int{500, 396, 1} {
+		if err := db.RecordEligibilityCheck(models.EligibilityCheck{
+			ID:          uuid.New().String(),
+			TenantID:    tenant.Default,
+			UserID:      userID,
+			EvaluatedAt: now.AddDate(0, 0, -daysAgo),
+			CheckedAt:   now.AddDate(0, 0, -daysAgo),
+		}); err != nil {
+			t.Fatalf("Failed to record eligibility check: %v", err)
+		}
+	}
+
+	// Delivered events are purged by delivery time; dead and pending events
+	// are kept whatever their age.
+	outbox := make([]models.OutboxEvent, 5)
+	for i := range outbox {
+		outbox[i] = models.OutboxEvent{
+			ID:        uuid.New().String(),
+			TenantID:  tenant.Default,
+			EventType: string(events.EventOfferCreated),
+			Payload:   []byte("{}"),
+			CreatedAt: now.AddDate(0, 0, -600).Add(time.Duration(i) * time.Second),
+		}
+	}
+	offer := models.Offer{
+		ID:           uuid.New().String(),
+		TenantID:     tenant.Default,
+		MerchantID:   uuid.New().String(),
+		Active:       true,
+		MinTxnCount:  1,
+		LookbackDays: 30,
+		StartsAt:     now,
+		EndsAt:       now.AddDate(0, 1, 0),
+	}
+	if err := db.UpsertOffer(offer, "tester", now, outbox...); err != nil {
+		t.Fatalf("Failed to create offer: %v", err)
+	}
+	for i, daysAgo := range []int{500, 396, 1} {
+		if err := db.MarkOutboxEventDelivered(outbox[i].ID, now.AddDate(0, 0, -daysAgo)); err != nil {
+			t.Fatalf("Failed to mark event delivered: %v", err)
+		}
+	}
+	if err := db.MarkOutboxEventDead(outbox[3].ID, "boom", now.AddDate(0, 0, -500)); err != nil {
+		t.Fatalf("Failed to mark event dead: %v", err)
+	}
+
+	purgedBefore := int64(0)
+	if v, ok := retentionMetrics.Get("transactions_purged").(*expvar.Int); ok {
+		purgedBefore = v.Value()
+	}
+
+	run, err := svc.RunRetention(ctx)
+	if err != nil {
+		t.Fatalf("Failed to run retention: %v", err)
+	}
+	if want := now.AddDate(0, 0, -395); !run.Cutoff.Equal(want) {
+		t.Errorf("Expected cutoff %v, got %v", want, run.Cutoff)
+	}
+	if run.TransactionsPurged != 5 || run.EligibilityChecksPurged != 2 || run.OutboxEventsPurged != 2 || run.Batches != 7 {
+		t.Errorf("Expected 5 transactions, 2 checks and 2 outbox events purged in 7 batches, got %+v", run)
+	}
+	pending, err := db.GetPendingOutboxEvents(now, now, 10)
+	if err != nil || len(pending) != 1 || pending[0].ID != outbox[4].ID {
+		t.Errorf("Expected the pending event to remain, got %+v (%v)", pending, err)
+	}
+	checks, err := db.ListEligibilityChecks(tenant.Default, userID, models.EligibilityHistoryFilter{Limit: 10})
+	if err != nil || len(checks) != 1 {
+		t.Errorf("Expected the check within retention to remain, got %+v (%v)", checks, err)
+	}
+
+	remaining, err := db.GetUserTransactions(tenant.Default, userID, now.AddDate(-10, 0, 0), now)
+	if err != nil || len(remaining) != 2 {
+		t.Errorf("Expected the 2 transactions within retention to remain, got %d (%v)", len(remaining), err)
+	}
+
+	if got := retentionMetrics.Get("transactions_purged").(*expvar.Int).Value() - purgedBefore; got != 5 {
+		t.Errorf("Expected the purge metric to grow by 5, got %d", got)
+	}
+	if got := retentionMetrics.Get("last_run_transactions_purged").String(); got != "5" {
+		t.Errorf("Expected the last run to report 5, got %s", got)
+	}
+
+	run, err = svc.RunRetention(ctx)
+	if err != nil || run.TransactionsPurged != 0 || run.EligibilityChecksPurged != 0 || run.OutboxEventsPurged != 0 || run.Batches != 3 {
+		t.Errorf("Expected nothing left to purge, got %+v (%v)", run, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := svc.RunRetention(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancelled run to stop, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/rules"
+	"offer-eligibility-api/internal/tenant"
+	"offer-eligibility-api/internal/validation"
+
+	"github.com/google/uuid"
+)
+
+// SimulateOffer counts, for every day from req.From to req.To, the users whose
+// stored transactions would have made them eligible for req.Offer at that
+// time. Nothing is written. Days outside the offer's starts_at and ends_at
+// count no one. Offers without a rule tree or segments are counted with the
+// same grouped query as ListEligibleUsers, so an offer without thresholds
+// counts every user with a transaction in the tenant. The others are evaluated
+// in memory over every user with transactions in the simulated range and every
+// listed member of the offer's segments, applying segments the same way
+// GetEligibleOffers does.
+func (s *Service) SimulateOffer(ctx context.Context, req models.SimulateOfferRequest) (models.SimulateOfferResponse, error) {
+	offer := req.Offer
+	offer.TenantID = tenant.FromContext(ctx)
+	if offer.ID == "" {
+		offer.ID = uuid.New().String()
+	}
+	req.Offer = offer
+
+	if err := validation.ValidateSimulateOfferRequest(req); err != nil {
+		return models.SimulateOfferResponse{}, err
+	}
+
+	if err := s.validateOfferSegments(offer); err != nil {
+		return models.SimulateOfferResponse{}, err
+	}
+
+	var days []models.SimulationDay
+	for now := req.From.UTC().Truncate(time.Second); !now.After(req.To); now = now.AddDate(0, 0, 1) {
+		days = append(days, models.SimulationDay{Now: now})
+	}
+	live := func(now time.Time) bool {
+		return !now.Before(offer.StartsAt) && !now.After(offer.EndsAt)
+	}
+
+	if offer.Rules == nil && len(offer.Segments) == 0 {
+		// Count under a fresh ID so the redemptions of a stored offer that
+		// shares req.Offer's ID do not apply.
+		counted := offer
+		counted.ID = uuid.New().String()
+		for i := range days {
+			if !live(days[i].Now) {
+				continue
+			}
+			from, to := rules.LookbackWindow(offer, days[i].Now)
+			count, err := s.db.CountEligibleUsers(counted, from, to)
+			if err != nil {
+				return models.SimulateOfferResponse{}, err
+			}
+			days[i].EligibleUsers = count
+		}
+		return models.SimulateOfferResponse{Days: days}, nil
+	}
+
+	from, _ := rules.LookbackWindow(offer, days[0].Now)
+	to := days[len(days)-1].Now
+
+	var segments []models.Segment
+	listed := map[string]map[string]bool{}
+	if len(offer.Segments) > 0 {
+		var err error
+		if segments, err = s.db.GetSegments(offer.TenantID, offer.Segments); err != nil {
+			return models.SimulateOfferResponse{}, err
+		}
+		if listed, err = s.db.GetSegmentMemberIDs(offer.TenantID, offer.Segments); err != nil {
+			return models.SimulateOfferResponse{}, err
+		}
+		for _, segment := range segments {
+			if segmentFrom := days[0].Now.AddDate(0, 0, -segment.LookbackDays); segmentFrom.Before(from) {
+				from = segmentFrom
+			}
+		}
+	}
+
+	visited := make(map[string]bool)
+	count := func(userID string, transactions []models.Transaction) {
+		visited[userID] = true
+		for i := range days {
+			if !live(days[i].Now) {
+				continue
+			}
+			if len(segments) > 0 && !targets(offer, segmentMembership(segments, listed[userID], transactions, days[i].Now)) {
+				continue
+			}
+			if rules.Evaluate(offer, transactions, days[i].Now).Eligible {
+				days[i].EligibleUsers++
+			}
+		}
+	}
+
+	err := s.db.ForEachUserTransactions(offer.TenantID, from, to, func(userID string, transactions []models.Transaction) error {
+		count(userID, transactions)
+		return nil
+	})
+	if err != nil {
+		return models.SimulateOfferResponse{}, err
+	}
+
+	// Listed members without transactions in the range still qualify for
+	// offers that ask for none, as they would in GetEligibleOffers.
+	for userID := range listed {
+		if !visited[userID] {
+			count(userID, nil)
+		}
+	}
+
+	return models.SimulateOfferResponse{Days: days}, nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
+	"offer-eligibility-api/internal/validation"
+
+	"github.com/google/uuid"
+)
+
+const (
+	webhookSecretPrefix    = "whsec_"
+	defaultWebhookLogLimit = 50
+	maxWebhookLogLimit     = 500
+)
+
+// CreateWebhook registers an endpoint for the caller's tenant. When no secret
+// is supplied one is generated; the returned endpoint is the only place it is
+// shown.
+func (s *Service) CreateWebhook(ctx context.Context, req models.CreateWebhookRequest) (models.WebhookEndpoint, error) {
+	if err := validation.ValidateWebhookRequest(req); err != nil {
+		return models.WebhookEndpoint{}, err
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		buf := make([]byte, 24)
+		if _, err := rand.Read(buf); err != nil {
+			return models.WebhookEndpoint{}, fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+		secret = webhookSecretPrefix + hex.EncodeToString(buf)
+	}
+
+	endpoint := models.WebhookEndpoint{
+		ID:         uuid.New().String(),
+		TenantID:   tenant.FromContext(ctx),
+		URL:        req.URL,
+		EventTypes: req.EventTypes,
+		Secret:     secret,
+		CreatedAt:  s.now().UTC().Truncate(time.Second),
+	}
+
+	if err := s.db.CreateWebhookEndpoint(endpoint); err != nil {
+		return models.WebhookEndpoint{}, err
+	}
+
+	return endpoint, nil
+}
+
+func (s *Service) GetWebhook(ctx context.Context, id string) (models.WebhookEndpoint, error) {
+	if err := validation.ValidateUUID(id, "id"); err != nil {
+		return models.WebhookEndpoint{}, err
+	}
+
+	endpoint, err := s.db.GetWebhookEndpoint(tenant.FromContext(ctx), id)
+	if err != nil {
+		return models.WebhookEndpoint{}, err
+	}
+
+	endpoint.Secret = ""
+	return endpoint, nil
+}
+
+func (s *Service) ListWebhooks(ctx context.Context) ([]models.WebhookEndpoint, error) {
+	endpoints, err := s.db.ListWebhookEndpoints(tenant.FromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+
+	for i := range endpoints {
+		endpoints[i].Secret = ""
+	}
+	if endpoints == nil {
+		endpoints = []models.WebhookEndpoint{}
+	}
+
+	return endpoints, nil
+}
+
+func (s *Service) DeleteWebhook(ctx context.Context, id string) error {
+	if err := validation.ValidateUUID(id, "id"); err != nil {
+		return err
+	}
+
+	return s.db.DeleteWebhookEndpoint(tenant.FromContext(ctx), id)
+}
+
+// ListWebhookDeliveries returns the most recent deliveries to an endpoint,
+// newest first.
+func (s *Service) ListWebhookDeliveries(ctx context.Context, id string, limit int) ([]models.WebhookDelivery, error) {
+	if _, err := s.GetWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := s.db.ListWebhookDeliveries(tenant.FromContext(ctx), id, webhookLogLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+
+	return deliveries, nil
+}
+
+func (s *Service) ListWebhookDeadLetters(ctx context.Context, limit int) ([]models.WebhookDeadLetter, error) {
+	letters, err := s.db.ListWebhookDeadLetters(tenant.FromContext(ctx), webhookLogLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead letters: %w", err)
+	}
+
+	if letters == nil {
+		letters = []models.WebhookDeadLetter{}
+	}
+
+	return letters, nil
+}
+
+func webhookLogLimit(limit int) int {
+	if limit <= 0 {
+		return defaultWebhookLogLimit
+	}
+	if limit > maxWebhookLogLimit {
+		return maxWebhookLogLimit
+	}
+	return limit
+}
@@ -0,0 +1,20 @@
+package tenant
+
+import "context"
+
+// Default is the tenant used when the caller is not authenticated, i.e. when
+// authentication is disabled and the deployment serves a single program.
+const Default = "default"
+
+type contextKey struct{}
+
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenantID)
+}
+
+func FromContext(ctx context.Context) string {
+	if tenantID, ok := ctx.Value(contextKey{}).(string); ok && tenantID != "" {
+		return tenantID
+	}
+	return Default
+}
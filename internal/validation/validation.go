@@ -2,12 +2,30 @@ package validation
 
 import (
 	"fmt"
+	"net/url"
 	"regexp"
 	"strings"
 	"time"
 	"unicode"
 
+	"offer-eligibility-api/internal/events"
 	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/rules"
+)
+
+// MaxLookbackDays is the longest lookback an offer or a rule segment may have.
+// Transactions older than this are never read for eligibility.
+const MaxLookbackDays = 365
+
+const (
+	maxRuleDepth = 8
+	maxRuleNodes = 100
+
+	maxOfferSegments      = 20
+	maxSegmentNameLength  = 100
+	maxSegmentMembersSize = 10000
+
+	maxSimulationDays = 92
 )
 
 var (
@@ -44,6 +62,20 @@ func ValidateOffer(offer models.Offer) error {
 		}
 	}
 
+	if offer.MinSpendCents < 0 {
+		return &ValidationError{
+			Field:   "min_spend_cents",
+			Message: "must be non-negative",
+		}
+	}
+
+	if offer.MinTxnAmountCents < 0 {
+		return &ValidationError{
+			Field:   "min_txn_amount_cents",
+			Message: "must be non-negative",
+		}
+	}
+
 	if offer.LookbackDays < 0 {
 		return &ValidationError{
 			Field:   "lookback_days",
@@ -51,13 +83,59 @@ func ValidateOffer(offer models.Offer) error {
 		}
 	}
 
-	if offer.LookbackDays > 365 {
+	if offer.LookbackDays > MaxLookbackDays {
 		return &ValidationError{
 			Field:   "lookback_days",
 			Message: "cannot exceed 365 days",
 		}
 	}
 
+	if offer.MaxRedemptions < 0 {
+		return &ValidationError{
+			Field:   "max_redemptions",
+			Message: "must be non-negative",
+		}
+	}
+
+	if offer.MaxRedemptionsPerUser < 0 {
+		return &ValidationError{
+			Field:   "max_redemptions_per_user",
+			Message: "must be non-negative",
+		}
+	}
+
+	if offer.BudgetCents < 0 {
+		return &ValidationError{
+			Field:   "budget_cents",
+			Message: "must be non-negative",
+		}
+	}
+
+	if offer.RewardCents < 0 {
+		return &ValidationError{
+			Field:   "reward_cents",
+			Message: "must be non-negative",
+		}
+	}
+
+	if offer.BudgetCents > 0 && offer.RewardCents == 0 {
+		return &ValidationError{
+			Field:   "reward_cents",
+			Message: "is required when budget_cents is set",
+		}
+	}
+
+	if offer.BudgetCents > 0 && offer.RewardCents > offer.BudgetCents {
+		return &ValidationError{
+			Field:   "reward_cents",
+			Message: "cannot exceed budget_cents",
+		}
+	}
+
+	if err := validateOfferSegments(offer.Segments); err != nil {
+		return err
+	}
+
 	if offer.StartsAt.IsZero() {
 		return &ValidationError{
 			Field:   "starts_at",
@@ -87,6 +165,132 @@ func ValidateOffer(offer models.Offer) error {
 		}
 	}
 
+	if offer.Rules != nil {
+		if offer.MinSpendCents != 0 || offer.MinTxnAmountCents != 0 {
+			return &ValidationError{
+				Field:   "rules",
+				Message: "cannot be combined with min_spend_cents or min_txn_amount_cents, use threshold rules instead",
+			}
+		}
+
+		nodes := 0
+		if err := validateRule(*offer.Rules, "rules", 1, &nodes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateRule(rule models.Rule, field string, depth int, nodes *int) error {
+	*nodes++
+	if *nodes > maxRuleNodes {
+		return &ValidationError{
+			Field:   "rules",
+			Message: fmt.Sprintf("cannot contain more than %d rules", maxRuleNodes),
+		}
+	}
+
+	if depth > maxRuleDepth {
+		return &ValidationError{
+			Field:   field,
+			Message: fmt.Sprintf("rules cannot be nested more than %d levels deep", maxRuleDepth),
+		}
+	}
+
+	switch rule.Type {
+	case models.RuleAnd, models.RuleOr, models.RuleNot:
+		if rule.Type == models.RuleNot && len(rule.Rules) != 1 {
+			return &ValidationError{
+				Field:   field,
+				Message: "'not' must have exactly one child rule",
+			}
+		}
+		if len(rule.Rules) == 0 {
+			return &ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("'%s' must have at least one child rule", rule.Type),
+			}
+		}
+		if rule.Match != nil || rule.Value != 0 {
+			return &ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("'%s' cannot have a value or match", rule.Type),
+			}
+		}
+		for i, child := range rule.Rules {
+			if err := validateRule(child, fmt.Sprintf("%s.rules[%d]", field, i), depth+1, nodes); err != nil {
+				return err
+			}
+		}
+	case models.RuleMinTxnCount, models.RuleMinSpendCents, models.RuleMinTxnAmountCents, models.RuleMinDistinctMerchants:
+		if len(rule.Rules) > 0 {
+			return &ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("'%s' cannot have child rules", rule.Type),
+			}
+		}
+		if rule.Value < 0 {
+			return &ValidationError{
+				Field:   field + ".value",
+				Message: "must be non-negative",
+			}
+		}
+		if rule.Match != nil {
+			if err := validateTransactionMatch(*rule.Match, field+".match"); err != nil {
+				return err
+			}
+		}
+	default:
+		return &ValidationError{
+			Field:   field + ".type",
+			Message: fmt.Sprintf("unknown rule type '%s'", rule.Type),
+		}
+	}
+
+	return nil
+}
+
+func validateTransactionMatch(match models.TransactionMatch, field string) error {
+	if match.AnyMerchant && (len(match.MerchantIDs) > 0 || len(match.MCCs) > 0) {
+		return &ValidationError{
+			Field:   field,
+			Message: "any_merchant cannot be combined with merchant_ids or mccs",
+		}
+	}
+
+	for i, merchantID := range match.MerchantIDs {
+		if err := ValidateUUID(merchantID, fmt.Sprintf("%s.merchant_ids[%d]", field, i)); err != nil {
+			return err
+		}
+	}
+
+	for _, list := range []struct {
+		name string
+		mccs []string
+	}{
+		{name: "mccs", mccs: match.MCCs},
+		{name: "exclude_mccs", mccs: match.ExcludeMCCs},
+	} {
+		for i, mcc := range list.mccs {
+			if err := validateMCC(mcc); err != nil {
+				return &ValidationError{
+					Field:   fmt.Sprintf("%s.%s[%d]", field, list.name, i),
+					Message: err.Error(),
+				}
+			}
+		}
+	}
+
+	for i, day := range match.DaysOfWeek {
+		if !rules.IsWeekday(day) {
+			return &ValidationError{
+				Field:   fmt.Sprintf("%s.days_of_week[%d]", field, i),
+				Message: "must be a lowercase weekday name such as 'monday'",
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -232,6 +436,232 @@ func validateMCCWhitelist(mccList []string) error {
 	return nil
 }
 
+func validateOfferSegments(segmentIDs []string) error {
+	if len(segmentIDs) > maxOfferSegments {
+		return &ValidationError{
+			Field:   "segments",
+			Message: fmt.Sprintf("cannot contain more than %d segments", maxOfferSegments),
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, id := range segmentIDs {
+		if err := ValidateUUID(id, fmt.Sprintf("segments[%d]", i)); err != nil {
+			return err
+		}
+		if seen[id] {
+			return &ValidationError{
+				Field:   "segments",
+				Message: fmt.Sprintf("duplicate segment: %s", id),
+			}
+		}
+		seen[id] = true
+	}
+
+	return nil
+}
+
+func ValidateSegmentRequest(req models.CreateSegmentRequest) error {
+	name := SanitizeString(req.Name)
+	if name == "" {
+		return &ValidationError{
+			Field:   "name",
+			Message: "is required",
+		}
+	}
+
+	if len(name) > maxSegmentNameLength {
+		return &ValidationError{
+			Field:   "name",
+			Message: fmt.Sprintf("cannot exceed %d characters", maxSegmentNameLength),
+		}
+	}
+
+	switch req.Type {
+	case models.SegmentTypeList:
+		if req.Rule != nil {
+			return &ValidationError{
+				Field:   "rule",
+				Message: "is not allowed for list segments",
+			}
+		}
+		if req.LookbackDays != 0 {
+			return &ValidationError{
+				Field:   "lookback_days",
+				Message: "is not allowed for list segments",
+			}
+		}
+	case models.SegmentTypeRule:
+		if req.Rule == nil {
+			return &ValidationError{
+				Field:   "rule",
+				Message: "is required for rule segments",
+			}
+		}
+		if req.LookbackDays < 1 || req.LookbackDays > MaxLookbackDays {
+			return &ValidationError{
+				Field:   "lookback_days",
+				Message: "must be between 1 and 365 days",
+			}
+		}
+		nodes := 0
+		if err := validateRule(*req.Rule, "rule", 1, &nodes); err != nil {
+			return err
+		}
+	default:
+		return &ValidationError{
+			Field:   "type",
+			Message: fmt.Sprintf("must be %q or %q", models.SegmentTypeList, models.SegmentTypeRule),
+		}
+	}
+
+	return nil
+}
+
+func ValidateSegmentMembersRequest(req models.SegmentMembersRequest) error {
+	if len(req.UserIDs) == 0 {
+		return &ValidationError{
+			Field:   "user_ids",
+			Message: "must contain at least one user ID",
+		}
+	}
+
+	if len(req.UserIDs) > maxSegmentMembersSize {
+		return &ValidationError{
+			Field:   "user_ids",
+			Message: fmt.Sprintf("cannot contain more than %d user IDs", maxSegmentMembersSize),
+		}
+	}
+
+	for i, userID := range req.UserIDs {
+		if err := ValidateUUID(userID, fmt.Sprintf("user_ids[%d]", i)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ValidateBatchEligibilityRequest(req models.BatchEligibilityRequest, maxUsers int) error {
+	if len(req.UserIDs) == 0 {
+		return &ValidationError{
+			Field:   "user_ids",
+			Message: "must contain at least one user ID",
+		}
+	}
+
+	if len(req.UserIDs) > maxUsers {
+		return &ValidationError{
+			Field:   "user_ids",
+			Message: fmt.Sprintf("cannot contain more than %d user IDs", maxUsers),
+		}
+	}
+
+	seen := make(map[string]bool, len(req.UserIDs))
+	for i, userID := range req.UserIDs {
+		if err := ValidateUUID(userID, fmt.Sprintf("user_ids[%d]", i)); err != nil {
+			return err
+		}
+		if seen[userID] {
+			return &ValidationError{
+				Field:   "user_ids",
+				Message: fmt.Sprintf("duplicate user ID: %s", userID),
+			}
+		}
+		seen[userID] = true
+	}
+
+	return nil
+}
+
+func ValidateSimulateOfferRequest(req models.SimulateOfferRequest) error {
+	if err := ValidateOffer(req.Offer); err != nil {
+		return err
+	}
+
+	if req.From.IsZero() {
+		return &ValidationError{
+			Field:   "from",
+			Message: "is required",
+		}
+	}
+
+	if req.To.IsZero() {
+		return &ValidationError{
+			Field:   "to",
+			Message: "is required",
+		}
+	}
+
+	if req.To.Before(req.From) {
+		return &ValidationError{
+			Field:   "to",
+			Message: "must not be before from",
+		}
+	}
+
+	if req.To.Sub(req.From) >= maxSimulationDays*24*time.Hour {
+		return &ValidationError{
+			Field:   "to",
+			Message: fmt.Sprintf("cannot be more than %d days after from", maxSimulationDays-1),
+		}
+	}
+
+	return nil
+}
+
+const minWebhookSecretLength = 16
+
+func ValidateWebhookRequest(req models.CreateWebhookRequest) error {
+	if req.URL == "" {
+		return &ValidationError{
+			Field:   "url",
+			Message: "is required",
+		}
+	}
+
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &ValidationError{
+			Field:   "url",
+			Message: "must be an absolute http or https URL",
+		}
+	}
+
+	if len(req.EventTypes) == 0 {
+		return &ValidationError{
+			Field:   "event_types",
+			Message: "must contain at least one event type",
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, eventType := range req.EventTypes {
+		if !events.IsValidEventType(eventType) {
+			return &ValidationError{
+				Field:   "event_types",
+				Message: fmt.Sprintf("unknown event type: %s", eventType),
+			}
+		}
+		if seen[eventType] {
+			return &ValidationError{
+				Field:   "event_types",
+				Message: fmt.Sprintf("duplicate event type: %s", eventType),
+			}
+		}
+		seen[eventType] = true
+	}
+
+	if req.Secret != "" && len(req.Secret) < minWebhookSecretLength {
+		return &ValidationError{
+			Field:   "secret",
+			Message: fmt.Sprintf("must be at least %d characters", minWebhookSecretLength),
+		}
+	}
+
+	return nil
+}
+
 func ValidateTimeString(timeStr string) (time.Time, error) {
 	if timeStr == "" {
 		return time.Time{}, &ValidationError{
@@ -0,0 +1,359 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"offer-eligibility-api/internal/events"
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
+
+	"github.com/google/uuid"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+
+	maxErrorBodySize = 512
+
+	// claimTimeout is how long a claimed delivery may go without its attempt
+	// being recorded before another dispatcher claims it again.
+	claimTimeout = 15 * time.Minute
+)
+
+type Store interface {
+	ListWebhookEndpoints(tenantID string) ([]models.WebhookEndpoint, error)
+	GetWebhookEndpoint(tenantID, id string) (models.WebhookEndpoint, error)
+	EnqueueWebhookDeliveries(deliveries []models.WebhookDelivery) error
+	GetDueWebhookDeliveries(now, staleBefore time.Time, limit int) ([]models.WebhookDelivery, error)
+	ClaimWebhookDelivery(id string, now, staleBefore time.Time) (bool, error)
+	RecordWebhookAttempt(delivery models.WebhookDelivery) error
+}
+
+type Options struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	PollInterval   time.Duration
+	BatchSize      int
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxAttempts:    8,
+		InitialBackoff: 10 * time.Second,
+		MaxBackoff:     time.Hour,
+		Timeout:        10 * time.Second,
+		PollInterval:   5 * time.Second,
+		BatchSize:      100,
+	}
+}
+
+// Envelope is the JSON body posted to every endpoint. ID identifies the event
+// and is the same for every endpoint it is delivered to.
+type Envelope struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	TenantID   string          `json:"tenant_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// Dispatcher turns events into webhook deliveries and delivers them. Deliveries
+// are queued in the database, so pending retries survive a restart; each one
+// is attempted until it succeeds or exhausts MaxAttempts and is dead-lettered.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	opts   Options
+	now    func() time.Time
+
+	wake     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewDispatcher(store Store, opts Options) *Dispatcher {
+	defaults := DefaultOptions()
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaults.MaxAttempts
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = defaults.InitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaults.MaxBackoff
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaults.Timeout
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaults.PollInterval
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaults.BatchSize
+	}
+
+	return &Dispatcher{
+		store:  store,
+		client: &http.Client{Timeout: opts.Timeout},
+		opts:   opts,
+		now:    time.Now,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Subscribe registers the dispatcher for every event type.
+func (d *Dispatcher) Subscribe(m *events.Manager) {
+	for _, eventType := range events.EventTypes() {
+		m.Subscribe(eventType, d.HandleEvent)
+	}
+}
+
+// HandleEvent queues one delivery per endpoint of the event's tenant that
+// subscribes to its type.
+func (d *Dispatcher) HandleEvent(ctx context.Context, event events.Event) error {
+	tenantID := tenant.FromContext(ctx)
+
+	endpoints, err := d.store.ListWebhookEndpoints(tenantID)
+	if err != nil {
+		return fmt.Errorf("failed to list webhook endpoints: %w", err)
+	}
+
+	var targets []models.WebhookEndpoint
+	for _, endpoint := range endpoints {
+		if subscribes(endpoint, event.Type) {
+			targets = append(targets, endpoint)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event data: %w", err)
+	}
+
+	// Relayed events carry a stable ID; deriving delivery IDs from it makes a
+	// redelivered event enqueue nothing new.
+	eventID := event.ID
+	if eventID == "" {
+		eventID = uuid.New().String()
+	}
+
+	payload, err := json.Marshal(Envelope{
+		ID:         eventID,
+		Type:       string(event.Type),
+		TenantID:   tenantID,
+		OccurredAt: event.Timestamp.UTC(),
+		Data:       data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	now := d.now().UTC()
+	deliveries := make([]models.WebhookDelivery, 0, len(targets))
+	for _, endpoint := range targets {
+		deliveries = append(deliveries, models.WebhookDelivery{
+			ID:            uuid.NewSHA1(uuid.NameSpaceOID, []byte(eventID+":"+endpoint.ID)).String(),
+			EndpointID:    endpoint.ID,
+			TenantID:      tenantID,
+			EventType:     string(event.Type),
+			Payload:       payload,
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+
+	if err := d.store.EnqueueWebhookDeliveries(deliveries); err != nil {
+		return err
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Start runs the delivery loop until Stop is called.
+func (d *Dispatcher) Start() {
+	go func() {
+		defer close(d.done)
+
+		ticker := time.NewTicker(d.opts.PollInterval)
+		defer ticker.Stop()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			<-d.stop
+			cancel()
+		}()
+
+		for {
+			if _, err := d.ProcessDue(ctx); err != nil {
+				log.Printf("webhooks: %v", err)
+			}
+
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+func (d *Dispatcher) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+	<-d.done
+}
+
+// ProcessDue attempts every delivery that is due and returns how many were
+// attempted. Each delivery is claimed before it is sent, so dispatchers on
+// other servers sharing the database do not send it too.
+func (d *Dispatcher) ProcessDue(ctx context.Context) (int, error) {
+	now := d.now().UTC()
+	deliveries, err := d.store.GetDueWebhookDeliveries(now, now.Add(-claimTimeout), d.opts.BatchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load due deliveries: %w", err)
+	}
+
+	attempted := 0
+	for _, delivery := range deliveries {
+		if ctx.Err() != nil {
+			return attempted, ctx.Err()
+		}
+
+		now := d.now().UTC()
+		claimed, err := d.store.ClaimWebhookDelivery(delivery.ID, now, now.Add(-claimTimeout))
+		if err != nil {
+			return attempted, err
+		}
+		if !claimed {
+			continue
+		}
+
+		if err := d.attempt(ctx, delivery); err != nil {
+			return attempted, err
+		}
+		attempted++
+	}
+
+	return attempted, nil
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery models.WebhookDelivery) error {
+	endpoint, err := d.store.GetWebhookEndpoint(delivery.TenantID, delivery.EndpointID)
+	if err != nil {
+		return fmt.Errorf("failed to load endpoint for delivery %s: %w", delivery.ID, err)
+	}
+
+	statusCode, sendErr := d.send(ctx, endpoint, delivery)
+
+	now := d.now().UTC()
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.UpdatedAt = now
+
+	switch {
+	case sendErr == nil:
+		delivery.Status = models.WebhookDeliveryDelivered
+		delivery.LastError = ""
+	case delivery.Attempts >= d.opts.MaxAttempts:
+		delivery.Status = models.WebhookDeliveryDead
+		delivery.LastError = sendErr.Error()
+	default:
+		delivery.LastError = sendErr.Error()
+		delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+	}
+
+	return d.store.RecordWebhookAttempt(delivery)
+}
+
+func (d *Dispatcher) send(ctx context.Context, endpoint models.WebhookEndpoint, delivery models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(endpoint.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	return resp.StatusCode, nil
+}
+
+// backoff doubles the delay after every failed attempt, starting at
+// InitialBackoff and capped at MaxBackoff.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.opts.InitialBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= d.opts.MaxBackoff {
+			return d.opts.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// Sign returns the signature header value for a payload: the hex HMAC-SHA256
+// of "<timestamp>.<payload>" keyed with the endpoint secret. Receivers should
+// recompute it and reject stale timestamps.
+func Sign(secret string, timestamp int64, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func subscribes(endpoint models.WebhookEndpoint, eventType events.EventType) bool {
+	for _, t := range endpoint.EventTypes {
+		if t == string(eventType) {
+			return true
+		}
+	}
+	return false
+}
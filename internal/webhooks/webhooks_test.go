@@ -0,0 +1,277 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"offer-eligibility-api/internal/database"
+	"offer-eligibility-api/internal/events"
+	"offer-eligibility-api/internal/models"
+	"offer-eligibility-api/internal/tenant"
+
+	"github.com/google/uuid"
+)
+
+const testSecret = "whsec_test_secret_0123456789"
+
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+type receiver struct {
+	mu       sync.Mutex
+	requests []receivedRequest
+	status   int
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	rc.requests = append(rc.requests, receivedRequest{header: r.Header.Clone(), body: body})
+	status := rc.status
+	rc.mu.Unlock()
+
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) received() []receivedRequest {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return append([]receivedRequest(nil), rc.requests...)
+}
+
+func setupDispatcher(t *testing.T, opts Options) (*Dispatcher, *database.DB, *time.Time) {
+	t.Helper()
+
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "webhooks.db"))
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	now := time.Date(2025, 10, 21, 10, 0, 0, 0, time.UTC)
+	d := NewDispatcher(db, opts)
+	d.now = func() time.Time { return now }
+
+	return d, db, &now
+}
+
+func createEndpoint(t *testing.T, db *database.DB, tenantID, url string, eventTypes ...string) models.WebhookEndpoint {
+	t.Helper()
+
+	endpoint := models.WebhookEndpoint{
+		ID:         uuid.New().String(),
+		TenantID:   tenantID,
+		URL:        url,
+		EventTypes: eventTypes,
+		Secret:     testSecret,
+		CreatedAt:  time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if err := db.CreateWebhookEndpoint(endpoint); err != nil {
+		t.Fatalf("Failed to create webhook endpoint: %v", err)
+	}
+	return endpoint
+}
+
+func offerDeletedEvent() events.Event {
+	return events.Event{
+		Type:      events.EventOfferDeleted,
+		Timestamp: time.Date(2025, 10, 21, 9, 59, 0, 0, time.UTC),
+		Data:      events.OfferDeletedData{OfferID: "offer-1"},
+	}
+}
+
+func TestDispatcher_DeliversSignedPayload(t *testing.T) {
+	rc := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	d, db, now := setupDispatcher(t, Options{})
+	endpoint := createEndpoint(t, db, "tenant-a", server.URL, string(events.EventOfferDeleted))
+	createEndpoint(t, db, "tenant-a", server.URL, string(events.EventOfferCreated))
+	createEndpoint(t, db, "tenant-b", server.URL, string(events.EventOfferDeleted))
+
+	ctx := tenant.WithTenant(context.Background(), "tenant-a")
+	if err := d.HandleEvent(ctx, offerDeletedEvent()); err != nil {
+		t.Fatalf("Failed to handle event: %v", err)
+	}
+
+	attempted, err := d.ProcessDue(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to process deliveries: %v", err)
+	}
+	if attempted != 1 {
+		t.Fatalf("Expected 1 delivery attempted, got %d", attempted)
+	}
+
+	requests := rc.received()
+	if len(requests) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(requests))
+	}
+	req := requests[0]
+
+	timestamp, err := strconv.ParseInt(req.header.Get(TimestampHeader), 10, 64)
+	if err != nil || timestamp != now.Unix() {
+		t.Errorf("Expected timestamp %d, got %q", now.Unix(), req.header.Get(TimestampHeader))
+	}
+	if got, want := req.header.Get(SignatureHeader), Sign(testSecret, timestamp, req.body); got != want {
+		t.Errorf("Expected signature %s, got %s", want, got)
+	}
+	if req.header.Get(EventHeader) != string(events.EventOfferDeleted) {
+		t.Errorf("Expected event header %s, got %s", events.EventOfferDeleted, req.header.Get(EventHeader))
+	}
+
+	var envelope Envelope
+	if err := json.Unmarshal(req.body, &envelope); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	if envelope.Type != string(events.EventOfferDeleted) || envelope.TenantID != "tenant-a" || envelope.ID == "" {
+		t.Errorf("Unexpected envelope: %+v", envelope)
+	}
+	if string(envelope.Data) != `{"offer_id":"offer-1"}` {
+		t.Errorf("Unexpected event data: %s", envelope.Data)
+	}
+
+	deliveries, err := db.ListWebhookDeliveries("tenant-a", endpoint.ID, 10)
+	if err != nil {
+		t.Fatalf("Failed to list deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != models.WebhookDeliveryDelivered || deliveries[0].Attempts != 1 {
+		t.Errorf("Expected one delivered delivery after 1 attempt, got %+v", deliveries)
+	}
+	if deliveries[0].LastStatusCode != http.StatusOK {
+		t.Errorf("Expected last status 200, got %d", deliveries[0].LastStatusCode)
+	}
+}
+
+func TestDispatcher_SkipsDeliveriesClaimedElsewhere(t *testing.T) {
+	rc := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	d, db, now := setupDispatcher(t, Options{})
+	endpoint := createEndpoint(t, db, "tenant-a", server.URL, string(events.EventOfferDeleted))
+
+	ctx := tenant.WithTenant(context.Background(), "tenant-a")
+	if err := d.HandleEvent(ctx, offerDeletedEvent()); err != nil {
+		t.Fatalf("Failed to handle event: %v", err)
+	}
+	deliveries, err := db.ListWebhookDeliveries("tenant-a", endpoint.ID, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("Expected one queued delivery, got %+v (%v)", deliveries, err)
+	}
+
+	// Another server claims the delivery first.
+	if claimed, err := db.ClaimWebhookDelivery(deliveries[0].ID, *now, now.Add(-claimTimeout)); err != nil || !claimed {
+		t.Fatalf("Expected the delivery to be claimed, got %v (%v)", claimed, err)
+	}
+	if attempted, err := d.ProcessDue(context.Background()); err != nil || attempted != 0 {
+		t.Errorf("Expected a claimed delivery to be skipped, got %d (%v)", attempted, err)
+	}
+	if claimed, _ := db.ClaimWebhookDelivery(deliveries[0].ID, *now, now.Add(-claimTimeout)); claimed {
+		t.Error("Expected a delivery to be claimed once")
+	}
+
+	// That server stopped before recording its attempt.
+	*now = now.Add(claimTimeout + time.Minute)
+	if attempted, err := d.ProcessDue(context.Background()); err != nil || attempted != 1 {
+		t.Fatalf("Expected the stale claim to be taken over, got %d (%v)", attempted, err)
+	}
+	if attempted, err := d.ProcessDue(context.Background()); err != nil || attempted != 0 {
+		t.Errorf("Expected nothing left to attempt, got %d (%v)", attempted, err)
+	}
+	if requests := rc.received(); len(requests) != 1 {
+		t.Errorf("Expected the delivery to be sent once, got %d requests", len(requests))
+	}
+}
+
+func TestDispatcher_RetriesWithBackoffThenDeadLetters(t *testing.T) {
+	rc := &receiver{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	d, db, now := setupDispatcher(t, Options{
+		MaxAttempts:    3,
+		InitialBackoff: 10 * time.Second,
+		MaxBackoff:     time.Minute,
+	})
+	endpoint := createEndpoint(t, db, tenant.Default, server.URL, string(events.EventOfferDeleted))
+
+	if err := d.HandleEvent(context.Background(), offerDeletedEvent()); err != nil {
+		t.Fatalf("Failed to handle event: %v", err)
+	}
+
+	delivery := func() models.WebhookDelivery {
+		deliveries, err := db.ListWebhookDeliveries(tenant.Default, endpoint.ID, 10)
+		if err != nil {
+			t.Fatalf("Failed to list deliveries: %v", err)
+		}
+		if len(deliveries) != 1 {
+			t.Fatalf("Expected 1 delivery, got %d", len(deliveries))
+		}
+		return deliveries[0]
+	}
+
+	for attempt, backoff := range []time.Duration{10 * time.Second, 20 * time.Second} {
+		if _, err := d.ProcessDue(context.Background()); err != nil {
+			t.Fatalf("Failed to process deliveries: %v", err)
+		}
+
+		got := delivery()
+		if got.Status != models.WebhookDeliveryPending || got.Attempts != attempt+1 {
+			t.Fatalf("Expected pending delivery after %d attempts, got %+v", attempt+1, got)
+		}
+		if !got.NextAttemptAt.Equal(now.Add(backoff)) {
+			t.Errorf("Expected next attempt at %v, got %v", now.Add(backoff), got.NextAttemptAt)
+		}
+		if got.LastStatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected last status 503, got %d", got.LastStatusCode)
+		}
+
+		if attempted, _ := d.ProcessDue(context.Background()); attempted != 0 {
+			t.Errorf("Expected no delivery attempted before the backoff elapses, got %d", attempted)
+		}
+
+		*now = now.Add(backoff)
+	}
+
+	if _, err := d.ProcessDue(context.Background()); err != nil {
+		t.Fatalf("Failed to process deliveries: %v", err)
+	}
+
+	if got := delivery(); got.Status != models.WebhookDeliveryDead || got.Attempts != 3 {
+		t.Errorf("Expected dead delivery after 3 attempts, got %+v", got)
+	}
+	if len(rc.received()) != 3 {
+		t.Errorf("Expected 3 requests, got %d", len(rc.received()))
+	}
+
+	letters, err := db.ListWebhookDeadLetters(tenant.Default, 10)
+	if err != nil {
+		t.Fatalf("Failed to list dead letters: %v", err)
+	}
+	if len(letters) != 1 || letters[0].EndpointID != endpoint.ID || letters[0].Attempts != 3 {
+		t.Errorf("Expected one dead letter for %s, got %+v", endpoint.ID, letters)
+	}
+}
+
+func TestDispatcher_BackoffIsCapped(t *testing.T) {
+	d := NewDispatcher(nil, Options{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second})
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := d.backoff(i + 1); got != want {
+			t.Errorf("Expected backoff %v after %d attempts, got %v", want, i+1, got)
+		}
+	}
+}